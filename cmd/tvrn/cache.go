@@ -0,0 +1,231 @@
+package main
+
+import (
+  "context"
+  "errors"
+  "flag"
+  "fmt"
+  "os"
+  "sort"
+  "strconv"
+  "strings"
+  "text/tabwriter"
+  "time"
+
+  "github.com/GizzmoShifu/tvrn/internal/cache"
+  "github.com/GizzmoShifu/tvrn/internal/config"
+  "github.com/GizzmoShifu/tvrn/internal/runner"
+  "github.com/GizzmoShifu/tvrn/internal/tvdb"
+)
+
+const cacheUsage = `Usage:
+  tvrn cache ls [prefix]            list entries with size, hits and expiry
+  tvrn cache stats                  totals by provider and kind
+  tvrn cache purge --series ID      delete a series' entries
+  tvrn cache purge --prefix P       delete entries whose key starts with P
+  tvrn cache purge --all            delete everything
+  tvrn cache prune [--older-than D] delete expired entries, or any older than D (e.g. 30d, 12h)
+  tvrn cache warm [--provider P] <series>
+                                    fetch a series and all its seasons into the cache
+  tvrn cache migrate                move FS cache files into the configured bolt database`
+
+// runCache handles `tvrn cache ...`
+func runCache(cfg *config.Config, args []string) error {
+  defer closeCache()
+  if len(args) == 0 {
+    fmt.Println(cacheUsage)
+    return nil
+  }
+  store, err := openCache(cfg)
+  if err != nil { return err }
+
+  fs := flag.NewFlagSet("tvrn cache "+args[0], flag.ContinueOnError)
+  fs.SetOutput(os.Stdout)
+  fs.Usage = func() { fmt.Println(cacheUsage) }
+  series := fs.Int("series", 0, "Series ID to purge")
+  prefix := fs.String("prefix", "", "Key prefix to purge")
+  all := fs.Bool("all", false, "Purge every entry")
+  olderThan := fs.String("older-than", "", "Prune entries written longer ago than this, e.g. 30d")
+  provider := fs.String("provider", "", "Provider to warm from: tvdb | tmdb | tvmaze")
+  if err := fs.Parse(args[1:]); err != nil {
+    if err == flag.ErrHelp { return nil }
+    return err
+  }
+
+  switch args[0] {
+  case "ls":
+    return cacheList(store, fs.Arg(0))
+  case "stats":
+    return cacheStats(store)
+  case "purge":
+    if *series == 0 && *prefix == "" && !*all {
+      return errors.New("purge needs --series, --prefix or --all")
+    }
+    return cacheDelete(store, func(i cache.Info) bool {
+      if *all { return true }
+      if *prefix != "" && strings.HasPrefix(i.Key, *prefix) { return true }
+      id, ok := tvdb.KeySeriesID(i.Key)
+      return *series != 0 && ok && id == *series
+    })
+  case "prune":
+    var age time.Duration
+    if *olderThan != "" {
+      d, err := parseAge(*olderThan)
+      if err != nil { return err }
+      age = d
+    }
+    now := time.Now()
+    return cacheDelete(store, func(i cache.Info) bool {
+      if i.Expired(now) { return true }
+      return age > 0 && now.Sub(i.Modified) > age
+    })
+  case "migrate":
+    if _, ok := store.(*cache.Bolt); !ok { return errors.New("migrate needs cache.backend = \"bolt\"") }
+    n, err := cache.MigrateFS(cache.NewFS(cfg.Home), store)
+    fmt.Printf("Migrated %d entries\n", n)
+    return err
+  case "warm":
+    if fs.NArg() == 0 { return errors.New("warm needs a series name") }
+    if *provider != "" { cfg.Defaults.Provider = strings.ToLower(*provider) }
+    cfg.CLI.NoCache, cfg.CLI.Offline, cfg.CLI.Metadata = false, false, ""
+    return cacheWarm(cfg, strings.Join(fs.Args(), " "))
+  default:
+    fmt.Println(cacheUsage)
+    return fmt.Errorf("unknown cache command %q", args[0])
+  }
+}
+
+func cacheList(store cache.Store, prefix string) error {
+  infos, err := store.List()
+  if err != nil { return err }
+  sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+
+  now := time.Now()
+  tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+  fmt.Fprintln(tw, "KEY\tSIZE\tHITS\tWRITTEN\tEXPIRES")
+  for _, i := range infos {
+    if !strings.HasPrefix(i.Key, prefix) { continue }
+    exp := "never"
+    if !i.Expires.IsZero() {
+      exp = i.Expires.Format("2006-01-02 15:04")
+      if i.Expired(now) { exp += " (expired)" }
+    }
+    fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", i.Key, humanSize(i.Size), i.Hits, i.Modified.Format("2006-01-02 15:04"), exp)
+  }
+  return tw.Flush()
+}
+
+func cacheStats(store cache.Store) error {
+  infos, err := store.List()
+  if err != nil { return err }
+
+  type agg struct{ n, hits, expired int; size int64 }
+  groups := map[string]*agg{}
+  var total agg
+  now := time.Now()
+  for _, i := range infos {
+    g := groups[keyGroup(i.Key)]
+    if g == nil {
+      g = &agg{}
+      groups[keyGroup(i.Key)] = g
+    }
+    for _, a := range []*agg{g, &total} {
+      a.n++
+      a.hits += i.Hits
+      a.size += i.Size
+      if i.Expired(now) { a.expired++ }
+    }
+  }
+
+  names := make([]string, 0, len(groups))
+  for k := range groups { names = append(names, k) }
+  sort.Strings(names)
+  tw := tabwriter.NewWriter(os.Stdout, 0, 2, 2, ' ', 0)
+  fmt.Fprintln(tw, "GROUP\tENTRIES\tSIZE\tHITS\tEXPIRED")
+  for _, k := range names {
+    g := groups[k]
+    fmt.Fprintf(tw, "%s\t%d\t%s\t%d\t%d\n", k, g.n, humanSize(g.size), g.hits, g.expired)
+  }
+  fmt.Fprintf(tw, "total\t%d\t%s\t%d\t%d\n", total.n, humanSize(total.size), total.hits, total.expired)
+  return tw.Flush()
+}
+
+// keyGroup is "provider kind", e.g. "tvdb episodes" or "tmdb search"
+func keyGroup(key string) string {
+  parts := strings.SplitN(key, ":", 3)
+  switch {
+  case len(parts) > 1 && (parts[0] == "search" || parts[0] == "series" || parts[0] == "episodes"):
+    return "tvdb " + parts[0]
+  case len(parts) > 1:
+    return parts[0] + " " + parts[1]
+  }
+  return "other"
+}
+
+func cacheDelete(store cache.Store, match func(cache.Info) bool) error {
+  infos, err := store.List()
+  if err != nil { return err }
+  n := 0
+  var freed int64
+  for _, i := range infos {
+    if !match(i) { continue }
+    if err := store.Delete(i.Key); err != nil { return err }
+    n++
+    freed += i.Size
+  }
+  fmt.Printf("Deleted %d entries, %s\n", n, humanSize(freed))
+  return nil
+}
+
+// cacheWarm fetches everything a run over the series would need: the search by name,
+// the series record, and its episodes per season in the configured order and language.
+func cacheWarm(cfg *config.Config, name string) error {
+  if err := cfg.Validate(); err != nil { return err }
+  client, err := newClient(cfg, newLogger(cfg))
+  if err != nil { return err }
+
+  ctx := context.Background()
+  if err := client.Login(ctx); err != nil { return err }
+  hits, err := client.SearchSeries(ctx, name, cfg.Defaults.Lang)
+  if err != nil { return err }
+  if len(hits) == 0 { return fmt.Errorf("no results for %q", name) }
+  show := hits[0]
+  for _, h := range hits {
+    if strings.EqualFold(h.Name, name) { show = h; break }
+  }
+  if _, err := client.GetSeries(ctx, show.ID, cfg.Defaults.Lang); err != nil { return err }
+
+  // --order auto looks at every order, so warm each one the provider has
+  orders := []string{cfg.Defaults.Order}
+  if cfg.Defaults.Order == "auto" { orders = runner.AutoOrders() }
+  for _, order := range orders {
+    all, err := client.GetEpisodes(ctx, show.ID, order, 0, cfg.Defaults.Lang)
+    if err != nil && len(orders) > 1 { continue }
+    if err != nil { return err }
+    seasons := map[int]bool{}
+    for _, e := range all { seasons[e.Season] = true }
+    for s := range seasons {
+      if _, err := client.GetEpisodes(ctx, show.ID, order, s, cfg.Defaults.Lang); err != nil { return err }
+    }
+    fmt.Printf("Warmed %s (id %d): %d episodes in %d seasons, order=%s\n", show.Name, show.ID, len(all), len(seasons), order)
+  }
+  return nil
+}
+
+// parseAge accepts Go durations plus a "d" suffix for days
+func parseAge(s string) (time.Duration, error) {
+  if strings.HasSuffix(s, "d") {
+    n, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+    if err != nil { return 0, fmt.Errorf("bad age %q", s) }
+    return time.Duration(n) * 24 * time.Hour, nil
+  }
+  return time.ParseDuration(s)
+}
+
+func humanSize(n int64) string {
+  switch {
+  case n >= 1<<20: return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+  case n >= 1<<10: return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+  }
+  return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+  "context"
+  "errors"
+  "fmt"
+  "io/fs"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+
+  "github.com/GizzmoShifu/tvrn/internal/config"
+  "github.com/GizzmoShifu/tvrn/internal/parse"
+  "github.com/GizzmoShifu/tvrn/internal/planner"
+  "github.com/GizzmoShifu/tvrn/internal/runner"
+)
+
+const hookUsage = `Usage:
+  tvrn hook sonarr                          Sonarr custom script (Connect > Custom Script)
+  tvrn hook qbittorrent "%F" "%L" "%N"      qBittorrent "Run external program on torrent finished"
+  tvrn hook sabnzbd                         SABnzbd post-processing script
+
+Renames the completed download without asking. Only the downloaded media files are
+renamed; folders are never touched and existing files are never overwritten.
+Exits 0 when done or when there is nothing to do, 1 when anything failed.`
+
+// Download clients only tell success from failure; SABnzbd also shows the last line printed
+const (
+  hookOK     = 0
+  hookFailed = 1
+)
+
+// hookJob is what a client's completion contract tells us about one download
+type hookJob struct {
+  Path     string // completed file or folder
+  Category string
+  Name     string // release name
+  Show     string // series title, when the client knows it
+  Skip     string // reason to succeed without doing anything
+}
+
+// runHook handles `tvrn hook <client>` and returns the process exit code
+func runHook(cfg *config.Config, args []string) int {
+  defer closeCache()
+  if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+    os.Stdout.WriteString(hookUsage + "\n")
+    return hookOK
+  }
+  job, err := readHookJob(args[0], args[1:], os.Getenv)
+  if err != nil {
+    os.Stdout.WriteString(hookUsage + "\n")
+    fmt.Printf("tvrn: %v\n", err)
+    return hookFailed
+  }
+  if job.Skip == "" && !hookCategory(cfg.Hook.Categories, job.Category) {
+    job.Skip = fmt.Sprintf("category %q is not in hook.categories", job.Category)
+  }
+  if job.Skip != "" {
+    fmt.Printf("tvrn: nothing to do: %s\n", job.Skip)
+    return hookOK
+  }
+
+  interrupt = trapInterrupts()
+  n, err := hookApply(interrupt.ctx, cfg, job)
+  if err != nil {
+    fmt.Printf("tvrn: %v\n", err)
+    return hookFailed
+  }
+  fmt.Printf("tvrn: renamed %d file(s)\n", n)
+  return hookOK
+}
+
+// readHookJob decodes one client's contract from its arguments and environment
+func readHookJob(client string, args []string, getenv func(string) string) (hookJob, error) {
+  switch strings.ToLower(client) {
+  case "sonarr":
+    // https://wiki.servarr.com/sonarr/custom-scripts
+    ev := getenv("sonarr_eventtype")
+    switch ev {
+    case "":
+      return hookJob{}, errors.New("sonarr_eventtype not set; is this running from Sonarr?")
+    case "Download":
+    default:
+      return hookJob{Skip: "sonarr event " + ev}, nil
+    }
+    return hookJob{
+      Path: getenv("sonarr_episodefile_path"),
+      Name: getenv("sonarr_episodefile_scenename"),
+      Show: getenv("sonarr_series_title"),
+    }, nil
+
+  case "qbittorrent", "qbit":
+    // Arguments as configured in qBittorrent: "%F" content path, "%L" category, "%N" torrent name
+    if len(args) == 0 { return hookJob{}, errors.New(`qbittorrent needs "%F" [ "%L" "%N" ] as arguments`) }
+    job := hookJob{Path: args[0]}
+    if len(args) > 1 { job.Category = args[1] }
+    if len(args) > 2 { job.Name = args[2] }
+    return job, nil
+
+  case "sabnzbd", "sab":
+    // https://sabnzbd.org/wiki/configuration/4.3/scripts/post-processing-scripts
+    // Environment first; the positional arguments are the older contract
+    arg := func(i int) string {
+      if i < len(args) { return args[i] }
+      return ""
+    }
+    job := hookJob{Path: getenv("SAB_COMPLETE_DIR"), Name: getenv("SAB_FINAL_NAME"), Category: getenv("SAB_CAT")}
+    status := getenv("SAB_PP_STATUS")
+    if job.Path == "" { job.Path, job.Name, job.Category, status = arg(0), arg(2), arg(4), arg(6) }
+    if job.Path == "" { return hookJob{}, errors.New("SAB_COMPLETE_DIR not set; is this running from SABnzbd?") }
+    if status != "" && status != "0" { job.Skip = "download failed post-processing (status " + status + ")" }
+    return job, nil
+  }
+  return hookJob{}, fmt.Errorf("unknown hook client %q (want sonarr, qbittorrent or sabnzbd)", client)
+}
+
+func hookCategory(allowed []string, cat string) bool {
+  if len(allowed) == 0 { return true }
+  for _, a := range allowed {
+    if strings.EqualFold(strings.TrimSpace(a), cat) { return true }
+  }
+  return false
+}
+
+// hookApply renames the media files of one download. Safety rules: the path must be an
+// absolute, existing file or folder; samples are ignored; only items renaming or moving
+// those files are applied, never folder renames; existing targets are skipped by Apply.
+func hookApply(ctx context.Context, cfg *config.Config, job hookJob) (int, error) {
+  if job.Path == "" || !filepath.IsAbs(job.Path) {
+    return 0, fmt.Errorf("refusing relative or empty path %q", job.Path)
+  }
+  path := filepath.Clean(job.Path)
+  byDir, err := hookFiles(path)
+  if err != nil { return 0, err }
+  if len(byDir) == 0 { return 0, nil }
+
+  // Download folders carry release names, so search for what the client says the show is
+  show := job.Show
+  if show == "" { show = parse.ShowName(job.Name) }
+  if show == "" { show = parse.ShowName(filepath.Base(path)) }
+
+  cfg.CLI.Yes = true
+  cfg.CLI.Show = show
+  cfg.CLI.Root = path
+  if err := cfg.Validate(); err != nil { return 0, err }
+  log := newLogger(cfg)
+  client, err := newClient(cfg, log)
+  if err != nil { return 0, err }
+  rn := runner.New(cfg, log, client)
+
+  dirs := make([]string, 0, len(byDir))
+  for d := range byDir { dirs = append(dirs, d) }
+  sort.Strings(dirs)
+
+  done, failed := 0, 0
+  for _, dir := range dirs {
+    plan, _, err := rn.Plan(ctx, dir)
+    if errors.Is(err, runner.ErrNothingToRename) { continue }
+    if err != nil { return done, err }
+
+    var items []planner.Item
+    for _, it := range plan.Items {
+      if byDir[dir][it.From] && (it.Reason == "rename" || it.Reason == "move") { items = append(items, it) }
+    }
+    if len(items) == 0 { continue }
+    rn.PrintPreview(planner.Plan{Items: items}, true)
+    res := rn.Apply(ctx, planner.Plan{Items: items})
+    done += res.Done
+    failed += res.Errors
+    if ctx.Err() != nil { return done, ctx.Err() }
+  }
+  if failed > 0 { return done, fmt.Errorf("%d rename(s) failed, %d done", failed, done) }
+  return done, nil
+}
+
+// hookFiles lists the media files a download consists of, keyed by folder
+func hookFiles(path string) (map[string]map[string]bool, error) {
+  st, err := os.Stat(path)
+  if err != nil { return nil, err }
+  out := map[string]map[string]bool{}
+  add := func(p string) {
+    name := filepath.Base(p)
+    if !runner.IsMedia(name) || strings.Contains(strings.ToLower(name), "sample") { return }
+    d := filepath.Dir(p)
+    if out[d] == nil { out[d] = map[string]bool{} }
+    out[d][p] = true
+  }
+  if !st.IsDir() {
+    add(path)
+    return out, nil
+  }
+  err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+    if err != nil { return err }
+    if d.IsDir() && p != path && strings.EqualFold(d.Name(), "sample") { return filepath.SkipDir }
+    if !d.IsDir() { add(p) }
+    return nil
+  })
+  return out, err
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+  "bufio"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+// fixtureEnv reads a tests/hooks env file as the client would set it, with $FIXTURES
+// pointing at fixtures
+func fixtureEnv(t *testing.T, name, fixtures string) map[string]string {
+  t.Helper()
+  f, err := os.Open(filepath.Join("..", "..", "tests", "hooks", name))
+  if err != nil { t.Fatal(err) }
+  defer f.Close()
+  env := map[string]string{}
+  sc := bufio.NewScanner(f)
+  for sc.Scan() {
+    line := strings.TrimSpace(sc.Text())
+    k, v, ok := strings.Cut(line, "=")
+    if !ok || strings.HasPrefix(line, "#") { continue }
+    env[k] = strings.ReplaceAll(strings.Trim(v, `"`), "$FIXTURES", fixtures)
+  }
+  if err := sc.Err(); err != nil { t.Fatal(err) }
+  return env
+}
+
+func TestReadHookJob(t *testing.T) {
+  const fx = "/fixtures"
+  tests := []struct {
+    file   string
+    client string
+    args   []string // env keys passed as arguments, as the client's command line does
+    want   hookJob
+  }{
+    {"sonarr-download.env", "sonarr", nil, hookJob{
+      Path: fx + "/Firefly/Season 1/Firefly.S01E03.1080p.WEB-DL.mkv",
+      Name: "Firefly.S01E03.1080p.WEB-DL",
+      Show: "Firefly",
+    }},
+    {"sonarr-test.env", "sonarr", nil, hookJob{Skip: "sonarr event Test"}},
+    {"qbittorrent.env", "qbittorrent", []string{"F", "L", "N"}, hookJob{
+      Path:     fx + "/downloads/Firefly.S01.1080p.WEB-DL",
+      Category: "tv",
+      Name:     "Firefly.S01.1080p.WEB-DL",
+    }},
+    {"sabnzbd.env", "sabnzbd", nil, hookJob{
+      Path:     fx + "/downloads/Firefly.S01.1080p.WEB-DL",
+      Category: "tv",
+      Name:     "Firefly.S01.1080p.WEB-DL",
+    }},
+    {"sabnzbd-failed.env", "sabnzbd", nil, hookJob{
+      Path:     fx + "/downloads/_FAILED_Firefly.S01.1080p.WEB-DL",
+      Category: "tv",
+      Name:     "Firefly.S01.1080p.WEB-DL",
+      Skip:     "download failed post-processing (status 1)",
+    }},
+  }
+  for _, tt := range tests {
+    t.Run(tt.file, func(t *testing.T) {
+      env := fixtureEnv(t, tt.file, fx)
+      var args []string
+      for _, k := range tt.args { args = append(args, env[k]) }
+      got, err := readHookJob(tt.client, args, func(k string) string { return env[k] })
+      if err != nil { t.Fatal(err) }
+      if got != tt.want { t.Errorf("got %+v\nwant %+v", got, tt.want) }
+    })
+  }
+}
+
+func TestReadHookJobNotFromClient(t *testing.T) {
+  none := func(string) string { return "" }
+  for _, client := range []string{"sonarr", "qbittorrent", "sabnzbd", "nzbget"} {
+    if _, err := readHookJob(client, nil, none); err == nil { t.Errorf("%s: want an error with no contract set", client) }
+  }
+}
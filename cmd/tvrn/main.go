@@ -2,8 +2,11 @@ package main
 
 import (
   "context"
+  "encoding/json"
+  "errors"
   "flag"
   "fmt"
+  "io"
   "os"
   "path/filepath"
   "strings"
@@ -12,7 +15,9 @@ import (
   "github.com/GizzmoShifu/tvrn/internal/cache"
   "github.com/GizzmoShifu/tvrn/internal/config"
   "github.com/GizzmoShifu/tvrn/internal/logx"
+  "github.com/GizzmoShifu/tvrn/internal/planner"
   "github.com/GizzmoShifu/tvrn/internal/runner"
+  "github.com/GizzmoShifu/tvrn/internal/tui"
   "github.com/GizzmoShifu/tvrn/internal/tvdb"
 )
 
@@ -23,9 +28,27 @@ var (
 )
 
 func main() {
+  defer closeCache()
   cfg, err := config.Load()
   if err != nil { fatal(err) }
 
+  // Subcommands
+  if len(os.Args) > 1 && os.Args[1] == "cache" {
+    if err := runCache(cfg, os.Args[2:]); err != nil { fatal(err) }
+    return
+  }
+  if len(os.Args) > 1 && os.Args[1] == "hook" {
+    exit(runHook(cfg, os.Args[2:]))
+  }
+  if len(os.Args) > 1 && os.Args[1] == "serve" {
+    if err := runServe(cfg, os.Args[2:]); err != nil { fatal(err) }
+    return
+  }
+  if len(os.Args) > 1 && os.Args[1] == "watch" {
+    if err := runWatch(cfg, os.Args[2:]); err != nil { fatal(err) }
+    return
+  }
+
   // Flags
   fs := flag.NewFlagSet("tvrn", flag.ContinueOnError)
   fs.SetOutput(os.Stdout)
@@ -33,20 +56,32 @@ func main() {
   root := fs.String("root", "", "Root directory to operate on (defaults to current directory)")
   scheme := fs.String("scheme", "", "Episode number format: SXXEYY | sXXeYY | XxYY | XYY | YY")
   pad := fs.Int("pad", 0, "Pad episode number to N digits (default 2)")
-  order := fs.String("order", "", "Episode order: aired | dvd | absolute | alternate | regional")
+  provider := fs.String("provider", "", "Metadata provider: tvdb | tmdb | tvmaze")
+  fallback := fs.String("fallback", "", "Comma-separated providers consulted for missing titles, e.g. tmdb,tvmaze")
+  order := fs.String("order", "", "Episode order: aired | dvd | absolute | alternate | regional | auto")
   lang := fs.String("lang", "", "Language code for titles, e.g. en")
   multi := fs.String("multi", "", "Multi-episode naming: range | join")
-  season := fs.Int("season", 0, "Force season number when parsing")
+  season := fs.Int("season", 0, "Season of the folder, overriding its name, any pin and the file names")
   detailed := fs.Bool("detailed", false, "Show before -> after in the proposal")
   debug := fs.Bool("debug", false, "Enable debug logging and verbose matching output")
   seriesMode := fs.Bool("series", false, "Run from a series root and process all season subfolders")
   noCache := fs.Bool("no-cache", false, "Ignore local API cache for this run")
+  offline := fs.Bool("offline", false, "Never touch the network; serve metadata from the local cache only")
+  metadata := fs.String("metadata", "", "Load episodes from a hand-written JSON or CSV file instead of a provider")
+  record := fs.String("record", "", "Save provider requests and responses, credentials stripped, into this folder")
+  replay := fs.String("replay", "", "Answer provider requests from a folder saved with --record, never the network")
+  var explain explainFlag
+  fs.Var(&explain, "explain", "Trace how each file was matched; --explain=json prints the trace and applies nothing")
+  folders := fs.Bool("folders", false, "Also rename series and season folders to TVDB's canonical names")
+  undo := fs.Bool("undo", false, "Revert the most recent applied run")
   yes := fs.Bool("yes", false, "Auto-confirm (non-interactive)")
+  plain := fs.Bool("plain", false, "Confirm with a plain prompt instead of the full-screen editor")
+  interactive := fs.Bool("interactive", false, "Ask about each change in turn (y/n/a/q/e), resuming a stopped run")
   about := fs.Bool("about", false, "Show credits and licensing notices and exit")
   ver := fs.Bool("version", false, "Show version and exit")
 
   fs.Usage = func() {
-    fmt.Fprintf(os.Stdout, "tvrn - TV renamer using TVDB v4\n\nUsage:\n  tvrn [options] [path]\n\nOptions:\n")
+    fmt.Fprintf(os.Stdout, "tvrn - TV renamer using TVDB v4, TMDB or TVmaze\n\nUsage:\n  tvrn [options] [path]\n  tvrn cache ls|stats|purge|prune|warm\n  tvrn watch [options] <root>\n  tvrn hook sonarr|qbittorrent|sabnzbd\n  tvrn serve [--addr host:port] [--token T]\n\nOptions:\n")
     fs.PrintDefaults()
     fmt.Fprintln(os.Stdout, `
 Examples:
@@ -60,12 +95,37 @@ Examples:
   tvrn --scheme=SXXEYY --pad=3
 
   # Use DVD order and show before->after
-  tvrn --order=dvd --detailed`)
+  tvrn --order=dvd --detailed
+
+  # Not sure whether the files are in aired or DVD order
+  tvrn --order=auto --explain
+
+  # Use TVmaze instead of TVDB (no key needed)
+  tvrn --provider=tvmaze
+
+  # Fill missing TVDB titles from TMDB, then TVmaze
+  tvrn --fallback=tmdb,tvmaze
+
+  # No network: use what earlier runs cached, or a hand-written episode list
+  tvrn --offline
+  tvrn --metadata=episodes.csv
+
+  # Capture a run's API traffic for a bug report, then reproduce it offline
+  tvrn --record=./bundle
+  tvrn --replay=./bundle
+
+  # Why was a file skipped or matched to the wrong episode?
+  tvrn --explain
+  tvrn --explain=json > trace.json
+
+  # Also rename the series and season folders, then revert it
+  tvrn --series --folders
+  tvrn --undo`)
   }
 
   // Allow positional [path]
   if err := fs.Parse(os.Args[1:]); err != nil {
-    if err == flag.ErrHelp { os.Exit(0) }
+    if err == flag.ErrHelp { exit(0) }
     fatal(err)
   }
   pathArg := "."
@@ -80,14 +140,28 @@ Examples:
   // Merge flags into config
   if *scheme != "" { cfg.Rename.Scheme = *scheme }
   if *pad > 0 { cfg.Rename.Pad = *pad }
+  if *provider != "" { cfg.Defaults.Provider = strings.ToLower(*provider) }
+  if *fallback != "" { cfg.Defaults.Fallback = strings.Split(strings.ToLower(*fallback), ",") }
   if *order != "" { cfg.Defaults.Order = strings.ToLower(*order) }
   if *lang != "" { cfg.Defaults.Lang = *lang }
   if *multi != "" { cfg.Rename.MultiEP = strings.ToLower(*multi) }
-  cfg.CLI.Season = *season
+  if *folders { cfg.Rename.Folders = true }
+  fs.Visit(func(f *flag.Flag) {
+    if f.Name == "season" { cfg.CLI.Season = season }
+  })
   cfg.CLI.Detailed = *detailed
   cfg.CLI.Debug = *debug
   cfg.CLI.NoCache = *noCache
+  cfg.CLI.Offline = *offline
+  cfg.CLI.Metadata = *metadata
+  cfg.CLI.Record = *record
+  cfg.CLI.Replay = *replay
+  cfg.CLI.Explain = string(explain)
   cfg.CLI.Yes = *yes
+  cfg.CLI.Plain = *plain
+  cfg.CLI.Interactive = *interactive
+  cfg.CLI.Series = *seriesMode
+  cfg.CLI.Undo = *undo
   cfg.CLI.Root = absRoot
 
   if *about {
@@ -100,38 +174,46 @@ Examples:
     return
   }
 
-  // Logging
-  level := "info"
-  if cfg.CLI.Debug { level = "debug" }
-  log := logx.New(level)
+  log := newLogger(cfg)
   log.Infof("tvrn starting in %s", absRoot)
 
-  // TVDB client with optional cache
-  var client tvdb.Client
-  httpc := tvdb.NewHTTP("", cfg.Auth.APIKey, cfg.Auth.PIN)
-  if !cfg.CLI.NoCache {
-    httpc = httpc.WithCache(cache.NewFS(cfg.Home))
-  }
-  client = httpc
+  if err := cfg.Validate(); err != nil { fatal(err) }
+
+  client, err := newClient(cfg, log)
+  if err != nil { fatal(err) }
 
   rn := runner.New(cfg, log, client)
+  interrupt = trapInterrupts()
+
+  if cfg.CLI.Undo {
+    plan, err := rn.PlanUndo()
+    if err != nil { fatal(err) }
+    applyPlan(rn, plan, "")
+    return
+  }
 
   // Series mode: discover season subfolders and process them serially
   if *seriesMode {
-    // Simple heuristic: dirs named "Season *" or "Specials"
+    // Season folders: "Season 1", "S01", "Series 2", "Specials"
     entries, err := os.ReadDir(absRoot)
     if err != nil { fatal(err) }
     total := 0
     for _, e := range entries {
       if !e.IsDir() { continue }
       name := e.Name()
-      lower := strings.ToLower(name)
-      if strings.HasPrefix(lower, "season ") || lower == "specials" {
+      if runner.IsSeasonDir(name) {
         ok := runOnce(rn, filepath.Join(absRoot, name))
         if ok { total++ }
       }
     }
     if total == 0 { fmt.Println("No season folders found") }
+
+    // The series folder itself is renamed once, after all its seasons
+    if cfg.CLI.Explain == "json" { return }
+    plan, err := rn.PlanSeriesFolder(interrupt.ctx, absRoot)
+    if errors.Is(err, context.Canceled) { stopped(absRoot) }
+    if err != nil { fatal(err) }
+    if len(plan.Items) > 0 { applyPlan(rn, plan, "") }
     return
   }
 
@@ -140,44 +222,258 @@ Examples:
 }
 
 func runOnce(rn *runner.Runner, dir string) bool {
-  ctx := context.Background()
-  plan, stats, err := rn.Plan(ctx, dir)
-  if err != nil { fatal(err) }
-
-  if stats.Total == 0 {
+  plan, _, err := rn.Plan(interrupt.ctx, dir)
+  if errors.Is(err, context.Canceled) { stopped(dir) }
+  // --order auto asks when the orders score too close; the answer is pinned, so plan again
+  var oe *runner.OrderError
+  if errors.As(err, &oe) && !rn.Cfg().CLI.Yes && rn.Cfg().CLI.Explain != "json" {
+    var (
+      order string
+      perr  error
+    )
+    interrupt.prompt(func() { order, perr = rn.ChooseOrder(os.Stdin, os.Stdout, oe) })
+    if perr != nil { fatal(perr) }
+    if order == "" {
+      fmt.Println("Cancelled")
+      exit(3)
+    }
+    plan, _, err = rn.Plan(interrupt.ctx, dir)
+    if errors.Is(err, context.Canceled) { stopped(dir) }
+  }
+  if explained(rn, plan, err) {
+    // the JSON trace carries the error too, but a folder that failed to plan still fails the run
+    if err != nil && !errors.Is(err, runner.ErrNothingToRename) { fatal(err) }
+    return true
+  }
+  if errors.Is(err, tvdb.ErrUnavailable) {
+    // the provider is down: stop instead of failing every remaining folder in turn
+    fatal(fmt.Errorf("%w\nStopped at %s; folders already renamed are kept", err, dir))
+  }
+  // an up-to-date season is not an error: a --series run carries on to the next
+  if errors.Is(err, runner.ErrNothingToRename) {
     fmt.Println("No changes needed")
     return false
   }
+  if err != nil { fatal(err) }
 
-  rn.PrintPreview(plan, rn.Cfg().CLI.Detailed)
+  applyPlan(rn, plan, dir)
+  return true
+}
 
-  proceed := rn.Cfg().CLI.Yes
-  if !proceed {
-    var cerr error
-    proceed, cerr = rn.Confirm(os.Stdin, os.Stdout, stats.Total)
-    if cerr != nil { fatal(cerr) }
+// applyPlan previews, confirms and applies a plan, exiting on cancel or failure.
+// On a capable terminal the plan is reviewed full screen; dir, when set, lets the
+// review search for another series and plan that folder again.
+func applyPlan(rn *runner.Runner, plan planner.Plan, dir string) {
+  if len(plan.Items) == 0 {
+    fmt.Println("No changes needed")
+    return
   }
-  if !proceed {
-    fmt.Println("Cancelled")
-    os.Exit(3)
+  cfg := rn.Cfg()
+
+  // Per-item answers are kept under the folder, so a cancelled run resumes where it stopped
+  key := dir
+  if key == "" { key = filepath.Dir(plan.Items[0].From) }
+  if plan.Undo != "" { key = "undo:" + plan.Undo }
+
+  if !cfg.CLI.Yes && cfg.CLI.Interactive {
+    var (
+      chosen planner.Plan
+      done   bool
+      err    error
+    )
+    interrupt.prompt(func() { chosen, done, err = rn.ConfirmEach(os.Stdin, os.Stdout, plan, key) })
+    if err != nil { fatal(err) }
+    if !done {
+      fmt.Println("Stopped; run again with --interactive to carry on from here")
+      exit(3)
+    }
+    plan = chosen
+    if len(plan.Items) == 0 {
+      _ = rn.ForgetAnswers(key)
+      fmt.Println("Nothing to apply")
+      return
+    }
+  } else if !cfg.CLI.Yes && !cfg.CLI.Plain && tui.Supported(os.Stdin, os.Stdout) {
+    act := tui.Actions{
+      Strict: cfg.Defaults.ConfirmationStrict,
+      Renumber: func(p planner.Plan, it planner.Item, season int, eps []int) (planner.Item, error) {
+        return rn.Renumber(interrupt.ctx, p, it, season, eps)
+      },
+    }
+    if dir != "" {
+      act.Research = func(name string) (planner.Plan, error) {
+        cfg.CLI.Show = name
+        p, _, err := rn.Plan(interrupt.ctx, dir)
+        return p, err
+      }
+    }
+    chosen, err := tui.Review(os.Stdin, os.Stdout, plan, act)
+    if errors.Is(err, tui.ErrCancelled) {
+      fmt.Println("Cancelled")
+      exit(3)
+    }
+    if err != nil { fatal(err) }
+    plan = chosen
+    rn.PrintPreview(plan, true)
+  } else {
+    rn.PrintPreview(plan, cfg.CLI.Detailed)
+    proceed := cfg.CLI.Yes
+    if !proceed {
+      var cerr error
+      interrupt.prompt(func() { proceed, cerr = rn.Confirm(os.Stdin, os.Stdout, len(plan.Items)) })
+      if cerr != nil { fatal(cerr) }
+    }
+    if !proceed {
+      fmt.Println("Cancelled")
+      exit(3)
+    }
   }
 
-  res := rn.Apply(ctx, plan)
+  res := rn.Apply(interrupt.ctx, plan)
   rn.Report(res)
+  if res.Interrupted() { exit(exitInterrupted) } // answers are kept for the rest
+  if cfg.CLI.Interactive { _ = rn.ForgetAnswers(key) }
 
   if res.Errors > 0 && res.Errors < res.Total {
-    os.Exit(2)
+    exit(2)
   }
   if res.Errors > 0 {
-    os.Exit(4)
+    exit(4)
   }
-  return true
+}
+
+// newLogger opens the configured logger, at debug level with --debug. A log file that
+// can't be opened is reported and left out rather than stopping the run.
+func newLogger(cfg *config.Config) *logx.Logger {
+  o := logx.Options{Level: cfg.Log.Level, Format: cfg.Log.Format, MaxMB: cfg.Log.MaxMB, Keep: cfg.Log.Keep}
+  if cfg.CLI.Debug { o.Level = "debug" }
+  if cfg.Log.File { o.Dir = filepath.Join(cfg.Home, "logs") }
+  log, err := logx.Open(o)
+  if err != nil {
+    o.Dir = ""
+    log, _ = logx.Open(o)
+    log.Warnf("log file: %v", err)
+  }
+  return log
+}
+
+// newClient builds the configured provider chain behind the local cache,
+// or the hand-written metadata file when one is given
+func newClient(cfg *config.Config, log *logx.Logger) (tvdb.Client, error) {
+  if cfg.CLI.Metadata != "" { return tvdb.NewLocal(cfg.CLI.Metadata) }
+
+  opts := tvdb.Options{
+    TVDBKey: cfg.Auth.APIKey, TVDBPIN: cfg.Auth.PIN, TMDBKey: cfg.Auth.TMDBKey,
+    Offline: cfg.CLI.Offline, Home: cfg.Home, Log: log,
+    TTL: tvdb.TTLs{
+      Episodes: time.Duration(cfg.Cache.EpisodesTTLHours) * time.Hour,
+      Series:   time.Duration(cfg.Cache.SeriesTTLDays) * 24 * time.Hour,
+      Search:   time.Duration(cfg.Cache.SearchTTLDays) * 24 * time.Hour,
+    },
+    Retry: tvdb.RetryPolicy{
+      Attempts:        cfg.Network.Retries,
+      BaseDelay:       time.Duration(cfg.Network.BackoffMS) * time.Millisecond,
+      MaxDelay:        time.Duration(cfg.Network.MaxBackoffSeconds) * time.Second,
+      BreakerFailures: cfg.Network.BreakerFailures,
+      BreakerCooldown: time.Duration(cfg.Network.BreakerCooldownSeconds) * time.Second,
+    },
+  }
+  // recording and replaying must see every request, so they bypass the cache and saved logins
+  if cfg.CLI.Record != "" || cfg.CLI.Replay != "" { opts.Home = "" }
+  switch {
+  case cfg.CLI.Record != "":
+    rec, err := tvdb.NewRecorder(cfg.CLI.Record)
+    if err != nil { return nil, err }
+    opts.Transport = rec
+  case cfg.CLI.Replay != "":
+    rep, err := tvdb.NewReplayer(cfg.CLI.Replay)
+    if err != nil { return nil, err }
+    opts.Transport = rep
+    // the bundle's credentials were stripped; any key gets past the clients' checks
+    if opts.TVDBKey == "" { opts.TVDBKey = "replay" }
+    if opts.TMDBKey == "" { opts.TMDBKey = "replay" }
+  case !cfg.CLI.NoCache:
+    store, err := openCache(cfg)
+    if err != nil { return nil, err }
+    opts.Cache = store
+  }
+  return tvdb.ProviderChain(cfg.Providers(), opts)
+}
+
+// openCache opens the configured cache backend once per process
+func openCache(cfg *config.Config) (cache.Store, error) {
+  if sharedCache == nil {
+    s, err := cache.Open(cfg.Home, cfg.Cache.Backend, cfg.Cache.MaxMB)
+    if err != nil { return nil, err }
+    sharedCache = s
+  }
+  return sharedCache, nil
+}
+
+var sharedCache cache.Store
+
+// closeCache writes out what the cache still holds in memory, such as the batched hit
+// counts, and lets the next openCache open it afresh
+func closeCache() {
+  if c, ok := sharedCache.(io.Closer); ok {
+    if err := c.Close(); err != nil { fmt.Fprintf(os.Stderr, "warning: cache: %v\n", err) }
+  }
+  sharedCache = nil
+}
+
+// interrupt carries Ctrl-C into planning and applying; set once the runner is built
+var interrupt *interrupts
+
+// explainFlag is --explain, which is a switch for the text trace or takes =json
+type explainFlag string
+
+func (e *explainFlag) String() string   { return string(*e) }
+func (e *explainFlag) IsBoolFlag() bool { return true }
+
+func (e *explainFlag) Set(v string) error {
+  switch strings.ToLower(v) {
+  case "true", "text": *e = "text"
+  case "false": *e = ""
+  case "json": *e = "json"
+  default: return fmt.Errorf("want text or json")
+  }
+  return nil
+}
+
+// explained prints the --explain trace for a planned folder and reports whether the run
+// should stop there: --explain=json only prints, one JSON document per folder
+func explained(rn *runner.Runner, plan planner.Plan, err error) bool {
+  ex := plan.Explain
+  if ex == nil { return false }
+  switch rn.Cfg().CLI.Explain {
+  case "text":
+    runner.PrintExplain(os.Stdout, ex)
+  case "json":
+    if err != nil { ex.Error = err.Error() }
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    if err := enc.Encode(ex); err != nil { fatal(err) }
+    return true
+  }
+  return false
+}
+
+// stopped exits after Ctrl-C cancelled planning dir, before anything in it was renamed
+func stopped(dir string) {
+  fmt.Printf("Interrupted while planning %s; nothing there was renamed\n", dir)
+  exit(exitInterrupted)
 }
 
 func fatal(err error) {
   fmt.Fprintf(os.Stderr, "error: %v\n", err)
   time.Sleep(10 * time.Millisecond)
-  os.Exit(4)
+  exit(4)
+}
+
+// exit closes the cache, which os.Exit would skip, and exits with code
+func exit(code int) {
+  closeCache()
+  os.Exit(code)
 }
 
 func printAbout() {
@@ -187,6 +483,10 @@ Credits & Notices
   • Metadata provided by TheTVDB.com (v4 API)
   • This product is not endorsed or certified by TheTVDB
   • https://thetvdb.com
+  • With --provider=tmdb: this product uses the TMDB API but is not endorsed or certified by TMDB
+    https://www.themoviedb.org
+  • With --provider=tvmaze: data from TVmaze, licensed CC BY-SA
+    https://www.tvmaze.com
 
 Licences
   • Project licence: MIT (see LICENSE)
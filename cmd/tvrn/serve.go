@@ -0,0 +1,88 @@
+package main
+
+import (
+  "context"
+  "errors"
+  "flag"
+  "fmt"
+  "net"
+  "net/http"
+  "os"
+  "os/signal"
+  "path/filepath"
+  "syscall"
+
+  "github.com/GizzmoShifu/tvrn/internal/config"
+  "github.com/GizzmoShifu/tvrn/internal/runner"
+  "github.com/GizzmoShifu/tvrn/internal/server"
+  "github.com/GizzmoShifu/tvrn/internal/state"
+)
+
+const serveUsage = `Usage:
+  tvrn serve [--addr host:port] [--token T] [--root DIR]
+
+Serves a web UI and REST API for planning, reviewing and applying renames:
+  POST  /api/plans                  {"path": "..."} plan a folder
+  GET   /api/plans/{id}             the plan and which items are selected
+  PATCH /api/plans/{id}/items/{n}   {"enabled": false} leave an item out
+  POST  /api/plans/{id}/apply       apply the selected items
+  POST  /api/undo                   revert the most recent run
+  GET   /api/journal                applied runs, newest first
+
+Listens on localhost unless --addr says otherwise. Every API call needs the token:
+--token, serve.token or TVRN_TOKEN, else one generated on first run and kept in
+~/.tvrn/state/serve_token. Only folders inside --root, by default the folder
+tvrn serve starts in, can be planned.`
+
+// runServe handles `tvrn serve ...`
+func runServe(cfg *config.Config, args []string) error {
+  defer closeCache()
+  fs := flag.NewFlagSet("tvrn serve", flag.ContinueOnError)
+  fs.SetOutput(os.Stdout)
+  fs.Usage = func() { fmt.Println(serveUsage) }
+  addr := fs.String("addr", cfg.Serve.Addr, "Listen address")
+  token := fs.String("token", cfg.Serve.Token, "Bearer token required on API calls (or TVRN_TOKEN)")
+  root := fs.String("root", cfg.Serve.Root, "Only allow planning folders inside this one (default: the current folder)")
+  debug := fs.Bool("debug", false, "Enable debug logging")
+  if err := fs.Parse(args); err != nil {
+    if err == flag.ErrHelp { return nil }
+    return err
+  }
+
+  if _, _, err := net.SplitHostPort(*addr); err != nil { return err }
+  if *root == "" { *root = "." }
+  dir, err := filepath.Abs(*root)
+  if err != nil { return err }
+  if st, err := os.Stat(dir); err != nil || !st.IsDir() { return fmt.Errorf("not a folder: %s", dir) }
+
+  // Without a token any page the browser opens could drive the API, so one is always set
+  link := ""
+  if *token == "" {
+    t, fresh, err := state.ServeToken(cfg.Home)
+    if err != nil { return fmt.Errorf("serve token: %w", err) }
+    *token, link = t, "#token="+t
+    if fresh { fmt.Printf("Generated an access token, kept in %s\n", filepath.Join(cfg.Home, "state", "serve_token")) }
+  }
+
+  cfg.CLI.Debug = *debug
+  cfg.CLI.Yes = true
+  if err := cfg.Validate(); err != nil { return err }
+  log := newLogger(cfg)
+  client, err := newClient(cfg, log)
+  if err != nil { return err }
+  rn := runner.New(cfg, log, client)
+
+  srv := server.New(cfg, rn, *token, dir, *addr)
+  hs := &http.Server{Addr: *addr, Handler: srv.Handler()}
+  // Stop on SIGINT or SIGTERM after the requests in hand, so the cache is closed cleanly
+  ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+  defer stop()
+  go func() {
+    <-ctx.Done()
+    log.Infof("stopping")
+    _ = hs.Shutdown(context.Background())
+  }()
+  fmt.Printf("Serving %s on http://%s/%s\n", dir, *addr, link)
+  if err := hs.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) { return err }
+  return nil
+}
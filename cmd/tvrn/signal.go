@@ -0,0 +1,46 @@
+package main
+
+import (
+  "context"
+  "fmt"
+  "os"
+  "os/signal"
+  "sync/atomic"
+  "syscall"
+)
+
+// exitInterrupted is the exit code after Ctrl-C, as shells report for SIGINT
+const exitInterrupted = 130
+
+// interrupts turns the first SIGINT or SIGTERM into a cancelled context, so lookups stop
+// and an apply stops after the file in hand. A second signal quits at once, as does one
+// that arrives while a prompt is waiting and nothing is in flight.
+type interrupts struct {
+  ctx       context.Context
+  prompting atomic.Bool
+}
+
+func trapInterrupts() *interrupts {
+  ctx, cancel := context.WithCancel(context.Background())
+  it := &interrupts{ctx: ctx}
+  sigs := make(chan os.Signal, 2)
+  signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+  go func() {
+    for range sigs {
+      if it.prompting.Load() || ctx.Err() != nil {
+        fmt.Fprintln(os.Stderr, "\nInterrupted")
+        os.Exit(exitInterrupted)
+      }
+      fmt.Fprintln(os.Stderr, "\nStopping; Ctrl-C again to quit now")
+      cancel()
+    }
+  }()
+  return it
+}
+
+// prompt runs f, which waits on the user, with Ctrl-C quitting straight away
+func (it *interrupts) prompt(f func()) {
+  it.prompting.Store(true)
+  defer it.prompting.Store(false)
+  f()
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+  "context"
+  "errors"
+  "flag"
+  "fmt"
+  "io/fs"
+  "os"
+  "os/signal"
+  "path/filepath"
+  "sort"
+  "strings"
+  "sync"
+  "syscall"
+  "time"
+
+  "github.com/fsnotify/fsnotify"
+
+  "github.com/GizzmoShifu/tvrn/internal/config"
+  "github.com/GizzmoShifu/tvrn/internal/logx"
+  "github.com/GizzmoShifu/tvrn/internal/planner"
+  "github.com/GizzmoShifu/tvrn/internal/runner"
+)
+
+const watchUsage = `Usage:
+  tvrn watch [--policy files|all|dry-run] [--settle N] [--provider P] [--debug] <root>
+
+Watches root and every folder below it. A new media file is renamed once it has
+stopped growing for the settle time. Changes are journaled, so --undo reverts the
+latest batch. SIGHUP reloads the config file.
+
+Policies:
+  files    rename and move new files only; folders are left alone (default)
+  all      also rename the folders, once nothing inside them is still arriving
+  dry-run  log what would change and touch nothing`
+
+const (
+  watchTick      = time.Second
+  watchQuiet     = 2 * time.Second // no events for this long before a file is checked
+  watchOwnIgnore = time.Minute     // events for paths we just renamed to are ours
+)
+
+// pendingFile is a media file seen arriving, waiting to stop growing
+type pendingFile struct {
+  size      int64
+  lastEvent time.Time
+  stable    time.Time // when size last changed
+}
+
+type watcher struct {
+  root    string
+  flags   func(*config.Config) // re-applies command-line overrides after a reload
+  cfg     *config.Config
+  log     *logx.Logger
+  logs    *logUse // who still writes to log
+  rn      *runner.Runner
+  fw      *fsnotify.Watcher
+  pending map[string]*pendingFile
+  ours    map[string]time.Time
+}
+
+// logUse counts the runs writing to a logger, so one replaced by a reload is closed only
+// once the last of them is done
+type logUse struct {
+  log     *logx.Logger
+  mu      sync.Mutex
+  runs    int
+  retired bool
+}
+
+func (u *logUse) hold() {
+  u.mu.Lock()
+  u.runs++
+  u.mu.Unlock()
+}
+
+func (u *logUse) release() {
+  u.mu.Lock()
+  defer u.mu.Unlock()
+  u.runs--
+  if u.retired && u.runs == 0 { u.log.Close() }
+}
+
+// retire closes the logger now if nothing writes to it, else when the last run releases it
+func (u *logUse) retire() {
+  u.mu.Lock()
+  defer u.mu.Unlock()
+  u.retired = true
+  if u.runs == 0 { u.log.Close() }
+}
+
+// runWatch handles `tvrn watch ...`
+func runWatch(cfg *config.Config, args []string) error {
+  defer closeCache()
+  fset := flag.NewFlagSet("tvrn watch", flag.ContinueOnError)
+  fset.SetOutput(os.Stdout)
+  fset.Usage = func() { fmt.Println(watchUsage) }
+  policy := fset.String("policy", "", "What to apply: files | all | dry-run")
+  settle := fset.Int("settle", 0, "Seconds a file must stop growing before it is renamed")
+  provider := fset.String("provider", "", "Metadata provider: tvdb | tmdb | tvmaze")
+  debug := fset.Bool("debug", false, "Enable debug logging")
+  if err := fset.Parse(args); err != nil {
+    if err == flag.ErrHelp { return nil }
+    return err
+  }
+  if fset.NArg() != 1 {
+    fmt.Println(watchUsage)
+    return errors.New("watch needs exactly one root folder")
+  }
+  root, err := filepath.Abs(fset.Arg(0))
+  if err != nil { return err }
+  if st, err := os.Stat(root); err != nil || !st.IsDir() { return fmt.Errorf("not a folder: %s", root) }
+
+  w := &watcher{root: root, pending: map[string]*pendingFile{}, ours: map[string]time.Time{}}
+  w.flags = func(c *config.Config) {
+    if *policy != "" { c.Watch.Policy = strings.ToLower(*policy) }
+    if *settle > 0 { c.Watch.SettleSeconds = *settle }
+    if *provider != "" { c.Defaults.Provider = strings.ToLower(*provider) }
+    c.CLI.Debug = *debug
+    c.CLI.Yes = true
+    c.CLI.Root = root
+  }
+  if err := w.configure(cfg); err != nil { return err }
+  defer func() { w.logs.retire() }()
+
+  w.fw, err = fsnotify.NewWatcher()
+  if err != nil { return err }
+  defer w.fw.Close()
+  if err := w.addTree(root, false); err != nil { return err }
+
+  sigs := make(chan os.Signal, 1)
+  signal.Notify(sigs, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+  tick := time.NewTicker(watchTick)
+  defer tick.Stop()
+
+  w.log.Infof("watching %s (policy=%s, settle=%ds)", root, w.cfg.Watch.Policy, w.cfg.Watch.SettleSeconds)
+  for {
+    select {
+    case ev, ok := <-w.fw.Events:
+      if !ok { return nil }
+      w.event(ev)
+    case err, ok := <-w.fw.Errors:
+      if !ok { return nil }
+      w.log.Warnf("watch: %v", err)
+    case <-tick.C:
+      w.settle(time.Now())
+    case sig := <-sigs:
+      if sig != syscall.SIGHUP {
+        w.log.Infof("stopping on %v", sig)
+        return nil
+      }
+      fresh, err := config.Load()
+      if err == nil { err = w.configure(fresh) }
+      if err != nil {
+        w.log.Errorf("reload failed, keeping the previous config: %v", err)
+        continue
+      }
+      w.log.Infof("config reloaded (policy=%s, settle=%ds)", w.cfg.Watch.Policy, w.cfg.Watch.SettleSeconds)
+    }
+  }
+}
+
+// configure applies the command-line overrides to cfg and swaps in a runner built from it
+func (w *watcher) configure(cfg *config.Config) error {
+  w.flags(cfg)
+  switch cfg.Watch.Policy {
+  case "files", "all", "dry-run":
+  default:
+    return fmt.Errorf("unknown watch policy %q (want files, all or dry-run)", cfg.Watch.Policy)
+  }
+  if cfg.Watch.SettleSeconds <= 0 { cfg.Watch.SettleSeconds = 1 }
+  if err := cfg.Validate(); err != nil { return err }
+  if old := w.cfg; old != nil && (old.Home != cfg.Home || old.Cache.Backend != cfg.Cache.Backend || old.Cache.MaxMB != cfg.Cache.MaxMB) {
+    closeCache() // the client built below opens the cache as now configured
+  }
+  log := newLogger(cfg)
+  client, err := newClient(cfg, log)
+  if err != nil {
+    log.Close()
+    return err
+  }
+
+  if w.logs != nil { w.logs.retire() }
+  w.cfg = cfg
+  w.log = log
+  w.logs = &logUse{log: log}
+  w.rn = runner.New(cfg, w.log, client)
+  return nil
+}
+
+// addTree watches dir and every folder below it. With queue set, media files already
+// inside are queued too, so a season folder moved in whole is handled like new files.
+func (w *watcher) addTree(dir string, queue bool) error {
+  return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+    if err != nil { return nil }
+    if d.IsDir() {
+      if path != dir && strings.HasPrefix(d.Name(), ".") { return filepath.SkipDir }
+      if err := w.fw.Add(path); err != nil { return fmt.Errorf("watch %s: %w", path, err) }
+      return nil
+    }
+    if queue && runner.IsMedia(d.Name()) { w.touch(path) }
+    return nil
+  })
+}
+
+func (w *watcher) event(ev fsnotify.Event) {
+  if !ev.Has(fsnotify.Create) && !ev.Has(fsnotify.Write) { return }
+  if at, ok := w.ours[ev.Name]; ok && time.Since(at) < watchOwnIgnore { return }
+
+  if ev.Has(fsnotify.Create) {
+    if st, err := os.Stat(ev.Name); err == nil && st.IsDir() {
+      if err := w.addTree(ev.Name, true); err != nil { w.log.Warnf("%v", err) }
+      return
+    }
+  }
+  if runner.IsMedia(ev.Name) { w.touch(ev.Name) }
+}
+
+func (w *watcher) touch(path string) {
+  p := w.pending[path]
+  if p == nil {
+    p = &pendingFile{size: -1}
+    w.pending[path] = p
+    w.log.Debugf("new file: %s", path)
+  }
+  p.lastEvent = time.Now()
+}
+
+// settle hands every file that has stopped growing to process, grouped by folder
+func (w *watcher) settle(now time.Time) {
+  for path, at := range w.ours {
+    if now.Sub(at) >= watchOwnIgnore { delete(w.ours, path) }
+  }
+
+  wait := time.Duration(w.cfg.Watch.SettleSeconds) * time.Second
+  ready := map[string][]string{}
+  for path, p := range w.pending {
+    st, err := os.Stat(path)
+    if err != nil { // gone again, e.g. a temp file renamed by the downloader
+      delete(w.pending, path)
+      continue
+    }
+    if st.Size() != p.size {
+      p.size = st.Size()
+      p.stable = now
+      continue
+    }
+    if now.Sub(p.stable) < wait || now.Sub(p.lastEvent) < watchQuiet { continue }
+    delete(w.pending, path)
+    ready[filepath.Dir(path)] = append(ready[filepath.Dir(path)], path)
+  }
+
+  dirs := make([]string, 0, len(ready))
+  for d := range ready { dirs = append(dirs, d) }
+  sort.Strings(dirs)
+  for _, d := range dirs { w.process(d, ready[d]) }
+}
+
+// pick keeps the plan items the policy allows. Only settled files are renamed, whatever
+// the policy, as the others may still be downloading; under "all" a folder is renamed
+// too, but not while a file below it is still pending.
+func (w *watcher) pick(plan planner.Plan, files []string) []planner.Item {
+  settled := map[string]bool{}
+  for _, f := range files { settled[f] = true }
+  var items []planner.Item
+  for _, it := range plan.Items {
+    switch {
+    case it.Reason != "folder":
+      if settled[it.From] { items = append(items, it) }
+    case w.cfg.Watch.Policy == "all" && !w.pendingUnder(it.From):
+      items = append(items, it)
+    }
+  }
+  return items
+}
+
+// pendingUnder reports whether a file below dir is still waiting to settle
+func (w *watcher) pendingUnder(dir string) bool {
+  for path := range w.pending {
+    if strings.HasPrefix(path, dir+string(filepath.Separator)) { return true }
+  }
+  return false
+}
+
+// process plans the folder the settled files sit in and applies the part the policy allows
+func (w *watcher) process(dir string, files []string) {
+  // a reload swaps these; the run keeps the ones it started with, and their log stays open
+  rn, logs := w.rn, w.logs
+  logs.hold()
+  defer logs.release()
+  log := logs.log
+  plan, _, err := rn.Plan(context.Background(), dir)
+  if err != nil {
+    log.Warnf("%s: %v", dir, err)
+    return
+  }
+
+  items := w.pick(plan, files)
+  if len(items) == 0 {
+    log.Debugf("%s: nothing to do for %d new file(s)", dir, len(files))
+    return
+  }
+
+  if w.cfg.Watch.Policy == "dry-run" {
+    for _, it := range items { log.Infof("would %s: %s -> %s", it.Reason, it.From, it.To) }
+    return
+  }
+
+  rn.NewRun()
+  res := rn.Apply(context.Background(), planner.Plan{Items: items})
+  for _, it := range items {
+    if _, err := os.Stat(it.To); err != nil { continue }
+    w.ours[it.To] = time.Now()
+    log.Infof("%s: %s -> %s", it.Reason, it.From, it.To)
+    if it.Reason == "folder" { // watches follow the inode but report the old path
+      _ = w.fw.Remove(it.From)
+      if err := w.addTree(it.To, false); err != nil { log.Warnf("%v", err) }
+    }
+  }
+  log.Infof("%s: applied %d, errors %d", dir, res.Total, res.Errors)
+}
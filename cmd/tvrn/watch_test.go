@@ -0,0 +1,48 @@
+package main
+
+import (
+  "os"
+  "path/filepath"
+  "testing"
+  "time"
+
+  "github.com/fsnotify/fsnotify"
+
+  "github.com/GizzmoShifu/tvrn/internal/config/configtest"
+  "github.com/GizzmoShifu/tvrn/internal/logx"
+  "github.com/GizzmoShifu/tvrn/internal/runner"
+  "github.com/GizzmoShifu/tvrn/internal/tvdb"
+  "github.com/GizzmoShifu/tvrn/internal/tvdb/tvdbtest"
+)
+
+func TestWatchLeavesUnsettledFiles(t *testing.T) {
+  srv := tvdbtest.New(t)
+  cfg := configtest.New(t)
+  cfg.Rename.Folders = true
+  cfg.Watch.Policy = "all"
+
+  dir := filepath.Join(t.TempDir(), "Firefly", "Season 1")
+  if err := os.MkdirAll(dir, 0o755); err != nil { t.Fatal(err) }
+  done, arriving := filepath.Join(dir, "Firefly.S01E03.mkv"), filepath.Join(dir, "Firefly.S01E04.mkv")
+  for _, f := range []string{done, arriving} {
+    if err := os.WriteFile(f, nil, 0o644); err != nil { t.Fatal(err) }
+  }
+
+  fw, err := fsnotify.NewWatcher()
+  if err != nil { t.Fatal(err) }
+  defer fw.Close()
+  log := logx.New("error")
+  w := &watcher{cfg: cfg, log: log, logs: &logUse{log: log}, fw: fw, rn: runner.New(cfg, log, tvdb.NewHTTP(srv.URL, tvdbtest.APIKey, "")),
+    pending: map[string]*pendingFile{arriving: {size: -1}}, ours: map[string]time.Time{}}
+
+  // Only the settled file is renamed; the folder waits for the one still arriving
+  w.process(dir, []string{done})
+  if _, err := os.Stat(filepath.Join(dir, "1x03 - Our Mrs. Reynolds.mkv")); err != nil { t.Errorf("settled file not renamed: %v", err) }
+  if _, err := os.Stat(arriving); err != nil { t.Errorf("unsettled file touched: %v", err) }
+
+  // Once it settles, it and the folder follow
+  delete(w.pending, arriving)
+  w.process(dir, []string{arriving})
+  season := filepath.Join(filepath.Dir(filepath.Dir(dir)), "Firefly (2002)", "Season 01")
+  if _, err := os.Stat(filepath.Join(season, "1x04 - Jaynestown.mkv")); err != nil { t.Errorf("folders not renamed after the last file settled: %v", err) }
+}
@@ -2,4 +2,11 @@ module github.com/GizzmoShifu/tvrn
 
 go 1.22
 
-require github.com/pelletier/go-toml/v2 v2.2.2
+require (
+	github.com/fsnotify/fsnotify v1.7.0
+	github.com/pelletier/go-toml/v2 v2.2.2
+	go.etcd.io/bbolt v1.3.11
+	golang.org/x/term v0.25.0
+)
+
+require golang.org/x/sys v0.26.0 // indirect
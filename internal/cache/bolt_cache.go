@@ -0,0 +1,278 @@
+package cache
+
+import (
+  "encoding/binary"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "path/filepath"
+  "sort"
+  "sync"
+  "time"
+
+  bolt "go.etcd.io/bbolt"
+)
+
+var (
+  bucketEntries = []byte("entries")
+  bucketLRU     = []byte("lru")  // key -> last access (unix nanos) + stored size, 16 bytes
+  bucketMeta    = []byte("meta") // size: stored bytes; migrated: the FS cache was imported
+)
+
+const (
+  lockTimeout = 10 * time.Second // a single operation waits this long for another process
+  hitBatch    = 32               // hits counted in memory before they are written
+)
+
+// Bolt keeps every entry in a single embedded bbolt file, ~/.tvrn/cache.db.
+// Puts are transactional, and when the stored bytes pass the size bound the least
+// recently used entries are evicted in the same transaction. The file is opened for
+// each operation rather than for the process, so a running watch or serve doesn't lock
+// the CLI out; reads share the lock. Hits are counted in memory and written in batches.
+type Bolt struct {
+  path string
+  max  int64 // bytes; 0 means unbounded
+
+  mu   sync.Mutex
+  hits map[string]hit // counted since the last write
+}
+
+type hit struct {
+  n    int
+  last time.Time
+}
+
+// OpenBolt creates the database when needed and imports whatever the FS cache holds, so
+// switching backends keeps the existing entries. An interrupted import resumes next time.
+func OpenBolt(home string, maxBytes int64) (*Bolt, error) {
+  b := &Bolt{path: filepath.Join(home, "cache.db"), max: maxBytes, hits: map[string]hit{}}
+  migrated := false
+  err := b.update(func(tx *bolt.Tx) error {
+    for _, name := range [][]byte{bucketEntries, bucketLRU, bucketMeta} {
+      if _, err := tx.CreateBucketIfNotExists(name); err != nil { return err }
+    }
+    meta := tx.Bucket(bucketMeta)
+    migrated = meta.Get([]byte("migrated")) != nil
+    if meta.Get([]byte("size")) == nil { return setSize(tx, storedSize(tx)) } // from before the running size
+    return nil
+  })
+  if err != nil { return nil, err }
+
+  if !migrated {
+    if _, err := MigrateFS(NewFS(home), b); err != nil { return nil, fmt.Errorf("migrate FS cache: %w", err) }
+    err := b.update(func(tx *bolt.Tx) error { return tx.Bucket(bucketMeta).Put([]byte("migrated"), []byte{1}) })
+    if err != nil { return nil, err }
+  }
+  return b, nil
+}
+
+// Close writes the hits counted since the last write. Without it they are lost, along
+// with the recency eviction goes by.
+func (b *Bolt) Close() error { return b.flush() }
+
+// Get reads in a shared transaction; the hit is counted in memory
+func (b *Bolt) Get(k string) (Entry, bool) {
+  var e Entry
+  ok := false
+  _ = b.view(func(tx *bolt.Tx) error {
+    v := tx.Bucket(bucketEntries).Get([]byte(k))
+    if v == nil || json.Unmarshal(v, &e) != nil { return nil }
+    if !e.Expires.IsZero() && time.Now().After(e.Expires) { return nil }
+    ok = true
+    return nil
+  })
+  if !ok { return Entry{}, false }
+
+  b.mu.Lock()
+  h := b.hits[k]
+  h.n++
+  h.last = time.Now()
+  b.hits[k] = h
+  pending := len(b.hits)
+  b.mu.Unlock()
+  e.Hits += h.n
+  e.LastHit = h.last
+  if pending >= hitBatch { _ = b.flush() }
+  return e, true
+}
+
+func (b *Bolt) Peek(k string) (Entry, bool) {
+  var e Entry
+  ok := false
+  _ = b.view(func(tx *bolt.Tx) error {
+    v := tx.Bucket(bucketEntries).Get([]byte(k))
+    ok = v != nil && json.Unmarshal(v, &e) == nil
+    return nil
+  })
+  return e, ok
+}
+
+func (b *Bolt) Put(k string, e Entry) error {
+  hits := b.takeHits()
+  return b.update(func(tx *bolt.Tx) error {
+    if err := writeHits(tx, hits); err != nil { return err }
+    if err := put(tx, k, e, time.Now()); err != nil { return err }
+    return b.evict(tx)
+  })
+}
+
+func (b *Bolt) Delete(k string) error {
+  return b.update(func(tx *bolt.Tx) error { return remove(tx, k) })
+}
+
+func (b *Bolt) List() ([]Info, error) {
+  if err := b.flush(); err != nil { return nil, err }
+  var out []Info
+  err := b.view(func(tx *bolt.Tx) error {
+    return tx.Bucket(bucketEntries).ForEach(func(k, v []byte) error {
+      var e Entry
+      if json.Unmarshal(v, &e) != nil { return nil }
+      out = append(out, Info{
+        Key: string(k), Size: int64(len(v)), Hits: e.Hits,
+        Modified: e.Modified, Expires: e.Expires, LastHit: e.LastHit,
+      })
+      return nil
+    })
+  })
+  return out, err
+}
+
+// ===== helpers =====
+
+// view and update open the database for one transaction: reads share the file lock,
+// writes hold it alone until they commit
+func (b *Bolt) view(fn func(*bolt.Tx) error) error {
+  db, err := b.open(true)
+  if err != nil { return err }
+  defer db.Close()
+  return db.View(fn)
+}
+
+func (b *Bolt) update(fn func(*bolt.Tx) error) error {
+  db, err := b.open(false)
+  if err != nil { return err }
+  defer db.Close()
+  return db.Update(fn)
+}
+
+func (b *Bolt) open(readOnly bool) (*bolt.DB, error) {
+  db, err := bolt.Open(b.path, 0o644, &bolt.Options{Timeout: lockTimeout, ReadOnly: readOnly})
+  if errors.Is(err, bolt.ErrTimeout) {
+    return nil, fmt.Errorf("cache database %s is busy in another tvrn process", b.path)
+  }
+  return db, err
+}
+
+// flush writes the hits counted since the last write
+func (b *Bolt) flush() error {
+  hits := b.takeHits()
+  if len(hits) == 0 { return nil }
+  return b.update(func(tx *bolt.Tx) error { return writeHits(tx, hits) })
+}
+
+func (b *Bolt) takeHits() map[string]hit {
+  b.mu.Lock()
+  defer b.mu.Unlock()
+  hits := b.hits
+  b.hits = map[string]hit{}
+  return hits
+}
+
+func writeHits(tx *bolt.Tx, hits map[string]hit) error {
+  for k, h := range hits {
+    var e Entry
+    v := tx.Bucket(bucketEntries).Get([]byte(k))
+    if v == nil || json.Unmarshal(v, &e) != nil { continue }
+    e.Hits += h.n
+    e.LastHit = h.last
+    if err := put(tx, k, e, h.last); err != nil { return err }
+  }
+  return nil
+}
+
+// put stores an entry, last used at, and keeps the running size
+func put(tx *bolt.Tx, k string, e Entry, at time.Time) error {
+  v, err := json.Marshal(e)
+  if err != nil { return err }
+  lru := tx.Bucket(bucketLRU)
+  size := getSize(tx) + int64(len(v))
+  if old := lru.Get([]byte(k)); len(old) == 16 { size -= int64(binary.BigEndian.Uint64(old[8:])) }
+  if err := tx.Bucket(bucketEntries).Put([]byte(k), v); err != nil { return err }
+  if err := lru.Put([]byte(k), lruValue(at, int64(len(v)))); err != nil { return err }
+  return setSize(tx, size)
+}
+
+func remove(tx *bolt.Tx, k string) error {
+  lru := tx.Bucket(bucketLRU)
+  if old := lru.Get([]byte(k)); len(old) == 16 {
+    if err := setSize(tx, getSize(tx)-int64(binary.BigEndian.Uint64(old[8:]))); err != nil { return err }
+  }
+  if err := tx.Bucket(bucketEntries).Delete([]byte(k)); err != nil { return err }
+  return lru.Delete([]byte(k))
+}
+
+// evict drops least recently used entries until the store is back under 90% of its bound.
+// Only passing the bound walks the entries.
+func (b *Bolt) evict(tx *bolt.Tx) error {
+  if b.max <= 0 || getSize(tx) <= b.max { return nil }
+  type rec struct {
+    key string
+    at  int64
+  }
+  var recs []rec
+  _ = tx.Bucket(bucketLRU).ForEach(func(k, v []byte) error {
+    if len(v) == 16 { recs = append(recs, rec{key: string(k), at: int64(binary.BigEndian.Uint64(v[:8]))}) }
+    return nil
+  })
+  sort.Slice(recs, func(i, j int) bool { return recs[i].at < recs[j].at })
+  target := b.max * 9 / 10
+  for _, r := range recs {
+    if getSize(tx) <= target { break }
+    if err := remove(tx, r.key); err != nil { return err }
+  }
+  return nil
+}
+
+func getSize(tx *bolt.Tx) int64 {
+  v := tx.Bucket(bucketMeta).Get([]byte("size"))
+  if len(v) != 8 { return 0 }
+  return int64(binary.BigEndian.Uint64(v))
+}
+
+func setSize(tx *bolt.Tx, n int64) error {
+  v := make([]byte, 8)
+  binary.BigEndian.PutUint64(v, uint64(max(n, 0)))
+  return tx.Bucket(bucketMeta).Put([]byte("size"), v)
+}
+
+// storedSize adds up the LRU sizes, for a database written before the running size
+func storedSize(tx *bolt.Tx) int64 {
+  var total int64
+  _ = tx.Bucket(bucketLRU).ForEach(func(_, v []byte) error {
+    if len(v) == 16 { total += int64(binary.BigEndian.Uint64(v[8:])) }
+    return nil
+  })
+  return total
+}
+
+func lruValue(at time.Time, size int64) []byte {
+  v := make([]byte, 16)
+  binary.BigEndian.PutUint64(v[:8], uint64(at.UnixNano()))
+  binary.BigEndian.PutUint64(v[8:], uint64(size))
+  return v
+}
+
+// MigrateFS copies every FS cache entry into dst and removes the copied files.
+func MigrateFS(src *FS, dst Store) (int, error) {
+  infos, err := src.List()
+  if err != nil { return 0, err }
+  n := 0
+  for _, i := range infos {
+    e, ok := src.Peek(i.Key)
+    if !ok { continue }
+    if err := dst.Put(i.Key, e); err != nil { return n, err }
+    if err := src.Delete(i.Key); err != nil { return n, err }
+    n++
+  }
+  return n, nil
+}
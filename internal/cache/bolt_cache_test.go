@@ -0,0 +1,87 @@
+package cache
+
+import (
+  "encoding/binary"
+  "fmt"
+  "strings"
+  "testing"
+  "time"
+
+  bolt "go.etcd.io/bbolt"
+)
+
+// entry is a cache entry with a body of n bytes
+func entry(n int) Entry {
+  return Entry{Body: []byte(strings.Repeat("x", n)), Modified: time.Now(), Expires: time.Now().Add(time.Hour)}
+}
+
+// storedBytes is the running size and the sum of the listed entries, which should agree
+func storedBytes(t *testing.T, b *Bolt) (running, listed int64) {
+  t.Helper()
+  infos, err := b.List()
+  if err != nil { t.Fatal(err) }
+  for _, i := range infos { listed += i.Size }
+  if err := b.view(func(tx *bolt.Tx) error { running = getSize(tx); return nil }); err != nil { t.Fatal(err) }
+  return running, listed
+}
+
+func keys(t *testing.T, b *Bolt) map[string]bool {
+  t.Helper()
+  infos, err := b.List()
+  if err != nil { t.Fatal(err) }
+  out := map[string]bool{}
+  for _, i := range infos { out[i.Key] = true }
+  return out
+}
+
+func TestBoltSizeBoundEvictsLeastRecentlyUsed(t *testing.T) {
+  home := t.TempDir()
+  probe, err := OpenBolt(home, 0)
+  if err != nil { t.Fatal(err) }
+  if err := probe.Put("probe", entry(1000)); err != nil { t.Fatal(err) }
+  size, _ := storedBytes(t, probe)
+  if err := probe.Delete("probe"); err != nil { t.Fatal(err) }
+
+  // Room for five entries; the sixth goes past the bound
+  max := size*11/2
+  b := &Bolt{path: probe.path, max: max, hits: map[string]hit{}}
+  for i := range 5 {
+    if err := b.Put(fmt.Sprint("k", i), entry(1000)); err != nil { t.Fatal(err) }
+  }
+  if _, ok := b.Get("k0"); !ok { t.Fatal("k0 missing") }
+  if err := b.Close(); err != nil { t.Fatal(err) } // k0 is now the most recently used
+  if err := b.Put("k5", entry(1000)); err != nil { t.Fatal(err) }
+
+  running, listed := storedBytes(t, b)
+  if running != listed { t.Errorf("running size %d, entries add up to %d", running, listed) }
+  if running > max*9/10 { t.Errorf("stored %d bytes after eviction, want at most 90%% of %d", running, max) }
+  got := keys(t, b)
+  for k, want := range map[string]bool{"k0": true, "k1": false, "k2": false, "k3": true, "k4": true, "k5": true} {
+    if got[k] != want { t.Errorf("%s kept = %v, want %v", k, got[k], want) }
+  }
+}
+
+func TestBoltFlushesHits(t *testing.T) {
+  home := t.TempDir()
+  b, err := OpenBolt(home, 0)
+  if err != nil { t.Fatal(err) }
+  for i := range hitBatch {
+    if err := b.Put(fmt.Sprint("k", i), entry(10)); err != nil { t.Fatal(err) }
+  }
+  other := &Bolt{path: b.path, hits: map[string]hit{}} // another process reading the same file
+
+  before := time.Now()
+  b.Get("k0")
+  b.Get("k0")
+  if e, _ := other.Peek("k0"); e.Hits != 0 { t.Errorf("hits written before the batch filled: %d", e.Hits) }
+  if err := b.Close(); err != nil { t.Fatal(err) }
+  e, _ := other.Peek("k0")
+  if e.Hits != 2 || e.LastHit.Before(before) { t.Errorf("after Close: hits %d, last hit %v; want 2 since %v", e.Hits, e.LastHit, before) }
+  var at int64
+  _ = b.view(func(tx *bolt.Tx) error { at = int64(binary.BigEndian.Uint64(tx.Bucket(bucketLRU).Get([]byte("k0"))[:8])); return nil })
+  if at != e.LastHit.UnixNano() { t.Errorf("LRU time %v, want the last hit %v rather than the write", time.Unix(0, at), e.LastHit) }
+
+  // A full batch is written without waiting for Close
+  for i := range hitBatch { b.Get(fmt.Sprint("k", i)) }
+  if e, _ := other.Peek(fmt.Sprint("k", hitBatch-1)); e.Hits != 1 { t.Errorf("hits after a full batch = %d, want 1", e.Hits) }
+}
@@ -1,15 +1,49 @@
 package cache
 
-import "time"
+import (
+  "fmt"
+  "time"
+)
 
 type Entry struct {
   Body      []byte
   ETag      string
   Modified  time.Time
   Expires   time.Time
+  Hits      int
+  LastHit   time.Time
 }
 
+// Info describes a stored entry without its body, for listing and pruning.
+type Info struct {
+  Key      string
+  Size     int64
+  Hits     int
+  Modified time.Time
+  Expires  time.Time
+  LastHit  time.Time
+}
+
+// Expired reports whether the entry is past its expiry at t.
+func (i Info) Expired(t time.Time) bool { return !i.Expires.IsZero() && t.After(i.Expires) }
+
 type Store interface {
   Get(key string) (Entry, bool)
   Put(key string, e Entry) error
+  // Peek returns an entry even when it has expired, without counting a hit. Offline mode serves stale data
+  Peek(key string) (Entry, bool)
+  List() ([]Info, error)
+  Delete(key string) error
+}
+
+// Open returns the configured backend: "fs" (default) or "bolt" with a size bound in MiB.
+func Open(home, backend string, maxMB int) (Store, error) {
+  switch backend {
+  case "", "fs":
+    return NewFS(home), nil
+  case "bolt", "bbolt", "db":
+    return OpenBolt(home, int64(maxMB)<<20)
+  default:
+    return nil, fmt.Errorf("unknown cache backend %q (want fs or bolt)", backend)
+  }
 }
@@ -2,28 +2,204 @@ package cache
 
 import (
   "encoding/json"
+  "fmt"
   "os"
   "path/filepath"
+  "strconv"
+  "strings"
+  "sync"
   "time"
 )
 
-type FS struct { dir string }
+// FS keeps one JSON file per key. Keys are encoded so any character is safe in a filename,
+// and writes go to a temp file renamed into place so concurrent runs never see half an entry.
+// Hits are counted in memory and written in batches to a small side file per key, so a
+// read never rewrites the entry itself.
+type FS struct {
+  dir string
 
-func NewFS(home string) *FS { return &FS{dir: filepath.Join(home, "cache")} }
+  mu   sync.Mutex
+  hits map[string]hit // counted since the last write
+}
+
+func NewFS(home string) *FS { return &FS{dir: filepath.Join(home, "cache"), hits: map[string]hit{}} }
+
+func (f *FS) path(k string) string { return filepath.Join(f.dir, EncodeKey(k)+".json") }
+
+// hitsPath holds the hits written for k since the entry was
+func (f *FS) hitsPath(k string) string { return filepath.Join(f.dir, EncodeKey(k)+".hits") }
 
-func (f *FS) path(k string) string { return filepath.Join(f.dir, k+".json") }
+// legacyPath is where keys were written before encoding, e.g. "episodes:1:default:1:en.json"
+func (f *FS) legacyPath(k string) string { return filepath.Join(f.dir, k+".json") }
 
+// Close writes the hits counted since the last write
+func (f *FS) Close() error { return f.flush() }
+
+// Get reads the entry; the hit is counted in memory
 func (f *FS) Get(k string) (Entry, bool) {
+  e, ok := f.Peek(k)
+  if !ok { return Entry{}, false }
+  if !e.Expires.IsZero() && time.Now().After(e.Expires) { return Entry{}, false }
+
+  f.mu.Lock()
+  h := f.hits[k]
+  h.n++
+  h.last = time.Now()
+  f.hits[k] = h
+  pending := len(f.hits)
+  f.mu.Unlock()
+  e.Hits += h.n
+  e.LastHit = h.last
+  if pending >= hitBatch { _ = f.flush() } // hit counts are best effort
+  return e, true
+}
+
+func (f *FS) Peek(k string) (Entry, bool) {
   var e Entry
   b, err := os.ReadFile(f.path(k))
+  if err != nil && !strings.ContainsAny(k, `/\`) {
+    b, err = os.ReadFile(f.legacyPath(k))
+  }
   if err != nil { return e, false }
   if json.Unmarshal(b, &e) != nil { return Entry{}, false }
-  if !e.Expires.IsZero() && time.Now().After(e.Expires) { return Entry{}, false }
+  f.addHits(k, &e)
   return e, true
 }
 
+// Put writes e with the hits it carries, so those in the side file are dropped
 func (f *FS) Put(k string, e Entry) error {
   if err := os.MkdirAll(f.dir, 0o755); err != nil { return err }
   b, _ := json.MarshalIndent(e, "", "  ")
-  return os.WriteFile(f.path(k), b, 0o644)
+  if err := writeAtomic(f.path(k), b); err != nil { return err }
+  _ = os.Remove(f.hitsPath(k))
+  if lp := f.legacyPath(k); lp != f.path(k) && !strings.ContainsAny(k, `/\`) {
+    _ = os.Remove(lp)
+  }
+  return nil
+}
+
+func (f *FS) Delete(k string) error {
+  f.mu.Lock()
+  delete(f.hits, k)
+  f.mu.Unlock()
+  if lp := f.legacyPath(k); lp != f.path(k) && !strings.ContainsAny(k, `/\`) {
+    _ = os.Remove(lp)
+  }
+  _ = os.Remove(f.hitsPath(k))
+  if err := os.Remove(f.path(k)); err != nil && !os.IsNotExist(err) { return err }
+  return nil
+}
+
+func (f *FS) List() ([]Info, error) {
+  entries, err := os.ReadDir(f.dir)
+  if os.IsNotExist(err) { return nil, nil }
+  if err != nil { return nil, err }
+
+  var out []Info
+  for _, d := range entries {
+    name := d.Name()
+    if d.IsDir() || !strings.HasSuffix(name, ".json") || strings.HasPrefix(name, ".") { continue }
+    key, err := DecodeKey(strings.TrimSuffix(name, ".json"))
+    if err != nil { continue }
+    b, err := os.ReadFile(filepath.Join(f.dir, name))
+    if err != nil { continue }
+    var e Entry
+    if json.Unmarshal(b, &e) != nil { continue }
+    f.addHits(key, &e)
+    out = append(out, Info{
+      Key: key, Size: int64(len(b)), Hits: e.Hits,
+      Modified: e.Modified, Expires: e.Expires, LastHit: e.LastHit,
+    })
+  }
+  return out, nil
+}
+
+// fileHits is the side file's content
+type fileHits struct {
+  Hits    int
+  LastHit time.Time
+}
+
+// addHits adds the hits written to k's side file to e
+func (f *FS) addHits(k string, e *Entry) {
+  var fh fileHits
+  b, err := os.ReadFile(f.hitsPath(k))
+  if err != nil || json.Unmarshal(b, &fh) != nil { return }
+  e.Hits += fh.Hits
+  if fh.LastHit.After(e.LastHit) { e.LastHit = fh.LastHit }
+}
+
+// flush adds the hits counted since the last write to each key's side file
+func (f *FS) flush() error {
+  f.mu.Lock()
+  hits := f.hits
+  f.hits = map[string]hit{}
+  f.mu.Unlock()
+  for k, h := range hits {
+    if _, ok := f.Peek(k); !ok { continue } // deleted since
+    var fh fileHits
+    if b, err := os.ReadFile(f.hitsPath(k)); err == nil { _ = json.Unmarshal(b, &fh) }
+    fh.Hits += h.n
+    fh.LastHit = h.last
+    b, _ := json.Marshal(fh)
+    if err := writeAtomic(f.hitsPath(k), b); err != nil { return err }
+  }
+  return nil
+}
+
+// writeAtomic writes b next to path and renames it into place
+func writeAtomic(path string, b []byte) error {
+  tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+  if err != nil { return err }
+  if _, err := tmp.Write(b); err != nil {
+    tmp.Close()
+    os.Remove(tmp.Name())
+    return err
+  }
+  if err := tmp.Close(); err != nil {
+    os.Remove(tmp.Name())
+    return err
+  }
+  if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+    os.Remove(tmp.Name())
+    return err
+  }
+  if err := os.Rename(tmp.Name(), path); err != nil {
+    os.Remove(tmp.Name())
+    return err
+  }
+  return nil
+}
+
+// EncodeKey keeps letters, digits, '.', '_' and '-' and writes every other byte as %XX,
+// so keys with ':' or '/' are safe filenames on every platform.
+func EncodeKey(k string) string {
+  var b strings.Builder
+  for i := 0; i < len(k); i++ {
+    c := k[i]
+    switch {
+    case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.' || c == '_' || c == '-':
+      b.WriteByte(c)
+    default:
+      fmt.Fprintf(&b, "%%%02X", c)
+    }
+  }
+  return b.String()
+}
+
+// DecodeKey reverses EncodeKey. Legacy unencoded names decode to themselves.
+func DecodeKey(s string) (string, error) {
+  var b strings.Builder
+  for i := 0; i < len(s); i++ {
+    if s[i] != '%' {
+      b.WriteByte(s[i])
+      continue
+    }
+    if i+2 >= len(s) { return "", fmt.Errorf("bad key encoding %q", s) }
+    c, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+    if err != nil { return "", fmt.Errorf("bad key encoding %q", s) }
+    b.WriteByte(byte(c))
+    i += 2
+  }
+  return b.String(), nil
 }
@@ -0,0 +1,81 @@
+package cache
+
+import (
+  "bytes"
+  "fmt"
+  "os"
+  "path/filepath"
+  "testing"
+  "time"
+)
+
+func TestEncodeKey(t *testing.T) {
+  tests := []struct {
+    key  string
+    want string
+  }{
+    {"episodes:78874:default:1:en", "episodes%3A78874%3Adefault%3A1%3Aen"},
+    {"search:en:firefly/serenity", "search%3Aen%3Afirefly%2Fserenity"},
+    {"tmdb:series:1437:en", "tmdb%3Aseries%3A1437%3Aen"},
+    {"search:en:100% pure", "search%3Aen%3A100%25%20pure"},
+    {"plain-key_1.0", "plain-key_1.0"},
+  }
+  for _, tt := range tests {
+    got := EncodeKey(tt.key)
+    if got != tt.want { t.Errorf("EncodeKey(%q) = %q, want %q", tt.key, got, tt.want) }
+    back, err := DecodeKey(got)
+    if err != nil || back != tt.key { t.Errorf("DecodeKey(%q) = %q, %v; want %q", got, back, err, tt.key) }
+  }
+  for _, bad := range []string{"abc%2", "abc%zz"} {
+    if _, err := DecodeKey(bad); err == nil { t.Errorf("DecodeKey(%q) accepted a broken escape", bad) }
+  }
+}
+
+func TestFSReadsLegacyNames(t *testing.T) {
+  home := t.TempDir()
+  f := NewFS(home)
+  if err := os.MkdirAll(f.dir, 0o755); err != nil { t.Fatal(err) }
+  if err := os.WriteFile(filepath.Join(f.dir, "series:78874:en.json"), []byte(`{"Body":"e30="}`), 0o644); err != nil { t.Fatal(err) }
+
+  e, ok := f.Peek("series:78874:en")
+  if !ok || string(e.Body) != "{}" { t.Fatalf("legacy entry = %+v, %v", e, ok) }
+  if err := f.Put("series:78874:en", e); err != nil { t.Fatal(err) }
+  if _, err := os.Stat(filepath.Join(f.dir, "series:78874:en.json")); !os.IsNotExist(err) { t.Error("legacy file kept after a write") }
+  if _, err := os.Stat(f.path("series:78874:en")); err != nil { t.Errorf("encoded file not written: %v", err) }
+}
+
+func TestFSFlushesHits(t *testing.T) {
+  home := t.TempDir()
+  f := NewFS(home)
+  for i := range hitBatch {
+    if err := f.Put(fmt.Sprint("k", i), entry(10)); err != nil { t.Fatal(err) }
+  }
+  written, err := os.ReadFile(f.path("k0"))
+  if err != nil { t.Fatal(err) }
+  other := NewFS(home) // another process reading the same folder
+
+  before := time.Now()
+  f.Get("k0")
+  if e, _ := f.Get("k0"); e.Hits != 2 { t.Errorf("Get counted %d hits, want 2", e.Hits) }
+  if e, _ := other.Peek("k0"); e.Hits != 0 { t.Errorf("hits written before the batch filled: %d", e.Hits) }
+  if err := f.Close(); err != nil { t.Fatal(err) }
+  e, _ := other.Peek("k0")
+  if e.Hits != 2 || e.LastHit.Before(before) { t.Errorf("after Close: hits %d, last hit %v; want 2 since %v", e.Hits, e.LastHit, before) }
+  if b, _ := os.ReadFile(f.path("k0")); !bytes.Equal(b, written) { t.Error("a hit rewrote the entry") }
+  infos, err := other.List()
+  if err != nil { t.Fatal(err) }
+  if len(infos) != hitBatch { t.Errorf("listed %d entries, want %d; side files must not show", len(infos), hitBatch) }
+  for _, i := range infos {
+    if i.Key == "k0" && i.Hits != 2 { t.Errorf("listed hits %d, want 2", i.Hits) }
+  }
+
+  // A full batch is written without waiting for Close
+  for i := range hitBatch { f.Get(fmt.Sprint("k", i)) }
+  if e, _ := other.Peek(fmt.Sprint("k", hitBatch-1)); e.Hits != 1 { t.Errorf("hits after a full batch = %d, want 1", e.Hits) }
+
+  // An entry written afresh starts again, as the hits it carries replace the side file
+  if err := f.Put("k0", entry(10)); err != nil { t.Fatal(err) }
+  if e, _ := other.Peek("k0"); e.Hits != 0 { t.Errorf("hits after a rewrite = %d, want 0", e.Hits) }
+  if err := f.Delete("k1"); err != nil { t.Fatal(err) }
+  if _, err := os.Stat(f.hitsPath("k1")); !os.IsNotExist(err) { t.Error("side file kept after Delete") }
+}
@@ -5,7 +5,10 @@ import (
   "fmt"
   "os"
   "path/filepath"
+  "slices"
+  "strings"
 
+  "github.com/GizzmoShifu/tvrn/internal/parse"
   "github.com/pelletier/go-toml/v2"
 )
 
@@ -17,18 +20,27 @@ type Config struct {
   Defaults Defaults `toml:"defaults"`
   CLI     CLI       `toml:"-"`
   Log     Log       `toml:"log"`
+  Watch   Watch     `toml:"watch"`
+  Hook    Hook      `toml:"hook"`
+  Serve   Serve     `toml:"serve"`
+  Network Network   `toml:"network"`
+  Parse   Parse     `toml:"parse"`
+  Match   Match     `toml:"match"`
 }
 
 type Auth struct {
-  APIKey string `toml:"apikey"`
-  PIN    string `toml:"pin"`
+  APIKey  string `toml:"apikey"`
+  PIN     string `toml:"pin"`
+  TMDBKey string `toml:"tmdb_apikey"`
 }
 
 type Cache struct {
-  EpisodesTTLHours int  `toml:"episodes_ttl_hours"`
-  SeriesTTLDays    int  `toml:"series_ttl_days"`
-  SearchTTLDays    int  `toml:"search_ttl_days"`
-  ValidateWithETag bool `toml:"validate_with_etag"`
+  Backend          string `toml:"backend"` // fs | bolt
+  MaxMB            int    `toml:"max_mb"`  // bolt only: evict least recently used past this size
+  EpisodesTTLHours int    `toml:"episodes_ttl_hours"`
+  SeriesTTLDays    int    `toml:"series_ttl_days"`
+  SearchTTLDays    int    `toml:"search_ttl_days"`
+  ValidateWithETag bool   `toml:"validate_with_etag"`
 }
 
 type Rename struct {
@@ -36,33 +48,107 @@ type Rename struct {
   Pad        int    `toml:"pad"`
   Specials   string `toml:"specials"`
   MultiEP    string `toml:"multi_ep"`
+  TitleSep   string `toml:"title_separator"` // between the titles of a multi-episode file
+  TitleMax   int    `toml:"title_max"`       // longer titles are cut after the last whole title that fits
   DateInName string `toml:"date_in_title"`
   TagsRegex  string `toml:"tags_pattern"`
+
+  Folders        bool   `toml:"folders"`          // also rename series and season folders
+  SeasonFolder   string `toml:"season_folder"`    // printf pattern, e.g. "Season %02d"
+  SeriesFolderID bool   `toml:"series_folder_id"` // append [tvdbid-N] to the series folder
 }
 
 type Defaults struct {
-  Order               string `toml:"order"`
-  Lang                string `toml:"lang"`
-  ConfirmationStrict  bool   `toml:"confirmation_strict"`
+  Provider            string   `toml:"provider"` // tvdb | tmdb | tvmaze
+  Fallback            []string `toml:"fallback"` // providers consulted after Provider, in order
+  Order               string   `toml:"order"`
+  Lang                string   `toml:"lang"`
+  ConfirmationStrict  bool     `toml:"confirmation_strict"`
 }
 
 type CLI struct {
-  Root     string
-  Scheme   string
-  Pad      int
-  Order    string
-  Lang     string
-  Specials string
-  MultiEP  string
-  Season   int
-  Detailed bool
-  Debug    bool
-  NoCache  bool
-  ForceRef bool
-  Yes      bool
-}
-
-type Log struct { Level string `toml:"level"` }
+  Root        string
+  Scheme      string
+  Pad         int
+  Order       string
+  Lang        string
+  Specials    string
+  MultiEP     string
+  Season      *int   // --season, nil when not given
+  Detailed    bool
+  Debug       bool
+  NoCache     bool
+  ForceRef    bool
+  Yes         bool
+  Plain       bool   // plain y/N prompt instead of the full-screen editor
+  Interactive bool   // ask per item, like mv -i
+  Series      bool
+  Undo        bool
+  Offline     bool
+  Metadata    string
+  Show        string // series name to search for instead of the folder name
+  Record      string // folder to capture provider traffic into
+  Replay      string // folder of captured traffic to answer from instead of the network
+  Explain     string // text | json: trace how each file was matched
+}
+
+type Log struct {
+  Level  string `toml:"level"`  // debug | info | warn | error
+  Format string `toml:"format"` // text | json, for what is printed to stderr
+  File   bool   `toml:"file"`   // also write JSON lines to logs/tvrn.log
+  MaxMB  int    `toml:"max_mb"` // rotate the file past this size
+  Keep   int    `toml:"keep"`   // rotated files kept
+}
+
+// Watch configures `tvrn watch`, which never asks before applying.
+type Watch struct {
+  Policy        string `toml:"policy"`         // files | all | dry-run
+  SettleSeconds int    `toml:"settle_seconds"` // a file must stop growing this long first
+}
+
+// Hook configures `tvrn hook`, run by download clients when a download completes.
+type Hook struct {
+  Categories []string `toml:"categories"` // only act on these client categories; empty means all
+}
+
+// Serve configures `tvrn serve`, the local HTTP API and web UI.
+type Serve struct {
+  Addr  string `toml:"addr"`  // listen address; localhost unless changed
+  Token string `toml:"token"` // required as a bearer token on every API call; generated when empty
+  Root  string `toml:"root"`  // only folders inside it can be planned; the current folder when empty
+}
+
+// Parse adds to and trims the filename patterns episode numbers are read with.
+type Parse struct {
+  Patterns []Pattern `toml:"patterns"`
+  Disable  []string  `toml:"disable"` // built-in patterns to drop, by name
+}
+
+// Pattern is a user filename pattern: a regular expression naming its captures
+// (?P<season>), (?P<episode>), (?P<episode2>) for the end of a range, (?P<episodes>)
+// for a run of more such as E02E03 or -04, and (?P<segment>) for one file of a split
+// episode (a, b or 1, 2). Only episode is required.
+type Pattern struct {
+  Name     string `toml:"name"`
+  Regex    string `toml:"regex"`
+  Priority int    `toml:"priority"` // higher runs first; the built-ins run from 100 down to 10
+}
+
+// Match configures finding episodes by title, for files named only by title or with
+// numbers the provider doesn't have
+type Match struct {
+  Titles    bool    `toml:"titles"`    // fall back to the title when the number fails
+  Threshold float64 `toml:"threshold"` // how alike, from 0 to 1, a title must be to count
+}
+
+// Network is the retry policy for provider requests.
+type Network struct {
+  Retries                int `toml:"retries"`                  // attempts per request, the first included
+  BackoffMS              int `toml:"backoff_ms"`               // first retry wait, doubled each time with jitter
+  MaxBackoffSeconds      int `toml:"max_backoff_seconds"`      // cap on a single wait
+  BreakerFailures        int `toml:"breaker_failures"`         // failed requests in a row before giving up on a provider
+  BreakerCooldownSeconds int `toml:"breaker_cooldown_seconds"` // how long to give up for
+}
 
 func Load() (*Config, error) {
   home := os.Getenv("TVRN_HOME")
@@ -77,11 +163,18 @@ func Load() (*Config, error) {
 
   cfg := &Config{Home: home}
   // sensible defaults
-  cfg.Auth = Auth{APIKey: os.Getenv("TVDB_APIKEY"), PIN: os.Getenv("TVDB_PIN")}
-  cfg.Cache = Cache{EpisodesTTLHours: 24, SeriesTTLDays: 7, SearchTTLDays: 7, ValidateWithETag: true}
-  cfg.Rename = Rename{Scheme: defaultScheme, Pad: defaultPad, Specials: "inline", MultiEP: "range", DateInName: "none"}
-  cfg.Defaults = Defaults{Order: defaultOrder, Lang: defaultLang, ConfirmationStrict: true}
-  cfg.Log = Log{Level: "info"}
+  cfg.Auth = Auth{APIKey: os.Getenv("TVDB_APIKEY"), PIN: os.Getenv("TVDB_PIN"), TMDBKey: os.Getenv("TMDB_APIKEY")}
+  cfg.Cache = Cache{Backend: "fs", MaxMB: defaultCacheMB, EpisodesTTLHours: 24, SeriesTTLDays: 7, SearchTTLDays: 7, ValidateWithETag: true}
+  cfg.Rename = Rename{Scheme: defaultScheme, Pad: defaultPad, Specials: "inline", MultiEP: "range", TitleSep: defaultTitleSep, TitleMax: defaultTitleMax, DateInName: "none", SeasonFolder: defaultSeasonFolder}
+  cfg.Defaults = Defaults{Provider: defaultProvider, Order: defaultOrder, Lang: defaultLang, ConfirmationStrict: true}
+  cfg.Log = Log{Level: "info", Format: "text", File: true, MaxMB: defaultLogMB, Keep: defaultLogKeep}
+  cfg.Match = Match{Titles: true, Threshold: defaultMatchScore}
+  cfg.Watch = Watch{Policy: "files", SettleSeconds: defaultSettleSeconds}
+  cfg.Serve = Serve{Addr: defaultServeAddr, Token: os.Getenv("TVRN_TOKEN")}
+  cfg.Network = Network{
+    Retries: defaultRetries, BackoffMS: defaultBackoffMS, MaxBackoffSeconds: defaultMaxBackoff,
+    BreakerFailures: defaultBreakAfter, BreakerCooldownSeconds: defaultBreakCooldown,
+  }
 
   path := filepath.Join(home, "config.toml")
   if b, err := os.ReadFile(path); err == nil {
@@ -89,8 +182,86 @@ func Load() (*Config, error) {
       return nil, fmt.Errorf("parse config: %w", err)
     }
   }
-  if cfg.Auth.APIKey == "" {
-    return nil, errors.New("TVDB API key missing: set auth.apikey or TVDB_APIKEY")
-  }
+  cfg.Defaults.Order = normOrder(cfg.Defaults.Order)
   return cfg, nil
 }
+
+// normOrder is how orders are compared everywhere, e.g. "Auto" in the config is "auto"
+func normOrder(o string) string { return strings.ToLower(strings.TrimSpace(o)) }
+
+// Providers is the provider priority list: the main provider, then its fallbacks.
+func (c *Config) Providers() []string {
+  return append([]string{c.Defaults.Provider}, c.Defaults.Fallback...)
+}
+
+// Validate checks the settings the chosen providers need, and puts defaults.order in the
+// form the rest of tvrn compares. Call it once flags are merged. Undo, offline, replayed
+// and local metadata runs never log in, so they need no keys.
+func (c *Config) Validate() error {
+  switch strings.ToLower(c.Log.Level) {
+  case "", "debug", "info", "warn", "warning", "error":
+  default:
+    return fmt.Errorf("unknown log level %q (want debug, info, warn or error)", c.Log.Level)
+  }
+  switch strings.ToLower(c.Log.Format) {
+  case "", "text", "json":
+  default:
+    return fmt.Errorf("unknown log format %q (want text or json)", c.Log.Format)
+  }
+  if c.CLI.Offline && c.CLI.NoCache {
+    return errors.New("--offline serves from the cache and can't be combined with --no-cache")
+  }
+  if c.CLI.Replay != "" && (c.CLI.Record != "" || c.CLI.Offline) {
+    return errors.New("--replay can't be combined with --record or --offline")
+  }
+  if c.CLI.Record != "" && c.CLI.Offline {
+    return errors.New("--record captures network traffic and can't be combined with --offline")
+  }
+  if s := c.CLI.Season; s != nil {
+    if c.CLI.Series { return errors.New("--season names one folder's season and can't be combined with --series") }
+    if *s < 0 { return fmt.Errorf("--season %d: seasons start at 0, for specials", *s) }
+  }
+  for _, p := range c.Parse.Patterns {
+    if p.Name == "" { return fmt.Errorf("[[parse.patterns]] %q needs a name", p.Regex) }
+    if _, err := parse.Compile(p.Name, p.Regex, p.Priority); err != nil {
+      return fmt.Errorf("[[parse.patterns]] %s: %w", p.Name, err)
+    }
+  }
+  for _, d := range c.Parse.Disable {
+    if !slices.Contains(parse.Builtins(), d) {
+      return fmt.Errorf("parse.disable: no built-in pattern %q (have %s)", d, strings.Join(parse.Builtins(), ", "))
+    }
+  }
+  c.Defaults.Order = normOrder(c.Defaults.Order) // for flags merged since Load
+  switch c.Defaults.Order {
+  case "", "aired", "default", "dvd", "absolute", "abs", "alternate", "alt", "regional",
+    "alternate-dvd", "alternate_dvd", "altdvd", "auto":
+  default:
+    return fmt.Errorf("unknown order %q (want aired, dvd, absolute, alternate, regional or auto)", c.Defaults.Order)
+  }
+  switch c.Cache.Backend {
+  case "", "fs", "bolt", "bbolt", "db":
+  default:
+    return fmt.Errorf("unknown cache.backend %q (want fs or bolt)", c.Cache.Backend)
+  }
+  if t := c.Match.Threshold; t <= 0 || t > 1 {
+    return fmt.Errorf("match.threshold %g: want a score above 0, up to 1", t)
+  }
+  if e := c.CLI.Explain; e != "" && e != "text" && e != "json" {
+    return fmt.Errorf("unknown --explain format %q (want text or json)", e)
+  }
+  if c.CLI.Undo || c.CLI.Offline || c.CLI.Metadata != "" || c.CLI.Replay != "" { return nil }
+  for _, p := range c.Providers() {
+    switch strings.ToLower(strings.TrimSpace(p)) {
+    case "", "tvdb":
+      if c.Auth.APIKey == "" {
+        return errors.New("TVDB API key missing: set auth.apikey or TVDB_APIKEY")
+      }
+    case "tmdb":
+      if c.Auth.TMDBKey == "" {
+        return errors.New("TMDB API key missing: set auth.tmdb_apikey or TMDB_APIKEY")
+      }
+    }
+  }
+  return nil
+}
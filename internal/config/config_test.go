@@ -0,0 +1,23 @@
+package config
+
+import "testing"
+
+func TestValidateOrder(t *testing.T) {
+  tests := []struct {
+    order string
+    want  string
+    ok    bool
+  }{
+    {"Auto", "auto", true},
+    {" DVD ", "dvd", true},
+    {"alternate_dvd", "alternate_dvd", true},
+    {"", "", true},
+    {"airde", "", false},
+  }
+  for _, tt := range tests {
+    c := &Config{Defaults: Defaults{Order: tt.order}, Match: Match{Threshold: 0.8}, CLI: CLI{Undo: true}}
+    err := c.Validate()
+    if (err == nil) != tt.ok { t.Errorf("order %q: err = %v, want ok %v", tt.order, err, tt.ok) }
+    if tt.ok && c.Defaults.Order != tt.want { t.Errorf("order %q became %q, want %q", tt.order, c.Defaults.Order, tt.want) }
+  }
+}
@@ -0,0 +1,22 @@
+// Package configtest builds configs for tests in other packages.
+package configtest
+
+import (
+  "os"
+  "path/filepath"
+  "testing"
+
+  "github.com/GizzmoShifu/tvrn/internal/config"
+)
+
+// New mirrors config.Load's defaults with a throwaway home
+func New(t testing.TB) *config.Config {
+  t.Helper()
+  cfg := &config.Config{Home: t.TempDir()}
+  if err := os.MkdirAll(filepath.Join(cfg.Home, "state"), 0o755); err != nil { t.Fatal(err) }
+  cfg.Rename = config.Rename{Scheme: "XxYY", Pad: 2, MultiEP: "range", TitleSep: " + ", TitleMax: 120, SeasonFolder: "Season %02d"}
+  cfg.Defaults = config.Defaults{Provider: "tvdb", Order: "aired", Lang: "en"}
+  cfg.Match = config.Match{Titles: true, Threshold: 0.8}
+  cfg.Watch = config.Watch{Policy: "files", SettleSeconds: 1}
+  return cfg
+}
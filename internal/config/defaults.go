@@ -1,8 +1,23 @@
 package config
 
 const (
-  defaultOrder    = "aired"
-  defaultLang     = "en"
-  defaultScheme   = "XxYY"
-  defaultPad      = 2
+  defaultProvider      = "tvdb"
+  defaultOrder         = "aired"
+  defaultLang          = "en"
+  defaultScheme        = "XxYY"
+  defaultPad           = 2
+  defaultSeasonFolder  = "Season %02d"
+  defaultTitleSep      = " + "
+  defaultTitleMax      = 120
+  defaultMatchScore    = 0.8
+  defaultCacheMB       = 256
+  defaultSettleSeconds = 15
+  defaultServeAddr     = "127.0.0.1:8765"
+  defaultRetries       = 4
+  defaultBackoffMS     = 500
+  defaultMaxBackoff    = 30
+  defaultBreakAfter    = 5
+  defaultBreakCooldown = 60
+  defaultLogMB         = 10
+  defaultLogKeep       = 3
 )
@@ -1,15 +1,164 @@
+// Package logx is tvrn's levelled logger. Messages go to stderr, as plain lines or JSON,
+// and optionally to a rotating JSON log file with every attribute, such as the run ID.
 package logx
 
 import (
+  "context"
   "fmt"
-  "log"
+  "io"
+  "log/slog"
+  "os"
+  "strings"
+  "sync"
 )
 
-type Logger struct { level string }
+// Options configures Open
+type Options struct {
+  Level  string // debug | info | warn | error
+  Format string // text | json, for stderr
+  Dir    string // when set, also log to Dir/tvrn.log
+  MaxMB  int    // rotate the file past this size
+  Keep   int    // rotated files kept, tvrn.log.1 being the newest
+}
 
-func New(level string) *Logger { return &Logger{level: level} }
-func (l *Logger) Debugf(f string, a ...any) { if l.level == "debug" { log.Printf("DEBUG "+f, a...) } }
-func (l *Logger) Infof(f string, a ...any)  { log.Printf("INFO  "+f, a...) }
-func (l *Logger) Warnf(f string, a ...any)  { log.Printf("WARN  "+f, a...) }
-func (l *Logger) Errorf(f string, a ...any) { log.Printf("ERROR "+f, a...) }
+type Logger struct {
+  sl   *slog.Logger
+  file io.Closer
+}
+
+// New logs plain lines to stderr at level
+func New(level string) *Logger {
+  return &Logger{sl: slog.New(newText(os.Stderr, ParseLevel(level)))}
+}
+
+// Open builds a logger from Options. The file, when there is one, is closed by Close.
+func Open(o Options) (*Logger, error) {
+  lvl := ParseLevel(o.Level)
+  var console slog.Handler = newText(os.Stderr, lvl)
+  if strings.EqualFold(o.Format, "json") {
+    console = slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: lvl})
+  }
+  if o.Dir == "" { return &Logger{sl: slog.New(console)}, nil }
+
+  rf, err := openRotating(o.Dir, "tvrn.log", int64(o.MaxMB)<<20, o.Keep)
+  if err != nil { return nil, err }
+  file := slog.NewJSONHandler(rf, &slog.HandlerOptions{Level: lvl})
+  return &Logger{sl: slog.New(fanout{console, file}), file: rf}, nil
+}
+
+// ParseLevel reads a level name; anything unknown is info
+func ParseLevel(s string) slog.Level {
+  switch strings.ToLower(strings.TrimSpace(s)) {
+  case "debug": return slog.LevelDebug
+  case "warn", "warning": return slog.LevelWarn
+  case "error": return slog.LevelError
+  }
+  return slog.LevelInfo
+}
+
+// With returns a logger that adds key/value pairs to every record, e.g. With("run", id)
+func (l *Logger) With(args ...any) *Logger {
+  if l == nil { return nil }
+  return &Logger{sl: l.sl.With(args...), file: l.file}
+}
+
+type attrsKey struct{}
+
+// WithAttrs returns a context carrying key/value pairs for For, so code shared between
+// runs, such as a provider client, can log the run it is working for
+func WithAttrs(ctx context.Context, args ...any) context.Context {
+  prev, _ := ctx.Value(attrsKey{}).([]any)
+  return context.WithValue(ctx, attrsKey{}, append(prev[:len(prev):len(prev)], args...))
+}
+
+// For returns l with the key/value pairs ctx carries added
+func (l *Logger) For(ctx context.Context) *Logger {
+  args, _ := ctx.Value(attrsKey{}).([]any)
+  if len(args) == 0 { return l }
+  return l.With(args...)
+}
+
+func (l *Logger) Close() error {
+  if l == nil || l.file == nil { return nil }
+  return l.file.Close()
+}
+
+// The printf methods do nothing on a nil Logger, so packages can log without checking
+// whether they were given one.
+
+func (l *Logger) Debugf(f string, a ...any) { l.logf(slog.LevelDebug, f, a...) }
+func (l *Logger) Infof(f string, a ...any)  { l.logf(slog.LevelInfo, f, a...) }
+func (l *Logger) Warnf(f string, a ...any)  { l.logf(slog.LevelWarn, f, a...) }
+func (l *Logger) Errorf(f string, a ...any) { l.logf(slog.LevelError, f, a...) }
 func (l *Logger) Println(v ...any)          { fmt.Println(v...) }
+
+// Enabled reports whether messages at level would be written anywhere
+func (l *Logger) Enabled(level slog.Level) bool {
+  return l != nil && l.sl.Enabled(context.Background(), level)
+}
+
+func (l *Logger) logf(level slog.Level, f string, a ...any) {
+  if !l.Enabled(level) { return }
+  l.sl.Log(context.Background(), level, fmt.Sprintf(f, a...))
+}
+
+// ===== handlers =====
+
+// text writes the plain lines tvrn has always printed, "2006/01/02 15:04:05 INFO  msg".
+// Attributes are left to the JSON outputs to keep the terminal readable.
+type text struct {
+  mu    *sync.Mutex
+  w     io.Writer
+  level slog.Level
+}
+
+func newText(w io.Writer, level slog.Level) *text { return &text{mu: &sync.Mutex{}, w: w, level: level} }
+
+func (h *text) Enabled(_ context.Context, l slog.Level) bool { return l >= h.level }
+
+func (h *text) Handle(_ context.Context, r slog.Record) error {
+  label := "INFO "
+  switch {
+  case r.Level >= slog.LevelError: label = "ERROR"
+  case r.Level >= slog.LevelWarn: label = "WARN "
+  case r.Level < slog.LevelInfo: label = "DEBUG"
+  }
+  h.mu.Lock()
+  defer h.mu.Unlock()
+  _, err := fmt.Fprintf(h.w, "%s %s %s\n", r.Time.Format("2006/01/02 15:04:05"), label, r.Message)
+  return err
+}
+
+func (h *text) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *text) WithGroup(string) slog.Handler      { return h }
+
+// fanout sends each record to every handler that wants it
+type fanout []slog.Handler
+
+func (f fanout) Enabled(ctx context.Context, l slog.Level) bool {
+  for _, h := range f {
+    if h.Enabled(ctx, l) { return true }
+  }
+  return false
+}
+
+func (f fanout) Handle(ctx context.Context, r slog.Record) error {
+  var first error
+  for _, h := range f {
+    if !h.Enabled(ctx, r.Level) { continue }
+    if err := h.Handle(ctx, r.Clone()); err != nil && first == nil { first = err }
+  }
+  return first
+}
+
+func (f fanout) WithAttrs(as []slog.Attr) slog.Handler {
+  out := make(fanout, len(f))
+  for i, h := range f { out[i] = h.WithAttrs(as) }
+  return out
+}
+
+func (f fanout) WithGroup(name string) slog.Handler {
+  out := make(fanout, len(f))
+  for i, h := range f { out[i] = h.WithGroup(name) }
+  return out
+}
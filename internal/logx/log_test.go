@@ -0,0 +1,63 @@
+package logx
+
+import (
+  "bufio"
+  "encoding/json"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+func TestFileGetsJSONWithAttributes(t *testing.T) {
+  dir := t.TempDir()
+  l, err := Open(Options{Level: "warn", Dir: dir})
+  if err != nil { t.Fatal(err) }
+  run := l.With("run", "20261019T101500.000")
+  run.Infof("below the level")
+  run.Warnf("skip (exists): %s", "1x01.mkv")
+  if err := l.Close(); err != nil { t.Fatal(err) }
+
+  b, err := os.ReadFile(filepath.Join(dir, "tvrn.log"))
+  if err != nil { t.Fatal(err) }
+  lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+  if len(lines) != 1 { t.Fatalf("got %d lines, want 1:\n%s", len(lines), b) }
+  var rec map[string]any
+  if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil { t.Fatal(err) }
+  if rec["level"] != "WARN" || rec["msg"] != "skip (exists): 1x01.mkv" || rec["run"] != "20261019T101500.000" {
+    t.Errorf("record = %v", rec)
+  }
+}
+
+func TestRotation(t *testing.T) {
+  dir := t.TempDir()
+  r, err := openRotating(dir, "tvrn.log", 100, 2)
+  if err != nil { t.Fatal(err) }
+  line := []byte(strings.Repeat("x", 59) + "\n")
+  for i := 0; i < 7; i++ {
+    if _, err := r.Write(line); err != nil { t.Fatal(err) }
+  }
+  r.Close()
+
+  // 60-byte lines in 100-byte files: one per file, the oldest past keep dropped
+  for _, name := range []string{"tvrn.log", "tvrn.log.1", "tvrn.log.2"} {
+    if n := countLines(t, filepath.Join(dir, name)); n != 1 { t.Errorf("%s has %d lines, want 1", name, n) }
+  }
+  if _, err := os.Stat(filepath.Join(dir, "tvrn.log.3")); !os.IsNotExist(err) { t.Errorf("tvrn.log.3 kept past keep=2") }
+}
+
+func TestNilLoggerIsSilent(t *testing.T) {
+  var l *Logger
+  l.With("run", "x").Errorf("nothing %d", 1)
+  if l.Enabled(ParseLevel("error")) { t.Error("nil logger reports enabled") }
+}
+
+func countLines(t *testing.T, path string) int {
+  t.Helper()
+  f, err := os.Open(path)
+  if err != nil { t.Fatal(err) }
+  defer f.Close()
+  n := 0
+  for s := bufio.NewScanner(f); s.Scan(); { n++ }
+  return n
+}
@@ -0,0 +1,76 @@
+package logx
+
+import (
+  "fmt"
+  "os"
+  "path/filepath"
+  "sync"
+)
+
+// rotating appends to a log file and, once it passes max bytes, shifts it to name.1,
+// name.1 to name.2 and so on, dropping what is past keep
+type rotating struct {
+  mu   sync.Mutex
+  path string
+  max  int64
+  keep int
+  f    *os.File
+  size int64
+}
+
+func openRotating(dir, name string, max int64, keep int) (*rotating, error) {
+  if max <= 0 { max = 10 << 20 }
+  if keep < 0 { keep = 0 }
+  if err := os.MkdirAll(dir, 0o755); err != nil { return nil, err }
+  r := &rotating{path: filepath.Join(dir, name), max: max, keep: keep}
+  if err := r.open(); err != nil { return nil, err }
+  return r, nil
+}
+
+func (r *rotating) open() error {
+  f, err := os.OpenFile(r.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+  if err != nil { return err }
+  st, err := f.Stat()
+  if err != nil {
+    f.Close()
+    return err
+  }
+  r.f, r.size = f, st.Size()
+  return nil
+}
+
+func (r *rotating) Write(p []byte) (int, error) {
+  r.mu.Lock()
+  defer r.mu.Unlock()
+  if r.f == nil { return 0, os.ErrClosed }
+  if r.size > 0 && r.size+int64(len(p)) > r.max {
+    if err := r.rotate(); err != nil { return 0, err }
+  }
+  n, err := r.f.Write(p)
+  r.size += int64(n)
+  return n, err
+}
+
+func (r *rotating) rotate() error {
+  r.f.Close()
+  r.f = nil
+  if r.keep == 0 {
+    os.Remove(r.path)
+  } else {
+    os.Remove(fmt.Sprintf("%s.%d", r.path, r.keep))
+    for i := r.keep - 1; i >= 1; i-- {
+      os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+    }
+    os.Rename(r.path, r.path+".1")
+  }
+  return r.open()
+}
+
+func (r *rotating) Close() error {
+  r.mu.Lock()
+  defer r.mu.Unlock()
+  if r.f == nil { return nil }
+  err := r.f.Close()
+  r.f = nil
+  return err
+}
@@ -2,6 +2,7 @@ package parse
 
 import (
   "path/filepath"
+  "slices"
   "strconv"
   "strings"
 )
@@ -10,33 +11,71 @@ type Parsed struct {
   Show     string
   Season   int
   Episode  int
-  Episode2 int // end of range; 0 means single
+  Episode2 int   // last episode of a multi-episode file; 0 means single
+  Episodes []int // every episode in the file, ascending
+  Segment  string // which file of a split episode this is: a, b, c…; empty for a whole episode
+  Rest     string // the name after the episode number: usually the title, then release tags
   Ext      string
   Raw      string
+  Rule     string   // the pattern that matched, e.g. SxxEyy, XxYY or NNN
+  Match    []string // what it matched, then its captures
 }
 
 func atoi(s string) int { i, _ := strconv.Atoi(s); return i }
 
+// FromFilename parses name with the built-in patterns
 func FromFilename(name string, seasonHint int, showHint string) (Parsed, bool) {
+  return Default.Parse(name, seasonHint, showHint)
+}
+
+// Parse reads the season and episode numbers from a filename. seasonHint is the season
+// the folder gives, or 0; patterns without a season group use it, or season 1 for a
+// miniseries' "Part 2" when there is none.
+func (ps *Parser) Parse(name string, seasonHint int, showHint string) (Parsed, bool) {
   p := Parsed{Raw: name, Ext: strings.TrimPrefix(filepath.Ext(name), ".")}
   base := strings.TrimSuffix(name, filepath.Ext(name))
   s := base
 
-  if m := reSxxExx.FindStringSubmatch(s); len(m) > 0 {
-    p.Season = atoi(m[1])
-    p.Episode = atoi(m[2])
-    if len(m) > 3 && m[3] != "" { p.Episode2 = atoi(m[3]) }
-  } else if m := reXxYY.FindStringSubmatch(s); len(m) > 0 {
-    p.Season = atoi(m[1])
-    p.Episode = atoi(m[2])
-    if len(m) > 3 && m[3] != "" { p.Episode2 = atoi(m[3]) }
-  } else if m := reNNN.FindStringSubmatch(s); len(m) > 0 && seasonHint > 0 {
-    p.Season = seasonHint
-    p.Episode = atoi(m[2])
-    if len(m) > 3 && m[3] != "" { p.Episode2 = atoi(m[3]) }
-  } else {
-    return Parsed{}, false
+  matched := false
+  for _, pt := range ps.patterns {
+    idx := pt.re.FindStringSubmatchIndex(s)
+    if idx == nil { continue }
+    m := make([]string, len(idx)/2)
+    for i := range m {
+      if idx[2*i] >= 0 { m[i] = s[idx[2*i]:idx[2*i+1]] }
+    }
+    group := func(g string) string {
+      if i := pt.re.SubexpIndex(g); i > 0 { return m[i] }
+      return ""
+    }
+    if group("episode") == "" { continue }
+    season := seasonHint
+    if g := group("season"); g != "" {
+      season = atoi(g)
+    } else if seasonHint <= 0 {
+      if pt.hinted { continue }
+      season = 1
+    }
+    p.Season, p.Episode = season, atoi(group("episode"))
+    p.Episodes = episodes(season, p.Episode, group("episode2"), group("episodes"))
+    p.Episode = p.Episodes[0] // a list is sorted, so the first named may not be the first
+    if n := len(p.Episodes); n > 1 { p.Episode2 = p.Episodes[n-1] }
+    p.Segment = segment(group("segment"))
+    rest := idx[1]
+    if p.Segment == "" && pt.Name != "Part" && len(p.Episodes) == 1 {
+      // "pt1" and the like straight after the episode number
+      end := idx[2*pt.re.SubexpIndex("episode")+1]
+      if sm := reSegment.FindStringSubmatchIndex(s[end:]); sm != nil {
+        p.Segment = segment(s[end+sm[2] : end+sm[3]])
+        rest = max(rest, end+sm[3])
+      }
+    }
+    p.Rule, p.Match = pt.Name, append([]string{strings.Trim(m[0], " ._-[]()")}, m[1:]...)
+    p.Rest = s[rest:]
+    matched = true
+    break
   }
+  if !matched { return Parsed{}, false }
 
   // Heuristic for show name: prefer hint, else folder name segments before match
   if showHint != "" {
@@ -48,3 +87,54 @@ func FromFilename(name string, seasonHint int, showHint string) (Parsed, bool) {
   }
   return p, true
 }
+
+// segment normalises a split episode's part to a letter: "b" and "2" are both "b"
+func segment(g string) string {
+  g = strings.ToLower(g)
+  if g == "" { return "" }
+  if n := atoi(g); n > 0 {
+    if n > 26 { return "" }
+    return string(rune('a' + n - 1))
+  }
+  return g[:1]
+}
+
+// episodes expands a file's episode numbers: the first, then either the end of a range or
+// a run such as "E02E03" (a list) or "-E04" (a range), in order. A range that goes
+// backwards, a step naming another season, or one implausibly far away ends the run.
+func episodes(season, first int, end, more string) []int {
+  out := []int{first}
+  last := first
+  add := func(n int, isRange bool) bool {
+    if isRange {
+      if n <= last || n-last > maxRange { return false }
+      for e := last + 1; e <= n; e++ { out = append(out, e) }
+    } else {
+      if n <= 0 || max(n, first)-min(n, first) > maxRange { return false }
+      out = append(out, n)
+    }
+    last = n
+    return true
+  }
+  if end != "" { add(atoi(end), true) }
+  for _, m := range reMore.FindAllStringSubmatch(more, -1) {
+    if s := m[2] + m[3]; s != "" && atoi(s) != season { break }
+    if !add(atoi(m[4]), m[1] == "-") { break }
+  }
+  slices.Sort(out)
+  return slices.Compact(out)
+}
+
+// ShowName pulls the series name out of a release or download name,
+// e.g. "Firefly.2002.S01.1080p.BluRay" -> "Firefly (2002)". It returns "" when
+// the name carries no season or episode marker to cut at.
+func ShowName(release string) string {
+  loc := reRelease.FindStringIndex(release)
+  if loc == nil || loc[0] == 0 { return "" }
+  name := strings.NewReplacer(".", " ", "_", " ").Replace(release[:loc[0]])
+  name = strings.Join(strings.Fields(strings.Trim(name, " -")), " ")
+  if m := reYear.FindStringSubmatch(name); m != nil {
+    return m[1] + " (" + m[2] + ")"
+  }
+  return name
+}
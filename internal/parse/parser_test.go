@@ -0,0 +1,147 @@
+package parse
+
+import (
+  "slices"
+  "testing"
+)
+
+func TestFromFilename(t *testing.T) {
+  tests := []struct {
+    name     string
+    hint     int
+    ok       bool
+    season   int
+    ep, ep2  int
+    ext      string
+  }{
+    {"Firefly.S01E03.1080p.WEB-DL.mkv", 0, true, 1, 3, 0, "mkv"},
+    {"firefly.s01e03.mkv", 0, true, 1, 3, 0, "mkv"},
+    {"Firefly.S01E01E02.1080p.WEB-DL.mkv", 0, true, 1, 1, 2, "mkv"},
+    {"Firefly.S01E01-02.mkv", 0, true, 1, 1, 2, "mkv"},
+    {"Firefly.1x04.720p.HDTV.mkv", 0, true, 1, 4, 0, "mkv"},
+    {"1x05 - Out of Gas.mkv", 0, true, 1, 5, 0, "mkv"},
+    {"Firefly 1x01-02.avi", 0, true, 1, 1, 2, "avi"},
+    {"Firefly 104.mp4", 1, true, 1, 4, 0, "mp4"},
+    {"Firefly 104.mp4", 0, false, 0, 0, 0, ""}, // three digits need the season from the folder
+    {"Firefly - Serenity.mkv", 1, false, 0, 0, 0, ""},
+    {"One.Piece.S01E1071.mkv", 0, true, 1, 1071, 0, "mkv"},
+    {"Doctor.Who.S01E100.mkv", 0, true, 1, 100, 0, "mkv"},
+    {"Taskmaster.S2024E05.mkv", 0, true, 2024, 5, 0, "mkv"},
+    {"Firefly S01 E03.mkv", 0, true, 1, 3, 0, "mkv"},
+    {"Firefly.S01E01-E02.mkv", 0, true, 1, 1, 2, "mkv"},
+    {"Show 3x101.mkv", 0, true, 3, 101, 0, "mkv"},
+    {"Chernobyl.Part.3.mkv", 0, true, 1, 3, 0, "mkv"},
+    {"Band of Brothers Pt.2.mkv", 0, true, 1, 2, 0, "mkv"},
+    {"Planet Earth - Episode 11.mkv", 2, true, 2, 11, 0, "mkv"},
+    {"Planet.Earth.Ep05.mkv", 0, true, 1, 5, 0, "mkv"},
+    {"Counterpart 2.mkv", 1, false, 0, 0, 0, ""},
+    {"Firefly 1920x1080.mkv", 0, false, 0, 0, 0, ""},
+    {"Firefly 1080p.mkv", 1, false, 0, 0, 0, ""},
+  }
+  for _, tt := range tests {
+    p, ok := FromFilename(tt.name, tt.hint, "")
+    if ok != tt.ok {
+      t.Errorf("FromFilename(%q, %d) ok = %v, want %v", tt.name, tt.hint, ok, tt.ok)
+      continue
+    }
+    if !ok { continue }
+    if p.Season != tt.season || p.Episode != tt.ep || p.Episode2 != tt.ep2 || p.Ext != tt.ext {
+      t.Errorf("FromFilename(%q, %d) = S%dE%d-%d .%s, want S%dE%d-%d .%s",
+        tt.name, tt.hint, p.Season, p.Episode, p.Episode2, p.Ext, tt.season, tt.ep, tt.ep2, tt.ext)
+    }
+  }
+
+  if p, _ := FromFilename("Firefly.S01E03.mkv", 0, "Firefly"); p.Show != "Firefly" {
+    t.Errorf("show hint ignored: %q", p.Show)
+  }
+}
+
+func TestFromFilenameEpisodeLists(t *testing.T) {
+  tests := []struct {
+    name string
+    want []int
+  }{
+    {"Firefly.S01E01E02E03.mkv", []int{1, 2, 3}},
+    {"Firefly.S01E01-E04.mkv", []int{1, 2, 3, 4}},
+    {"Firefly.S01E01-04.mkv", []int{1, 2, 3, 4}},
+    {"Firefly.S01E01E03.mkv", []int{1, 3}},
+    {"Firefly.S01E01E02-E04.mkv", []int{1, 2, 3, 4}},
+    {"Firefly.1x01x02x03.mkv", []int{1, 2, 3}},
+    {"Firefly.S01E05-1080p.mkv", []int{5}},  // not a range of 1075 episodes
+    {"Firefly.S01E05-E03.mkv", []int{5}},    // a backwards range ends the run
+    {"Firefly.S01E03E02.mkv", []int{2, 3}},  // a list is put in order
+    {"Firefly.S01E05E03.mkv", []int{3, 5}},
+    {"Firefly.S01E02E02.mkv", []int{2}},
+    {"Firefly.S01E01-S01E02.mkv", []int{1, 2}},
+    {"Firefly.S01E01-S01E03.mkv", []int{1, 2, 3}},
+    {"Firefly.S01E01S01E02.mkv", []int{1, 2}},
+    {"Firefly.S01E01-S02E01.mkv", []int{1}}, // another season ends the run
+    {"Firefly.1x01-1x02.mkv", []int{1, 2}},
+    {"Firefly.1x01-1x03.mkv", []int{1, 2, 3}},
+    {"Firefly.1x01-2x01.mkv", []int{1}},
+  }
+  for _, tt := range tests {
+    p, ok := FromFilename(tt.name, 0, "")
+    if !ok || !slices.Equal(p.Episodes, tt.want) {
+      t.Errorf("FromFilename(%q) episodes = %v, %v; want %v", tt.name, p.Episodes, ok, tt.want)
+      continue
+    }
+    if p.Episode != tt.want[0] { t.Errorf("FromFilename(%q) Episode = %d, want %d", tt.name, p.Episode, tt.want[0]) }
+    if last := tt.want[len(tt.want)-1]; len(tt.want) > 1 && p.Episode2 != last {
+      t.Errorf("FromFilename(%q) Episode2 = %d, want %d", tt.name, p.Episode2, last)
+    }
+  }
+}
+
+func TestFromFilenameSegments(t *testing.T) {
+  tests := []struct{ name, want string }{
+    {"Peppa.Pig.S01E01a.mkv", "a"},
+    {"Peppa.Pig.S01E01B.720p.mkv", "b"},
+    {"Peppa Pig 1x01b.mkv", "b"},
+    {"Show.S01E05.pt1.mkv", "a"},
+    {"Show.S01E05-Part2.mkv", "b"},
+    {"Show.1x05.cd2.avi", "b"},
+    {"1x01a - Muddy Puddles (1).mkv", "a"},
+    {"1x14 - Heroes Part 2.mkv", ""}, // a title, not a segment
+    {"Show.S01E05.Bluray.mkv", ""},
+    {"Chernobyl.Part.2.mkv", ""}, // a miniseries episode
+  }
+  for _, tt := range tests {
+    p, ok := FromFilename(tt.name, 1, "")
+    if !ok || p.Segment != tt.want { t.Errorf("FromFilename(%q) segment = %q, %v; want %q", tt.name, p.Segment, ok, tt.want) }
+  }
+}
+
+func TestShowName(t *testing.T) {
+  tests := []struct{ in, want string }{
+    {"Firefly.S01.1080p.BluRay", "Firefly"},
+    {"Firefly.2002.S01.1080p.BluRay", "Firefly (2002)"},
+    {"Firefly (2002) - S01E03 - Our Mrs. Reynolds", "Firefly (2002)"},
+    {"The_Expanse_S02E01_720p", "The Expanse"},
+    {"Doctor.Who.2005.1x01.Rose", "Doctor Who (2005)"},
+    {"Firefly Season 1 Complete", "Firefly"},
+    {"Firefly.S01E01E02.1080p", "Firefly"},
+    {"S01E01.Pilot", ""},
+    {"Serenity.2005.1080p.BluRay", ""},
+  }
+  for _, tt := range tests {
+    if got := ShowName(tt.in); got != tt.want { t.Errorf("ShowName(%q) = %q, want %q", tt.in, got, tt.want) }
+  }
+}
+
+func TestUserPatterns(t *testing.T) {
+  anime, err := Compile("anime", `\] (?P<episode>\d{2,4}) \[`, 200)
+  if err != nil { t.Fatal(err) }
+  ps := NewParser([]Pattern{anime}, "NNN")
+
+  p, ok := ps.Parse("[Group] 105 [1080p].mkv", 1, "")
+  if !ok || p.Rule != "anime" || p.Season != 1 || p.Episode != 105 { t.Errorf("anime: %+v, %v", p, ok) }
+  if p, ok := ps.Parse("Firefly 104.mkv", 1, ""); ok { t.Errorf("disabled NNN still matched: %+v", p) }
+  if p, _ := ps.Parse("[Group] Show S02E03 [1080p].mkv", 0, ""); p.Rule != "SxxEyy" || p.Episode != 3 {
+    t.Errorf("built-in lost to a user pattern that did not match: %+v", p)
+  }
+
+  for _, bad := range []string{`(?P<episode>\d+`, `(?P<ep>\d+)`, `(?P<season>\d+)`} {
+    if _, err := Compile("bad", bad, 0); err == nil { t.Errorf("Compile(%q) accepted", bad) }
+  }
+}
@@ -1,9 +1,89 @@
 package parse
 
-import "regexp"
+import (
+  "fmt"
+  "regexp"
+  "sort"
+)
 
 var (
-  reSxxExx = regexp.MustCompile(`(?i)S(\d{1,2})E(\d{1,2})(?:[\-E](\d{1,2}))?`)
-  reXxYY   = regexp.MustCompile(`(?i)(\d{1,2})x(\d{1,2})(?:[\-x](\d{1,2}))?`)
-  reNNN    = regexp.MustCompile(`(?i)(\d)(\d{2})(?:-(\d{2}))?`) // needs season context
+  // reMore reads one step of an episodes group: "-04", "-E04", "-S01E04" or "-1x04" ends a
+  // range, "E04", "x04" or "S01E04" adds one; the season, when repeated, is captured
+  reMore = regexp.MustCompile(`(?i)(-)?(?:s(\d{1,4})e|(\d{1,4})x|[ex])?(\d{1,4})`)
+
+  // reSegment reads a split episode's part straight after its number: "S01E05.pt1",
+  // "1x05-part2", "S01E05.cd1". A spaced " - Part 2" is a title, so it is left alone.
+  reSegment = regexp.MustCompile(`(?i)^[._ \-]?(?:pt|part|cd)[._ ]?([1-9])(?:\D|$)`)
+
+  // reRelease marks where the show name ends in a release name: S01, S01E02, 1x02, Season 1
+  reRelease = regexp.MustCompile(`(?i)[ ._\-\[(]+(?:S\d{1,4}(?:[E\-]\d{1,4})*|\d{1,2}x\d{2}|season[ ._\-]?\d{1,2})(?:[\W_]|$)`)
+  reYear    = regexp.MustCompile(`^(.+?)[ (]+((?:19|20)\d{2})\)?$`)
 )
+
+// Pattern is one rule of the filename parser. Its expression names what it captures with
+// the groups season, episode, episode2 for the end of a range, episodes for a run of
+// more such as E02E03, -04, -S01E04 or -1x04, and segment for one file of a split episode (a, b or 1, 2);
+// episode is required. Without a season group the season comes from the caller's hint.
+type Pattern struct {
+  Name     string
+  Priority int // higher runs first
+  re       *regexp.Regexp
+  hinted   bool // only applies when the caller knows the season, as for 104
+}
+
+// The built-in patterns. Numbers run to four digits for long-running shows (S01E100)
+// and seasons named by year (S2024E05).
+var builtins = []Pattern{
+  {Name: "SxxEyy", Priority: 100, re: regexp.MustCompile(`(?i)S(?P<season>\d{1,4})[ ._]?E(?P<episode>\d{1,4})(?P<episodes>(?:(?:-?S\d{1,4}E|-?E|-)\d{1,4})*)(?:(?P<segment>[a-d])(?:[^a-z]|$))?`)},
+  {Name: "XxYY", Priority: 90, re: regexp.MustCompile(`(?i)(?:^|\D)(?P<season>\d{1,2})x(?P<episode>\d{1,4})(?P<episodes>(?:(?:-\d{1,2}x|[\-x])\d{1,4})*)(?:(?P<segment>[a-d])(?:[^a-z]|$)|\D|$)`)},
+  {Name: "Part", Priority: 60, re: regexp.MustCompile(`(?i)(?:^|[^a-z])(?:part|pt)[ ._]?(?P<episode>\d{1,3})(?:\D|$)`)},
+  {Name: "Episode", Priority: 50, re: regexp.MustCompile(`(?i)(?:^|[^a-z])(?:episode|ep)[ ._]?(?P<episode>\d{1,4})(?:\D|$)`)},
+  {Name: "NNN", Priority: 10, re: regexp.MustCompile(`(?:^|\D)\d(?P<episode>\d{2})(?:-(?P<episode2>\d{2}))?(?:\D|$)`), hinted: true},
+}
+
+// maxRange caps how many episodes a range may span, so "S01E01-1080p" isn't read as 1080 episodes
+const maxRange = 50
+
+// Builtins lists the names of the built-in patterns, highest priority first
+func Builtins() []string {
+  out := make([]string, len(builtins))
+  for i, p := range builtins { out[i] = p.Name }
+  return out
+}
+
+// Compile builds a user pattern, checking its groups
+func Compile(name, expr string, priority int) (Pattern, error) {
+  re, err := regexp.Compile(expr)
+  if err != nil { return Pattern{}, err }
+  hasEpisode := false
+  for _, g := range re.SubexpNames()[1:] {
+    switch g {
+    case "episode": hasEpisode = true
+    case "", "season", "episode2", "episodes", "segment":
+    default: return Pattern{}, fmt.Errorf("unknown group (?P<%s>); use season, episode, episode2, episodes and segment", g)
+    }
+  }
+  if !hasEpisode { return Pattern{}, fmt.Errorf("no (?P<episode>...) group") }
+  return Pattern{Name: name, Priority: priority, re: re}, nil
+}
+
+// Parser tries its patterns in priority order; the first to match wins
+type Parser struct {
+  patterns []Pattern
+}
+
+// NewParser combines the built-in patterns, less those named in disable, with user patterns.
+// On equal priority user patterns run first.
+func NewParser(user []Pattern, disable ...string) *Parser {
+  off := map[string]bool{}
+  for _, d := range disable { off[d] = true }
+  ps := append([]Pattern(nil), user...)
+  for _, b := range builtins {
+    if !off[b.Name] { ps = append(ps, b) }
+  }
+  sort.SliceStable(ps, func(i, j int) bool { return ps[i].Priority > ps[j].Priority })
+  return &Parser{patterns: ps}
+}
+
+// Default is the parser with only the built-in patterns
+var Default = NewParser(nil)
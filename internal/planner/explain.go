@@ -0,0 +1,63 @@
+package planner
+
+// Explain records why Plan proposed what it did: how the series was picked and what
+// happened to each file in the folder. It backs --explain and the API's explain field.
+type Explain struct {
+  Folder     string       `json:"folder"`
+  Query      string       `json:"query"`                // series name searched for
+  Year       int          `json:"year,omitempty"`       // year hint from the folder name
+  Provider   string       `json:"provider"`
+  Candidates []Candidate  `json:"candidates"`
+  Season     int          `json:"season"`               // season looked up, 0 for all
+  SeasonFrom string       `json:"seasonFrom,omitempty"` // where Season came from: flag, folder, pin, files or empty for none
+  Conflicts  []string     `json:"conflicts,omitempty"`  // season sources that disagreed with SeasonFrom
+  Order      string       `json:"order"`
+  Orders     []OrderScore `json:"orders,omitempty"`     // how each order scored under --order auto
+  Episodes   int          `json:"episodes"`             // episodes the provider returned for Season
+  Files      []FileTrace  `json:"files"`
+  Error      string       `json:"error,omitempty"`      // why planning stopped, when it did
+}
+
+// Candidate is one search hit and how it scored; the highest score is picked
+type Candidate struct {
+  ID     int    `json:"id"`
+  Name   string `json:"name"`
+  Year   int    `json:"year,omitempty"`
+  Score  int    `json:"score"`
+  Why    string `json:"why"`
+  Picked bool   `json:"picked,omitempty"`
+}
+
+// OrderScore is how well one episode order fits the files, for --order auto
+type OrderScore struct {
+  Order       string `json:"order"`
+  Score       int    `json:"score"`
+  Known       int    `json:"known"`       // file numbers the order has
+  Unknown     int    `json:"unknown"`     // and those it doesn't
+  Titles      int    `json:"titles"`      // titles in names that agree with their numbers
+  TitleMisses int    `json:"titleMisses"` // titles naming another episode of the order
+  Runtime     int    `json:"runtime"`     // long files matching long episodes, less those that don't
+  Why         string `json:"why"`
+  Picked      bool   `json:"picked,omitempty"`
+}
+
+// FileTrace follows one file from its name to the outcome
+type FileTrace struct {
+  File       string   `json:"file"`
+  Rule       string   `json:"rule,omitempty"`       // pattern that matched
+  Captures   []string `json:"captures,omitempty"`   // the match, then its groups
+  Season     int      `json:"season,omitempty"`
+  SeasonFrom string   `json:"seasonFrom,omitempty"` // filename, or the folder's source for bare or overruled numbers
+  Conflict   string   `json:"conflict,omitempty"`   // a season source the file disagreed with
+  Episode    int      `json:"episode,omitempty"`
+  Episode2   int      `json:"episode2,omitempty"`
+  Episodes   []int    `json:"episodes,omitempty"`   // every episode, when several
+  Segment    string   `json:"segment,omitempty"`    // a, b… for one file of a split episode
+  Lookup     string   `json:"lookup,omitempty"`     // what the provider has for the episode(s)
+  Title      string   `json:"title,omitempty"`      // the title read from the name, when it picked the episode
+  Score      float64  `json:"score,omitempty"`      // how alike that title was, from 0 to 1
+  Mismatch   string   `json:"mismatch,omitempty"`   // the episode the title named, when the number named another
+  Result     string   `json:"result"`               // rename, move, already named, skipped, ignored
+  Why        string   `json:"why,omitempty"`        // the reason for a skip or ignore
+  To         string   `json:"to,omitempty"`         // the formatted name
+}
@@ -12,14 +12,22 @@ type Options struct {
 type Item struct {
   From     string
   To       string
-  Reason   string // e.g. rename, collision-skip
+  Reason   string // e.g. rename, folder, undo, collision-skip
   S        int    // season (for sorting)
   E1       int    // first episode (for sorting)
-  E2       int    // second episode if range, else 0 (for sorting)
+  E2       int    // last episode if several, else 0 (for sorting)
+  Eps      []int  // every episode when several, e.g. 1, 2, 3 for 1x01-03
+  Seg      string // which file of a split episode, e.g. "a" for 1x01a
 }
 
+// Plan items are applied in order; folder renames come after the files inside them.
 type Plan struct {
-  Items []Item
+  Items    []Item
+  Undo     string   // run ID being reverted, when this is an undo plan
+  SeriesID int      // provider ID of the series the items were matched against
+  Series   string
+  Order    string   // episode order the items were matched in
+  Explain  *Explain // how the plan was reached; set by Runner.Plan, also when it fails past the search
 }
 
 type Stats struct {
@@ -0,0 +1,130 @@
+package runner
+
+import (
+  "context"
+  "fmt"
+  "os"
+  "path/filepath"
+  "regexp"
+  "strings"
+
+  "github.com/GizzmoShifu/tvrn/internal/planner"
+  "github.com/GizzmoShifu/tvrn/internal/state"
+  "github.com/GizzmoShifu/tvrn/internal/tvdb"
+)
+
+// seasonDirRe matches "Season 1", "season 01", "S1", "Series 2", "Staffel 3" and "Specials"
+var seasonDirRe = regexp.MustCompile(`(?i)^(?:s|season|series|staffel|saison|temporada|stagione)[\s._-]*(\d{1,4})$|^specials$`)
+
+// IsSeasonDir reports whether a folder name looks like a season folder.
+func IsSeasonDir(name string) bool { return seasonDirRe.MatchString(strings.TrimSpace(name)) }
+
+// seasonFromDir returns the season number named by a season folder. Specials is season 0
+func seasonFromDir(name string) (int, bool) {
+  m := seasonDirRe.FindStringSubmatch(strings.TrimSpace(name))
+  if m == nil { return 0, false }
+  n := 0
+  if m[1] != "" { fmt.Sscanf(m[1], "%d", &n) }
+  return n, true
+}
+
+// seasonFolderName renders the configured season folder pattern. Season 0 is always "Specials"
+func seasonFolderName(pattern string, season int) string {
+  if season == 0 { return "Specials" }
+  if pattern == "" { pattern = "Season %02d" }
+  if !strings.Contains(pattern, "%") { pattern += " %d" }
+  return sanitiseTitle(fmt.Sprintf(pattern, season))
+}
+
+// seriesFolderName builds the canonical "Name (Year)" with an optional ID tag such as
+// [tvdbid-N]. TVDB IDs are preferred, then TMDB, IMDb and finally the provider's own ID.
+func seriesFolderName(show tvdb.Series, withID bool, provider string) string {
+  name := strings.TrimSpace(show.Name)
+  if show.Year > 0 && !strings.HasSuffix(name, fmt.Sprintf("(%d)", show.Year)) {
+    name = fmt.Sprintf("%s (%d)", name, show.Year)
+  }
+  if withID {
+    switch {
+    case show.IDs.TVDB > 0:
+      name = fmt.Sprintf("%s [tvdbid-%d]", name, show.IDs.TVDB)
+    case show.IDs.TMDB > 0:
+      name = fmt.Sprintf("%s [tmdbid-%d]", name, show.IDs.TMDB)
+    case show.IDs.IMDb != "":
+      name = fmt.Sprintf("%s [imdbid-%s]", name, show.IDs.IMDb)
+    case show.ID > 0:
+      name = fmt.Sprintf("%s [%sid-%d]", name, provider, show.ID)
+    }
+  }
+  return sanitiseTitle(name)
+}
+
+// siblingSeasonDir finds the existing folder for a season next to the current one,
+// or names a new one with the configured pattern. Apply creates it when needed.
+func (r *Runner) siblingSeasonDir(seriesDir string, season int) string {
+  if entries, err := os.ReadDir(seriesDir); err == nil {
+    for _, e := range entries {
+      if !e.IsDir() { continue }
+      if n, ok := seasonFromDir(e.Name()); ok && n == season {
+        return filepath.Join(seriesDir, e.Name())
+      }
+    }
+  }
+  return filepath.Join(seriesDir, seasonFolderName(r.cfg.Rename.SeasonFolder, season))
+}
+
+// planFolders proposes season and series folder renames for a directory already planned.
+// Season folders go first so the series rename does not move them out from under us.
+func (r *Runner) planFolders(root string, inSeason bool, season int, show tvdb.Series, provider string, withSeries bool) []planner.Item {
+  if !r.cfg.Rename.Folders { return nil }
+  var items []planner.Item
+
+  seriesDir := root
+  if inSeason {
+    seriesDir = filepath.Dir(root)
+    want := seasonFolderName(r.cfg.Rename.SeasonFolder, season)
+    if !sameFileName(filepath.Base(root), want) {
+      items = append(items, planner.Item{
+        From: root, To: filepath.Join(seriesDir, want), Reason: "folder", S: season,
+      })
+    }
+  }
+
+  if withSeries {
+    want := seriesFolderName(show, r.cfg.Rename.SeriesFolderID, provider)
+    if want != "" && !sameFileName(filepath.Base(seriesDir), want) {
+      items = append(items, planner.Item{
+        From: seriesDir, To: filepath.Join(filepath.Dir(seriesDir), want), Reason: "folder",
+      })
+    }
+  }
+  return items
+}
+
+// PlanSeriesFolder plans only the series folder rename for a series root.
+// Series mode uses it once every season has been processed.
+func (r *Runner) PlanSeriesFolder(ctx context.Context, root string) (planner.Plan, error) {
+  if !r.cfg.Rename.Folders { return planner.Plan{}, nil }
+  name, year := splitYear(filepath.Base(root))
+  ctx = r.runCtx(ctx)
+  c, err := r.client(ctx)
+  if err != nil { return planner.Plan{}, err }
+  show, _, err := r.findSeries(ctx, c, name, year)
+  if err != nil { return planner.Plan{}, err }
+  return planner.Plan{Items: r.planFolders(root, false, 0, show, providerName(c), true)}, nil
+}
+
+// PlanUndo builds a plan that reverts the most recent applied run, newest change first.
+// Paths are not checked here: earlier undo steps may be what restores them.
+func (r *Runner) PlanUndo() (planner.Plan, error) {
+  id, recs, err := state.LastRun(r.cfg.Home)
+  if err != nil { return planner.Plan{}, err }
+  if len(recs) == 0 { return planner.Plan{}, fmt.Errorf("nothing to undo") }
+
+  p := planner.Plan{Undo: id}
+  for i := len(recs) - 1; i >= 0; i-- {
+    rec := recs[i]
+    if rec.Error != "" { continue }
+    p.Items = append(p.Items, planner.Item{From: rec.After, To: rec.Before, Reason: "undo"})
+  }
+  return p, nil
+}
@@ -0,0 +1,97 @@
+package runner
+
+import (
+  "regexp"
+  "sort"
+  "strings"
+  "unicode"
+
+  "github.com/GizzmoShifu/tvrn/internal/tvdb"
+)
+
+const titleMargin = 0.05 // how far the best title must lead the next to count
+
+var (
+  // reTags marks where a release name's title ends and its quality and group tags begin
+  reTags = regexp.MustCompile(`(?i)(?:^|[\s._\-\[(])(?:480p|576p|720p|1080p|2160p|4k|uhd|web|web-?dl|web-?rip|hdtv|pdtv|blu-?ray|bdrip|brrip|dvdrip|dvd|x26[45]|h\.?26[45]|hevc|xvid|aac|ac3|dts|proper|repack|internal)(?:[\s._\-\])]|$)`)
+  reBrackets = regexp.MustCompile(`\[[^\]]*\]|\((?:19|20)\d{2}\)`)
+)
+
+// titleText pulls the episode title out of what is left of a filename once the episode
+// number is gone: release tags, bracketed groups and a leading series name are dropped.
+func titleText(s, show string) string {
+  s = reBrackets.ReplaceAllString(s, " ")
+  if loc := reTags.FindStringIndex(s); loc != nil { s = s[:loc[0]] }
+  t := normTitle(s)
+  if n := normTitle(show); n != "" && (t == n || strings.HasPrefix(t, n+" ")) {
+    t = strings.TrimSpace(t[len(n):])
+  }
+  return t
+}
+
+// normTitle lowercases a title and reduces it to words: "Our Mrs. Reynolds" -> "our mrs reynolds"
+func normTitle(s string) string {
+  s = strings.NewReplacer("'", "", "’", "", "&", " and ").Replace(strings.ToLower(s))
+  return strings.Join(strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }), " ")
+}
+
+// titleScore rates how alike two normalised titles are, from 0 to 1. A longer name that
+// holds the whole title as words, as "out of gas extended" does "out of gas", scores 0.9.
+func titleScore(a, b string) float64 {
+  if a == "" || b == "" { return 0 }
+  if a == b { return 1 }
+  ra, rb := []rune(a), []rune(b)
+  longest := max(len(ra), len(rb))
+  score := 1 - float64(levenshtein(ra, rb))/float64(longest)
+  if len(rb) >= 4 && strings.Contains(" "+a+" ", " "+b+" ") { score = max(score, 0.9) }
+  return score
+}
+
+// matchTitle finds the episode whose title is most like text. It counts when the score
+// reaches threshold and clearly beats the runner-up; best is returned either way, for --explain.
+func matchTitle(text string, eps []tvdb.Episode, threshold float64) (best tvdb.Episode, score float64, ok bool) {
+  second := 0.0
+  for _, e := range eps {
+    s := titleScore(text, normTitle(e.Title))
+    switch {
+    case s > score:
+      best, score, second = e, s, score
+    case s > second:
+      second = s
+    }
+  }
+  return best, score, score >= threshold && score-second >= titleMargin
+}
+
+// titleMatch is matchTitle under the [match] settings; it never matches when they turn titles off
+func (r *Runner) titleMatch(text string, eps []tvdb.Episode) (tvdb.Episode, float64, bool) {
+  if !r.cfg.Match.Titles || text == "" { return tvdb.Episode{}, 0, false }
+  return matchTitle(text, eps, r.cfg.Match.Threshold)
+}
+
+// episodeList flattens the fetched episodes in season and number order
+func episodeList[K comparable](m map[K]tvdb.Episode) []tvdb.Episode {
+  out := make([]tvdb.Episode, 0, len(m))
+  for _, e := range m { out = append(out, e) }
+  sort.Slice(out, func(i, j int) bool {
+    if out[i].Season != out[j].Season { return out[i].Season < out[j].Season }
+    return out[i].Number < out[j].Number
+  })
+  return out
+}
+
+func levenshtein(a, b []rune) int {
+  prev := make([]int, len(b)+1)
+  cur := make([]int, len(b)+1)
+  for j := range prev { prev[j] = j }
+  for i := 1; i <= len(a); i++ {
+    cur[0] = i
+    for j := 1; j <= len(b); j++ {
+      cost := 1
+      if a[i-1] == b[j-1] { cost = 0 }
+      cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+    }
+    prev, cur = cur, prev
+  }
+  return prev[len(b)]
+}
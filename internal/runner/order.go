@@ -0,0 +1,224 @@
+package runner
+
+import (
+  "context"
+  "fmt"
+  "os"
+  "path/filepath"
+  "slices"
+  "sort"
+  "strings"
+
+  "github.com/GizzmoShifu/tvrn/internal/planner"
+  "github.com/GizzmoShifu/tvrn/internal/tvdb"
+)
+
+// autoOrders are the orders --order auto tries; on a tie the earlier one wins
+var autoOrders = []string{"aired", "dvd", "absolute", "alternate", "regional"}
+
+// AutoOrders lists the orders --order auto tries
+func AutoOrders() []string { return slices.Clone(autoOrders) }
+
+const (
+  orderMargin = 3   // how far the best order must lead one naming the files differently
+  longRatio   = 1.6 // a file or episode this much over the median counts as double length
+)
+
+// OrderError is returned by Plan when --order auto can't tell the orders apart.
+// Answering it with PinOrder settles the folder for later runs.
+type OrderError struct {
+  Folder   string
+  SeriesID int
+  Scores   []planner.OrderScore // best first
+}
+
+func (e *OrderError) Error() string {
+  var alts []string
+  for _, s := range e.Scores { alts = append(alts, fmt.Sprintf("%s (%d)", s.Order, s.Score)) }
+  return fmt.Sprintf("can't tell which episode order %s follows: %s score too close; pass --order %s or --order %s",
+    filepath.Base(e.Folder), strings.Join(alts, ", "), e.Scores[0].Order, e.Scores[1].Order)
+}
+
+// orderFile is what order detection knows of one media file
+type orderFile struct {
+  season, episode int    // episode 0 when the name has only a title
+  title           string // the title in the name, normalised
+  size            int64
+}
+
+// orderFiles reads the single-episode media files' numbers, titles and sizes
+func (r *Runner) orderFiles(entries []os.DirEntry, seasonHint int, show string) []orderFile {
+  var out []orderFile
+  for _, ent := range entries {
+    if ent.IsDir() || !IsMedia(ent.Name()) { continue }
+    f := orderFile{}
+    if info, err := ent.Info(); err == nil { f.size = info.Size() }
+    p, ok := r.parse.Parse(ent.Name(), seasonHint, "")
+    switch {
+    case !ok:
+      f.title = titleText(strings.TrimSuffix(ent.Name(), filepath.Ext(ent.Name())), show)
+    case len(p.Episodes) == 1 && p.Segment == "":
+      f.season, f.episode, f.title = p.Season, p.Episode, titleText(p.Rest, show)
+    default:
+      continue
+    }
+    out = append(out, f)
+  }
+  return out
+}
+
+// detectOrder picks the episode order the files follow for --order auto. A pinned order
+// for the folder, or its series folder, is used as is; otherwise every order the provider
+// has is scored against the files, and an OrderError is returned when two that would
+// name the files differently score too close to call.
+func (r *Runner) detectOrder(ctx context.Context, c tvdb.Client, root string, show tvdb.Series, season int, files []orderFile) (string, []planner.OrderScore, error) {
+  dirs := []string{root}
+  if _, ok := seasonFromDir(filepath.Base(root)); ok { dirs = append(dirs, filepath.Dir(root)) }
+  for _, dir := range dirs {
+    if pin, ok := r.pins.Get(dir); ok && pin.Order != "" && (pin.SeriesID == 0 || pin.SeriesID == show.ID) {
+      return pin.Order, []planner.OrderScore{{Order: pin.Order, Why: "pinned for " + filepath.Base(dir), Picked: true}}, nil
+    }
+  }
+
+  var scores []planner.OrderScore
+  names := map[string]string{} // order -> the titles it gives the numbered files
+  for _, o := range autoOrders {
+    eps, err := c.GetEpisodes(ctx, show.ID, o, season, r.cfg.Defaults.Lang)
+    if ctx.Err() != nil { return "", nil, ctx.Err() }
+    if err != nil || len(eps) == 0 {
+      r.log().Debugf("order %s: not available (%v)", o, err)
+      continue
+    }
+    s, sig := r.scoreOrder(o, files, eps)
+    scores = append(scores, s)
+    names[o] = sig
+  }
+  if len(scores) == 0 { return "", nil, fmt.Errorf("%s has no episodes in any order", show.Name) }
+
+  sort.SliceStable(scores, func(i, j int) bool { return scores[i].Score > scores[j].Score })
+  scores[0].Picked = true
+  best := scores[0]
+  for _, s := range scores[1:] {
+    if best.Score-s.Score < orderMargin && names[s.Order] != names[best.Order] {
+      scores[0].Picked = false
+      return "", scores, &OrderError{Folder: root, SeriesID: show.ID, Scores: scores}
+    }
+  }
+  if len(scores) > 1 {
+    r.log().Infof("%s: --order auto picked %s, scoring %d to %s's %d: %s",
+      filepath.Base(root), best.Order, best.Score, scores[1].Order, scores[1].Score, best.Why)
+  } else {
+    r.log().Infof("%s: --order auto picked %s, the only order available", filepath.Base(root), best.Order)
+  }
+  return best.Order, scores, nil
+}
+
+// scoreOrder rates how well one order's episodes fit the files: numbers it has, titles
+// that agree with the numbers, no more files in a season than it has episodes, and
+// double-length files where it has double-length episodes. sig lists the titles it
+// would give the numbered files, to tell orders that name them alike.
+func (r *Runner) scoreOrder(order string, files []orderFile, eps []tvdb.Episode) (planner.OrderScore, string) {
+  type key struct{ s, e int }
+  bySE := map[key]tvdb.Episode{}
+  perSeason := map[int]int{}
+  for _, e := range eps {
+    bySE[key{e.Season, e.Number}] = e
+    perSeason[e.Season]++
+  }
+  s := planner.OrderScore{Order: order}
+  var why, sig []string
+
+  // Numbers the order has, and titles that agree with them
+  counts := map[int]int{}
+  for _, f := range files {
+    if f.episode == 0 {
+      // a title alone scores nothing, as every order has it, but may be numbered differently
+      if ep, _, ok := matchTitle(f.title, eps, r.cfg.Match.Threshold); ok { sig = append(sig, fmt.Sprintf("S%02dE%02d", ep.Season, ep.Number)) }
+      continue
+    }
+    counts[f.season]++
+    ep, ok := bySE[key{f.season, f.episode}]
+    if !ok {
+      s.Unknown++
+      sig = append(sig, "?")
+      continue
+    }
+    s.Known++
+    sig = append(sig, ep.Title)
+    if f.title == "" { continue }
+    if titleScore(f.title, normTitle(ep.Title)) >= r.cfg.Match.Threshold {
+      s.Titles++
+    } else if _, _, ok := matchTitle(f.title, eps, r.cfg.Match.Threshold); ok {
+      s.TitleMisses++
+    }
+  }
+  s.Score = s.Known - 2*s.Unknown + 3*s.Titles - 3*s.TitleMisses
+  if s.Known+s.Unknown > 0 { why = append(why, fmt.Sprintf("%d of %d numbers known", s.Known, s.Known+s.Unknown)) }
+  if s.Titles+s.TitleMisses > 0 { why = append(why, fmt.Sprintf("%d titles agree, %d name other episodes", s.Titles, s.TitleMisses)) }
+
+  // More files in a season than the order has episodes
+  for season, n := range counts {
+    if have := perSeason[season]; n > have {
+      s.Score -= 2 * (n - have)
+      why = append(why, fmt.Sprintf("%d files for %d episodes in season %d", n, have, season))
+    }
+  }
+
+  // Double-length files, such as a two-hour pilot, where the order has double-length episodes
+  if agree, disagree, ok := runtimeFit(files, eps); ok {
+    s.Runtime = agree - disagree
+    s.Score += 2 * s.Runtime
+    if agree+disagree > 0 { why = append(why, fmt.Sprintf("%d long files line up with long episodes, %d don't", agree, disagree)) }
+  }
+
+  s.Why = strings.Join(why, "; ")
+  return s, strings.Join(sig, "|")
+}
+
+// runtimeFit compares which files are much larger than the rest with which episodes
+// run much longer, for files and episodes where either stands out. ok is false without
+// enough sizes and runtimes to go on.
+func runtimeFit(files []orderFile, eps []tvdb.Episode) (agree, disagree int, ok bool) {
+  var sizes []float64
+  for _, f := range files {
+    if f.episode > 0 && f.size > 0 { sizes = append(sizes, float64(f.size)) }
+  }
+  var runtimes []float64
+  for _, e := range eps {
+    if e.Runtime > 0 { runtimes = append(runtimes, float64(e.Runtime)) }
+  }
+  if len(sizes) < 3 || len(runtimes) < 3 { return 0, 0, false }
+  size, runtime := median(sizes), median(runtimes)
+
+  type key struct{ s, e int }
+  byKey := map[key]tvdb.Episode{}
+  for _, e := range eps { byKey[key{e.Season, e.Number}] = e }
+  for _, f := range files {
+    ep, found := byKey[key{f.season, f.episode}]
+    if f.episode == 0 || f.size == 0 || !found || ep.Runtime == 0 { continue }
+    longFile := float64(f.size) >= longRatio*size
+    longEp := float64(ep.Runtime) >= longRatio*runtime
+    switch {
+    case longFile && longEp: agree++
+    case longFile != longEp: disagree++
+    }
+  }
+  return agree, disagree, true
+}
+
+func median(xs []float64) float64 {
+  sort.Float64s(xs)
+  n := len(xs)
+  if n%2 == 1 { return xs[n/2] }
+  return (xs[n/2-1] + xs[n/2]) / 2
+}
+
+// PinOrder remembers the order chosen for a folder, so --order auto doesn't ask again.
+// A season folder's answer is kept on its series folder, for its sibling seasons.
+func (r *Runner) PinOrder(root string, seriesID int, order string) error {
+  if _, ok := seasonFromDir(filepath.Base(root)); ok { root = filepath.Dir(root) }
+  pin, _ := r.pins.Get(root)
+  pin.Path, pin.Order = root, order
+  if pin.SeriesID == 0 { pin.SeriesID = seriesID }
+  return r.pins.Put(pin)
+}
@@ -4,13 +4,130 @@ import (
   "bufio"
   "fmt"
   "io"
+  "path/filepath"
+  "strconv"
   "strings"
+
+  "github.com/GizzmoShifu/tvrn/internal/planner"
+  "github.com/GizzmoShifu/tvrn/internal/state"
 )
 
-func confirm(r io.Reader, w io.Writer, n int) (bool, error) {
-  fmt.Fprintf(w, "\nApply %d changes? Type \"Y\" or \"y\" or \"yes\" to continue: ", n)
+// confirm asks once for the whole plan. Strict mode only takes a capital Y.
+func confirm(r io.Reader, w io.Writer, n int, strict bool) (bool, error) {
+  if strict {
+    fmt.Fprintf(w, "\nApply %d changes? Type \"Y\" to continue: ", n)
+  } else {
+    fmt.Fprintf(w, "\nApply %d changes? Type \"Y\" or \"y\" or \"yes\" to continue: ", n)
+  }
   s := bufio.NewScanner(r)
   if !s.Scan() { return false, s.Err() }
-  ans := strings.ToLower(strings.TrimSpace(s.Text()))
-  return ans == "y" || ans == "yes", nil
+  return Accepts(s.Text(), strict), nil
+}
+
+// Accepts reports whether an answer to "apply?" means yes
+func Accepts(ans string, strict bool) bool {
+  ans = strings.TrimSpace(ans)
+  if strict { return ans == "Y" }
+  ans = strings.ToLower(ans)
+  return ans == "y" || ans == "yes"
+}
+
+// ChooseOrder asks which episode order a folder follows when --order auto couldn't tell,
+// and pins the answer. It returns "" when the user stops instead.
+func (r *Runner) ChooseOrder(in io.Reader, w io.Writer, e *OrderError) (string, error) {
+  fmt.Fprintf(w, "\n%s: the episode orders score too close to tell apart\n", filepath.Base(e.Folder))
+  for i, s := range e.Scores { fmt.Fprintf(w, "  %d) %-9s %3d  %s\n", i+1, s.Order, s.Score, s.Why) }
+  fmt.Fprintf(w, "Which order do the files follow? [1-%d, Enter to stop]: ", len(e.Scores))
+  sc := bufio.NewScanner(in)
+  if !sc.Scan() { return "", sc.Err() }
+  ans := strings.TrimSpace(sc.Text())
+  if ans == "" { return "", nil }
+  for i, s := range e.Scores {
+    if ans == strconv.Itoa(i+1) || strings.EqualFold(ans, s.Order) {
+      return s.Order, r.PinOrder(e.Folder, e.SeriesID, s.Order)
+    }
+  }
+  return "", fmt.Errorf("no order %q to choose", ans)
+}
+
+const eachHelp = `y - apply this change
+n - skip this change
+a - apply this and every remaining change
+q - stop here; the answers so far are kept for the next --interactive run
+e - type a different new name, then apply it
+? - show this help`
+
+// ConfirmEach asks about every item in turn, like mv -i. Answers are saved under key as
+// they are given, and items answered in an earlier, cancelled run are not asked again.
+// It returns the items to apply, and false when the user quit before the end.
+func (r *Runner) ConfirmEach(in io.Reader, w io.Writer, p planner.Plan, key string) (planner.Plan, bool, error) {
+  saved := state.LoadDecisions(r.cfg.Home, key)
+  var ds []state.Decision
+  keep := func(d state.Decision) {
+    ds = append(ds, d)
+    _ = state.SaveDecisions(r.cfg.Home, key, ds)
+  }
+
+  s := bufio.NewScanner(in)
+  out := p
+  out.Items = nil
+  all := false
+  for i, it := range p.Items {
+    label := fmt.Sprintf("%s -> %s", filepath.Base(it.From), filepath.Base(it.To))
+
+    if d, ok := saved[it.From]; ok && d.To == it.To {
+      if d.Name != "" { it.To = filepath.Join(filepath.Dir(it.To), d.Name) }
+      verdict := "skip"
+      if d.Keep {
+        verdict = "apply"
+        out.Items = append(out.Items, it)
+      }
+      fmt.Fprintf(w, "(%d/%d) %s: %s, as answered before\n", i+1, len(p.Items), label, verdict)
+      keep(d)
+      continue
+    }
+    if all {
+      out.Items = append(out.Items, it)
+      continue
+    }
+
+    for {
+      fmt.Fprintf(w, "(%d/%d) %s? [y,n,a,q,e,?] ", i+1, len(p.Items), label)
+      if !s.Scan() { return out, false, s.Err() }
+      ans := strings.ToLower(strings.TrimSpace(s.Text()))
+      d := state.Decision{From: it.From, To: it.To}
+      switch ans {
+      case "y", "yes":
+        d.Keep = true
+      case "n", "no":
+      case "a":
+        d.Keep, all = true, true
+      case "q":
+        return out, false, nil
+      case "e":
+        fmt.Fprintf(w, "New name [%s]: ", filepath.Base(it.To))
+        if !s.Scan() { return out, false, s.Err() }
+        name := strings.TrimSpace(s.Text())
+        if strings.ContainsAny(name, `/\`) {
+          fmt.Fprintln(w, "A name can't contain a path separator")
+          continue
+        }
+        d.Keep = true
+        if name != "" && name != filepath.Base(it.To) {
+          d.Name = name
+          it.To = filepath.Join(filepath.Dir(it.To), name)
+        }
+      default:
+        fmt.Fprintln(w, eachHelp)
+        continue
+      }
+      if d.Keep { out.Items = append(out.Items, it) }
+      keep(d)
+      break
+    }
+  }
+  return out, true, nil
 }
+
+// ForgetAnswers drops the --interactive answers saved under key, once they have been applied
+func (r *Runner) ForgetAnswers(key string) error { return state.SaveDecisions(r.cfg.Home, key, nil) }
@@ -2,15 +2,20 @@ package runner
 
 import (
   "context"
+  "errors"
   "fmt"
   "io"
   "os"
   "path/filepath"
   "regexp"
+  "slices"
   "sort"
   "strconv"
   "strings"
   "runtime"
+  "sync/atomic"
+  "time"
+  "unicode/utf8"
 
   "github.com/GizzmoShifu/tvrn/internal/config"
   "github.com/GizzmoShifu/tvrn/internal/logx"
@@ -20,82 +25,115 @@ import (
   "github.com/GizzmoShifu/tvrn/internal/tvdb"
 )
 
-var (
-  reParen2 = regexp.MustCompile(`^\s*(.+?)\s*\((\d+)\)\s*\+\s*(.+?)\s*\((\d+)\)\s*$`)
-  rePart2  = regexp.MustCompile(`(?i)^\s*(.+?)\s*(?:-|—|\s)?\s*part\s*(\d+)\s*\+\s*(.+?)\s*(?:-|—|\s)?\s*part\s*(\d+)\s*$`)
-  seasonDirRe = regexp.MustCompile(`(?i)^s(eason)?\s*0?\d+$|^specials$`)
-)
+// rePart reads a numbered part of a story: "Serenity (1)", "Heroes Part 2", "Heroes - Part 3"
+var rePart = regexp.MustCompile(`(?i)^\s*(.+?)\s*(?:\((\d+)\)|(?:-|—)?\s*\bpart\s*(\d+))\s*$`)
+
+// ErrNothingToRename is returned by Plan when no file needs a new name
+var ErrNothingToRename = errors.New("no valid episodes found to rename")
 
 type Runner struct {
-  cfg  *config.Config
-  log  *logx.Logger
-  pins *state.Pins
-  tv   tvdb.Client
+  cfg   *config.Config
+  base  *logx.Logger
+  pins  *state.Pins
+  parse *parse.Parser
+  tv    tvdb.Client
+  run   atomic.Pointer[run] // swapped whole by NewRun while other goroutines may log
+}
+
+// run is one journal run: its ID, and the base logger tagged with it
+type run struct {
+  id  string
+  log *logx.Logger
 }
 
 func New(cfg *config.Config, log *logx.Logger, tv tvdb.Client) *Runner {
   p, _ := state.LoadPins(cfg.Home)
-  return &Runner{cfg: cfg, log: log, pins: p, tv: tv}
+  r := &Runner{cfg: cfg, base: log, pins: p, parse: newParser(cfg.Parse), tv: tv}
+  r.NewRun()
+  return r
+}
+
+// newParser builds the filename parser from [parse]; Validate has already checked the patterns
+func newParser(c config.Parse) *parse.Parser {
+  var user []parse.Pattern
+  for _, p := range c.Patterns {
+    if pt, err := parse.Compile(p.Name, p.Regex, p.Priority); err == nil { user = append(user, pt) }
+  }
+  return parse.NewParser(user, c.Disable...)
 }
 
 func (r *Runner) Cfg() *config.Config { return r.cfg }
 
-func (r *Runner) debugf(format string, a ...any) {
-  if r.cfg.CLI.Debug {
-    fmt.Fprintf(os.Stderr, "DEBUG "+format+"\n", a...)
-  }
+// NewRun starts a new journal run, so a long-lived process can undo each batch on its own.
+// Everything logged from then on carries the run ID.
+func (r *Runner) NewRun() {
+  id := time.Now().Format("20060102T150405.000")
+  r.run.Store(&run{id: id, log: r.base.With("run", id)})
 }
 
+// log is the current run's logger
+func (r *Runner) log() *logx.Logger { return r.run.Load().log }
+
+// runCtx tags ctx with the run ID, so the provider's own lines, such as retries, carry it
+func (r *Runner) runCtx(ctx context.Context) context.Context { return logx.WithAttrs(ctx, "run", r.run.Load().id) }
+
+// mediaExts are the video files tvrn renames
+var mediaExts = []string{".mkv", ".mp4", ".avi"}
+
+// IsMedia reports whether a filename is a video file tvrn renames
+func IsMedia(name string) bool { return slices.Contains(mediaExts, strings.ToLower(filepath.Ext(name))) }
+
 func (r *Runner) Plan(ctx context.Context, root string) (planner.Plan, planner.Stats, error) {
+  ctx = r.runCtx(ctx)
   // Work out series name and season hint from the path
   base := filepath.Base(root)
   parent := filepath.Base(filepath.Dir(root))
 
+  // A season folder inside the series folder, or a series folder naming its season
   seriesName := base
-  seasonHint := 0
-  if seasonDirRe.MatchString(base) {
-    seriesName = parent
-    if digits := regexp.MustCompile(`\d+`).FindString(base); digits != "" {
-      fmt.Sscanf(digits, "%d", &seasonHint)
-    }
+  folderSeason, fromFolder, inSeason := 0, false, false
+  if n, ok := seasonFromDir(base); ok {
+    seriesName, folderSeason, fromFolder, inSeason = parent, n, true, true
+  } else if name, n, ok := showSeasonFromDir(base); ok {
+    seriesName, folderSeason, fromFolder = name, n, true
   }
 
+  if r.cfg.CLI.Show != "" { seriesName = r.cfg.CLI.Show }
+
   // Optional year hint e.g. "Firefly (2002)"
-  yearHint := 0
-  if i := strings.LastIndex(seriesName, "("); i > 0 && strings.HasSuffix(seriesName, ")") {
-    if y, err := strconv.Atoi(strings.TrimRight(seriesName[i+1:], ")")); err == nil {
-      yearHint = y
-      seriesName = strings.TrimSpace(seriesName[:i])
-    }
-  }
+  seriesName, yearHint := splitYear(seriesName)
 
-  // TVDB client
-  c := r.tv
-  if c == nil {
-    c = tvdb.NewHTTP("", r.cfg.Auth.APIKey, r.cfg.Auth.PIN)
-  }
-  if err := c.Login(ctx); err != nil { return planner.Plan{}, planner.Stats{}, err }
+  entries, err := os.ReadDir(root)
+  if err != nil { return planner.Plan{}, planner.Stats{}, err }
+  season := r.chooseSeason(root, folderSeason, fromFolder, entries)
+  seasonHint := season.Season
+  for _, c := range season.Conflicts { r.log().Warnf("%s: %s", base, c) }
 
-  // Search series
-  hits, err := c.SearchSeries(ctx, seriesName, r.cfg.Defaults.Lang)
+  c, err := r.client(ctx)
   if err != nil { return planner.Plan{}, planner.Stats{}, err }
-  if len(hits) == 0 { return planner.Plan{}, planner.Stats{}, fmt.Errorf("no TVDB results for %q", seriesName) }
 
-  // Pick best match
-  show := hits[0]
-  for _, h := range hits {
-    if strings.EqualFold(h.Name, seriesName) && (yearHint == 0 || h.Year == yearHint) {
-      show = h
-      break
-    }
+  ex := &planner.Explain{Folder: root, Query: seriesName, Year: yearHint, Provider: providerName(c),
+    Season: seasonHint, SeasonFrom: season.From, Conflicts: season.Conflicts, Order: r.cfg.Defaults.Order,
+    Files: []planner.FileTrace{}}
+  show, cands, err := r.findSeries(ctx, c, seriesName, yearHint)
+  ex.Candidates = cands
+  if err != nil { return planner.Plan{Explain: ex}, planner.Stats{}, err }
+
+  // --order auto scores every order the provider has against the files
+  order := r.cfg.Defaults.Order
+  if order == "auto" {
+    picked, scores, err := r.detectOrder(ctx, c, root, show, seasonHint, r.orderFiles(entries, seasonHint, seriesName))
+    ex.Orders = scores
+    if err != nil { return planner.Plan{Explain: ex}, planner.Stats{}, err }
+    order, ex.Order = picked, picked
   }
 
-  // Fetch episodes for configured order and the current season only
-  eps, err := c.GetEpisodes(ctx, show.ID, r.cfg.Defaults.Order, seasonHint, r.cfg.Defaults.Lang)
+  // Fetch episodes for the order and the current season only
+  eps, err := c.GetEpisodes(ctx, show.ID, order, seasonHint, r.cfg.Defaults.Lang)
   if err != nil { return planner.Plan{}, planner.Stats{}, err }
   if len(eps) == 0 {
     // fetch all to compute available seasons and FAIL the run
-    all, _ := r.tv.GetEpisodes(ctx, show.ID, r.cfg.Defaults.Order, 0, r.cfg.Defaults.Lang)
+    all, _ := c.GetEpisodes(ctx, show.ID, order, 0, r.cfg.Defaults.Lang)
     seen := map[int]bool{}
     var seasons []int
     for _, e := range all {
@@ -105,17 +143,18 @@ func (r *Runner) Plan(ctx context.Context, root string) (planner.Plan, planner.S
       }
     }
     sort.Ints(seasons)
-    return planner.Plan{}, planner.Stats{}, fmt.Errorf(
-      "no episodes for season %d with order=%s. TVDB seasons available: %v",
-      seasonHint, r.cfg.Defaults.Order, seasons,
+    return planner.Plan{Explain: ex}, planner.Stats{}, fmt.Errorf(
+      "no episodes for season %d with order=%s. %s seasons available: %v",
+      seasonHint, order, strings.ToUpper(providerName(c)), seasons,
     )
   }
 
-  r.debugf("picked series=%q id=%d order=%s season=%d; fetched episodes=%d",
-    show.Name, show.ID, r.cfg.Defaults.Order, seasonHint, len(eps))
+  ex.Episodes = len(eps)
+  r.log().Debugf("picked series=%q id=%d order=%s season=%d; fetched episodes=%d",
+    show.Name, show.ID, order, seasonHint, len(eps))
   for i := 0; i < len(eps) && i < 5; i++ {
     e := eps[i]
-    r.debugf("api sample: S%02dE%02d -> %q", e.Season, e.Number, e.Title)
+    r.log().Debugf("api sample: S%02dE%02d -> %q", e.Season, e.Number, e.Title)
   }
 
   // Index episodes by S/E (we fetched a single season, but keep the key explicit)
@@ -123,69 +162,164 @@ func (r *Runner) Plan(ctx context.Context, root string) (planner.Plan, planner.S
   bySE := map[key]tvdb.Episode{}
   for _, e := range eps { bySE[key{e.Season, e.Number}] = e }
 
-  // Walk current directory for media files
-  entries, err := os.ReadDir(root)
-  if err != nil { return planner.Plan{}, planner.Stats{}, err }
+  // Misfiled episodes are looked up in their own season, fetched once on demand
+  fetched := map[int]bool{seasonHint: true}
+  ensureSeason := func(season int) {
+    if fetched[season] { return }
+    fetched[season] = true
+    more, err := c.GetEpisodes(ctx, show.ID, order, season, r.cfg.Defaults.Lang)
+    if err != nil {
+      r.log().Warnf("season %d: %v", season, err)
+      return
+    }
+    for _, e := range more { bySE[key{e.Season, e.Number}] = e }
+  }
 
-  var plan planner.Plan
+  // Walk current directory for media files
+  plan := planner.Plan{SeriesID: show.ID, Series: show.Name, Order: order, Explain: ex}
   skipped := 0
+  taken := map[string]string{} // new name -> the file getting it
   for _, ent := range entries {
     if ent.IsDir() { continue }
     name := ent.Name()
-    lower := strings.ToLower(name)
-    if !(strings.HasSuffix(lower, ".mkv") || strings.HasSuffix(lower, ".mp4") || strings.HasSuffix(lower, ".avi")) {
+    if !IsMedia(name) {
+      ex.Files = append(ex.Files, planner.FileTrace{File: name, Result: "ignored", Why: "not a video file (" + strings.Join(mediaExts, ", ") + ")"})
       continue
     }
 
-    p, ok := parse.FromFilename(name, seasonHint, "")
+    p, ok := r.parse.Parse(name, seasonHint, "")
+    var byTitle float64
     if !ok {
-      r.debugf("parse miss: %q", name)
-      continue
+      // No number: a name that is only a title, as "Firefly - Out of Gas.mkv"
+      text := titleText(strings.TrimSuffix(name, filepath.Ext(name)), seriesName)
+      ep, score, found := r.titleMatch(text, eps)
+      if !found {
+        r.log().Debugf("parse miss: %q", name)
+        why := "no pattern found an episode number in the name"
+        if seasonHint == 0 { why += ", and there is no season to read a bare 102 against" }
+        if r.cfg.Match.Titles && text != "" && score > 0 {
+          why += fmt.Sprintf("; the closest title, %q, scores %.2f", ep.Title, score)
+        }
+        ex.Files = append(ex.Files, planner.FileTrace{File: name, Result: "ignored", Why: why})
+        continue
+      }
+      r.log().Debugf("title match: %q -> S%02dE%02d %q (%.2f)", name, ep.Season, ep.Number, ep.Title, score)
+      p = parse.Parsed{Season: ep.Season, Episode: ep.Number, Episodes: []int{ep.Number},
+        Rest: text, Ext: strings.TrimPrefix(filepath.Ext(name), "."), Raw: name, Rule: "title", Match: []string{text}}
+      byTitle = score
+    }
+    tr := planner.FileTrace{File: name, Rule: p.Rule, Captures: p.Match, Season: p.Season, SeasonFrom: "filename",
+      Episode: p.Episode, Episode2: p.Episode2, Episodes: several(p.Episodes), Segment: p.Segment}
+    switch p.Rule {
+    case "NNN": tr.SeasonFrom = season.From
+    case "title": tr.SeasonFrom, tr.Title, tr.Score = "title", p.Rest, byTitle
     }
 
-    // Skip unknown episode numbers (and ranges) for this season/order
-    if _, ok := bySE[key{p.Season, p.Episode}]; !ok {
-      r.log.Warnf("unknown episode S%02dE%02d in %q; skipping", p.Season, p.Episode, name)
-      skipped++
-      continue
+    // --season and pins overrule the file; a folder only sets the default, and a file
+    // naming another season than its season folder belongs in a sibling one
+    misfiled := false
+    if season.From != "" && p.Season != seasonHint {
+      switch {
+      case season.Force:
+        r.log().Warnf("%q says season %d; reading it as season %d from %s", name, p.Season, seasonHint, seasonSource(season.From))
+        tr.Conflict = fmt.Sprintf("the file name says season %d", p.Season)
+        p.Season, tr.Season, tr.SeasonFrom = seasonHint, seasonHint, season.From
+      case inSeason && seasonHint > 0:
+        misfiled = true
+        ensureSeason(p.Season)
+      default:
+        r.log().Warnf("%q says season %d, not %s's %d; matching it as season %d", name, p.Season, seasonSource(season.From), seasonHint, p.Season)
+        tr.Conflict = fmt.Sprintf("%s says season %d", seasonSource(season.From), seasonHint)
+        ensureSeason(p.Season)
+      }
     }
-    if p.Episode2 > 0 && p.Episode2 > p.Episode {
-      if _, ok := bySE[key{p.Season, p.Episode2}]; !ok {
-        r.log.Warnf("unknown episode S%02dE%02d in %q; skipping range", p.Season, p.Episode2, name)
-        skipped++
-        continue
+
+    // The title after the number checks it: it stands in for a number this order doesn't
+    // have, and a title naming another episode is flagged, as DVD numbers in an aired folder are
+    if p.Rule != "title" && len(p.Episodes) == 1 {
+      text := titleText(p.Rest, seriesName)
+      if ep, score, ok := r.titleMatch(text, episodeList(bySE)); ok && (ep.Season != p.Season || ep.Number != p.Episode) {
+        if was, known := bySE[key{p.Season, p.Episode}]; known {
+          r.log().Warnf("%q: S%02dE%02d is %q, but the title names S%02dE%02d %q; check the order",
+            name, p.Season, p.Episode, was.Title, ep.Season, ep.Number, ep.Title)
+          tr.Mismatch = fmt.Sprintf("the title names S%02dE%02d %q", ep.Season, ep.Number, ep.Title)
+        } else {
+          r.log().Debugf("%q: no S%02dE%02d; the title names S%02dE%02d %q", name, p.Season, p.Episode, ep.Season, ep.Number, ep.Title)
+          p.Season, p.Episode, p.Episodes = ep.Season, ep.Number, []int{ep.Number}
+          tr.Season, tr.Episode, tr.Title, tr.Score = ep.Season, ep.Number, text, score
+          misfiled = inSeason && seasonHint > 0 && p.Season != seasonHint
+        }
       }
     }
 
-    // Build title (now guaranteed to exist for both ends if range)
-    title := bySE[key{p.Season, p.Episode}].Title
-    if p.Episode2 > 0 && p.Episode2 > p.Episode {
-      t2 := bySE[key{p.Season, p.Episode2}].Title
-      if title != "" && t2 != "" {
-        title = title + " + " + t2
-      } else if t2 != "" {
-        title = t2
+    // Skip files naming an episode this season/order doesn't have; one unknown
+    // episode of a multi-episode file skips the whole file
+    missing := -1
+    var titles, lookup []string
+    for _, e := range p.Episodes {
+      ep, ok := bySE[key{p.Season, e}]
+      if !ok {
+        missing = e
+        break
       }
+      titles = append(titles, ep.Title)
+      lookup = append(lookup, fmt.Sprintf("S%02dE%02d %q", p.Season, e, ep.Title))
+    }
+    if missing >= 0 {
+      r.log().Warnf("unknown episode S%02dE%02d in %q; skipping", p.Season, missing, name)
+      skipped++
+      tr.Result, tr.Why = "skipped", fmt.Sprintf("%s has no S%02dE%02d in %s order", show.Name, p.Season, missing, order)
+      ex.Files = append(ex.Files, tr)
+      continue
     }
+    tr.Lookup = strings.Join(lookup, ", ")
 
-    r.debugf("file=%q parsed=S%02dE%02d%s title=%q",
-      name, p.Season, p.Episode,
-      func() string {
-        if p.Episode2 > 0 { return fmt.Sprintf("-%02d", p.Episode2) }
-        return ""
-      }(),
-      title,
-    )
+    r.log().Debugf("file=%q parsed=S%02dE%s%s titles=%q", name, p.Season, epList(p.Episodes), p.Segment, titles)
 
-    toName := formatName(r.cfg.Rename.Scheme, r.cfg.Rename.Pad, r.cfg.Rename.MultiEP,
-      seriesName, p.Season, p.Episode, p.Episode2, title, p.Ext)
+    toName := formatName(r.cfg.Rename, p.Season, p.Episodes, p.Segment, titles, p.Ext)
+    tr.To = toName
+
+    // Two files may not share a new name, as the unmarked halves of a split episode would
+    target := filepath.Join(root, toName)
+    if misfiled { target = filepath.Join(r.siblingSeasonDir(filepath.Dir(root), p.Season), toName) }
+    if first, ok := taken[nameKey(target)]; ok {
+      r.log().Warnf("%q would also be named %q, like %q; skipping", name, toName, first)
+      skipped++
+      tr.Result, tr.Why = "skipped", fmt.Sprintf("%s gets the same name; mark the parts as pt1/pt2 or a/b", first)
+      ex.Files = append(ex.Files, tr)
+      continue
+    }
+    taken[nameKey(target)] = name
+
+    if misfiled {
+      dir := filepath.Dir(target)
+      r.log().Warnf("misfiled: %q is S%02d; moving to %s", name, p.Season, filepath.Base(dir))
+      tr.Result, tr.Why = "move", fmt.Sprintf("season %d in a season %d folder", p.Season, seasonHint)
+      tr.To = filepath.Join(filepath.Base(dir), toName)
+      ex.Files = append(ex.Files, tr)
+      plan.Items = append(plan.Items, planner.Item{
+        From:   filepath.Join(root, name),
+        To:     filepath.Join(dir, toName),
+        Reason: "move",
+        S:      p.Season,
+        E1:     p.Episode,
+        E2:     p.Episode2,
+        Eps:    several(p.Episodes),
+        Seg:    p.Segment,
+      })
+      continue
+    }
 
     // Skip no-ops where the file is already correctly named
     if sameFileName(name, toName) {
-      r.debugf("noop (already named): %q", name)
+      r.log().Debugf("noop (already named): %q", name)
       skipped++
+      tr.Result = "already named"
+      ex.Files = append(ex.Files, tr)
       continue
     }
+    tr.Result = "rename"
+    ex.Files = append(ex.Files, tr)
 
     plan.Items = append(plan.Items, planner.Item{
       From:   filepath.Join(root, name),
@@ -194,65 +328,313 @@ func (r *Runner) Plan(ctx context.Context, root string) (planner.Plan, planner.S
       S:      p.Season,
       E1:     p.Episode,
       E2:     p.Episode2,
+      Eps:    several(p.Episodes),
+      Seg:    p.Segment,
     })
   }
 
+  // Folder renames run last, after every file inside them has moved
+  // A series folder that names its season is left alone: its canonical name would lose the season
+  withSeries := !r.cfg.CLI.Series && (inSeason || !fromFolder)
+  plan.Items = append(plan.Items, r.planFolders(root, inSeason, seasonHint, show, providerName(c), withSeries)...)
+
   st := planner.Stats{Total: len(plan.Items), Skipped: skipped}
   for _, it := range plan.Items {
     if _, err := os.Stat(it.To); err == nil { st.Collisions++ }
   }
   if st.Total == 0 {
-    return planner.Plan{}, st, fmt.Errorf("no valid episodes found to rename (season %d, order=%s)", seasonHint, r.cfg.Defaults.Order)
+    return planner.Plan{Explain: ex}, st, fmt.Errorf("%w (season %d, order=%s)", ErrNothingToRename, seasonHint, order)
   }
   return plan, st, nil
 }
 
+// Renumber points an item at other episodes of the plan's series and rebuilds its
+// target name, for when a file's own numbering is wrong. eps lists every episode in the file.
+func (r *Runner) Renumber(ctx context.Context, p planner.Plan, it planner.Item, season int, eps []int) (planner.Item, error) {
+  if p.SeriesID == 0 { return it, fmt.Errorf("plan has no series to look episodes up in") }
+  if len(eps) == 0 { return it, fmt.Errorf("no episode given") }
+  ctx = r.runCtx(ctx)
+  c, err := r.client(ctx)
+  if err != nil { return it, err }
+  order := p.Order
+  if order == "" { order = r.cfg.Defaults.Order }
+  all, err := c.GetEpisodes(ctx, p.SeriesID, order, season, r.cfg.Defaults.Lang)
+  if err != nil { return it, err }
+  known := map[int]string{}
+  for _, e := range all {
+    if e.Season == season { known[e.Number] = e.Title }
+  }
+
+  var titles []string
+  for _, e := range eps {
+    t, ok := known[e]
+    if !ok { return it, fmt.Errorf("%s has no episode S%02dE%02d", p.Series, season, e) }
+    titles = append(titles, t)
+  }
+
+  ext := strings.TrimPrefix(filepath.Ext(it.From), ".")
+  name := formatName(r.cfg.Rename, season, eps, it.Seg, titles, ext)
+  it.To = filepath.Join(filepath.Dir(it.To), name)
+  it.S, it.E1, it.E2, it.Eps = season, eps[0], 0, several(eps)
+  if len(eps) > 1 { it.E2 = eps[len(eps)-1] }
+  return it, nil
+}
+
+// joinTitles names a multi-episode file after its episodes, skipping missing and repeated
+// titles. Numbered parts of one story collapse to "Base (1-3)"; a result longer than max
+// is cut after the last whole title that fits.
+func joinTitles(titles []string, sep string, max int) string {
+  var ts []string
+  for _, t := range titles {
+    t = strings.TrimSpace(t)
+    if t != "" && (len(ts) == 0 || !strings.EqualFold(ts[len(ts)-1], t)) { ts = append(ts, t) }
+  }
+  if len(ts) == 0 { return "" }
+  if c, ok := collapseParts(ts); ok { return c }
+  if sep == "" { sep = " + " }
+  out := strings.Join(ts, sep)
+  if max <= 0 || utf8.RuneCountInString(out) <= max { return out }
+
+  const more = "…" // one rune
+  out = ts[0]
+  for _, t := range ts[1:] {
+    if utf8.RuneCountInString(out+sep+t) > max-1 { break }
+    out += sep + t
+  }
+  if rs := []rune(out); len(rs) > max-1 {
+    out = string(rs[:max-1])
+    // back up to a word break unless the cut fell on one
+    if i := strings.LastIndex(out, " "); i > 0 && rs[max-1] != ' ' { out = out[:i] }
+  }
+  return strings.TrimRight(out, " -+,") + more
+}
+
+// several returns eps when a file holds more than one episode, for Item.Eps
+func several(eps []int) []int {
+  if len(eps) > 1 { return eps }
+  return nil
+}
+
+// epList renders episode numbers for logs, e.g. "01-02-03"
+func epList(eps []int) string {
+  s := make([]string, len(eps))
+  for i, e := range eps { s[i] = fmt.Sprintf("%02d", e) }
+  return strings.Join(s, "-")
+}
+
+// client returns the configured metadata client, logged in and ready.
+func (r *Runner) client(ctx context.Context) (tvdb.Client, error) {
+  c := r.tv
+  if c == nil {
+    c = tvdb.NewHTTP("", r.cfg.Auth.APIKey, r.cfg.Auth.PIN)
+  }
+  if err := c.Login(ctx); err != nil { return nil, err }
+  return c, nil
+}
+
+// providerName names the metadata source in messages and folder tags
+func providerName(c tvdb.Client) string {
+  if p, ok := c.(tvdb.Provider); ok { return p.Name() }
+  return "tvdb"
+}
+
+// findSeries searches by name and prefers an exact name (and year) match over the top hit.
+// The candidates are every hit with its score, for --explain.
+func (r *Runner) findSeries(ctx context.Context, c tvdb.Client, name string, year int) (tvdb.Series, []planner.Candidate, error) {
+  hits, err := c.SearchSeries(ctx, name, r.cfg.Defaults.Lang)
+  if err != nil { return tvdb.Series{}, nil, err }
+  if len(hits) == 0 { return tvdb.Series{}, nil, fmt.Errorf("no %s results for %q", providerName(c), name) }
+
+  cands := make([]planner.Candidate, len(hits))
+  best := 0
+  for i, h := range hits {
+    cands[i] = scoreSeries(h, i, name, year)
+    if cands[i].Score > cands[best].Score { best = i }
+  }
+  cands[best].Picked = true
+  return hits[best], cands, nil
+}
+
+// scoreSeries rates a search hit: an exact name, with the year when the folder gives one,
+// outranks everything; the provider's own ranking breaks ties.
+func scoreSeries(h tvdb.Series, rank int, name string, year int) planner.Candidate {
+  c := planner.Candidate{ID: h.ID, Name: h.Name, Year: h.Year}
+  var why []string
+  if strings.EqualFold(h.Name, name) {
+    if year == 0 || h.Year == year {
+      c.Score += 100
+      why = append(why, "exact name")
+      if year != 0 { why[0] = "exact name and year" }
+    } else {
+      why = append(why, fmt.Sprintf("exact name, but %d not %d", h.Year, year))
+    }
+  }
+  if rank < 10 { c.Score += 10 - rank }
+  why = append(why, fmt.Sprintf("search rank %d", rank+1))
+  c.Why = strings.Join(why, "; ")
+  return c
+}
+
+// splitYear strips a trailing "(2002)" from a folder name and returns it as a year hint.
+func splitYear(name string) (string, int) {
+  if i := strings.LastIndex(name, "("); i > 0 && strings.HasSuffix(name, ")") {
+    if y, err := strconv.Atoi(strings.TrimRight(name[i+1:], ")")); err == nil {
+      return strings.TrimSpace(name[:i]), y
+    }
+  }
+  return name, 0
+}
+
 func (r *Runner) PrintPreview(p planner.Plan, detailed bool) {
   items := append([]planner.Item(nil), p.Items...) // work on a copy
-  sort.Slice(items, func(i, j int) bool {
+  sort.SliceStable(items, func(i, j int) bool {
+    if fi, fj := items[i].Reason == "folder", items[j].Reason == "folder"; fi != fj { return fj }
     if items[i].S != items[j].S { return items[i].S < items[j].S }
     if items[i].E1 != items[j].E1 { return items[i].E1 < items[j].E1 }
     return items[i].E2 < items[j].E2
   })
   fmt.Println()
   for _, it := range items {
+    from, to := filepath.Base(it.From), filepath.Base(it.To)
+    switch it.Reason {
+    case "folder":
+      from, to = from+string(filepath.Separator), to+string(filepath.Separator)
+    case "move":
+      to = filepath.Join(filepath.Base(filepath.Dir(it.To)), to)
+    }
     if detailed {
-      fmt.Printf("%s -> %s\n", filepath.Base(it.From), filepath.Base(it.To))
+      fmt.Printf("%s -> %s\n", from, to)
     } else {
-      fmt.Println(filepath.Base(it.To))
+      fmt.Println(to)
+    }
+  }
+}
+
+// PrintExplain writes the --explain trace: the series search, then one block per file
+func PrintExplain(w io.Writer, ex *planner.Explain) {
+  if ex == nil { return }
+  fmt.Fprintf(w, "\n%s\n", ex.Folder)
+  year := ""
+  if ex.Year > 0 { year = fmt.Sprintf(" (%d)", ex.Year) }
+  fmt.Fprintf(w, "  search %s for %q%s\n", ex.Provider, ex.Query, year)
+  for _, c := range ex.Candidates {
+    mark := " "
+    if c.Picked { mark = "*" }
+    name := c.Name
+    if c.Year > 0 { name += fmt.Sprintf(" (%d)", c.Year) }
+    fmt.Fprintf(w, "  %s %3d  %s id=%d: %s\n", mark, c.Score, name, c.ID, c.Why)
+  }
+  for _, o := range ex.Orders {
+    mark := " "
+    if o.Picked { mark = "*" }
+    fmt.Fprintf(w, "  %s %3d  %s order: %s\n", mark, o.Score, o.Order, o.Why)
+  }
+  if ex.SeasonFrom != "" {
+    fmt.Fprintf(w, "  season %d from %s, %s order: %d episodes\n", ex.Season, seasonSource(ex.SeasonFrom), ex.Order, ex.Episodes)
+  } else {
+    fmt.Fprintf(w, "  all seasons, %s order: %d episodes\n", ex.Order, ex.Episodes)
+  }
+  for _, c := range ex.Conflicts { fmt.Fprintf(w, "  ! %s\n", c) }
+  for _, f := range ex.Files {
+    fmt.Fprintf(w, "\n  %s\n", f.File)
+    if f.Rule != "" {
+      fmt.Fprintf(w, "    matched  %s %q\n", f.Rule, f.Captures)
+      conflict := ""
+      if f.Conflict != "" { conflict = "; " + f.Conflict }
+      fmt.Fprintf(w, "    season   %d (from %s%s)\n", f.Season, seasonSource(f.SeasonFrom), conflict)
     }
+    if f.Title != "" { fmt.Fprintf(w, "    title    %q scores %.2f\n", f.Title, f.Score) }
+    if f.Mismatch != "" { fmt.Fprintf(w, "    ! %s; kept the number\n", f.Mismatch) }
+    if f.Lookup != "" { fmt.Fprintf(w, "    episode  %s\n", f.Lookup) }
+    res := f.Result
+    if f.Why != "" { res += ": " + f.Why }
+    fmt.Fprintf(w, "    result   %s\n", res)
+    if f.To != "" { fmt.Fprintf(w, "    name     %s\n", f.To) }
   }
 }
 
+// Confirm asks once whether to apply n changes, honouring confirmation_strict
 func (r *Runner) Confirm(in io.Reader, out io.Writer, n int) (bool, error) {
-  return confirm(in, out, n)
+  return confirm(in, out, n, r.cfg.Defaults.ConfirmationStrict)
 }
 
-type ApplyResult struct{ Total, Errors int }
+type ApplyResult struct {
+  Total, Errors int
+  Done          int            // changes made
+  Left          []planner.Item // changes not attempted because the run was interrupted
+}
+
+// Interrupted reports whether the run stopped before reaching every item
+func (res ApplyResult) Interrupted() bool { return len(res.Left) > 0 }
 
+// Apply performs the plan in order and journals every change so it can be undone.
+// Undo plans are not journaled; a clean undo drops the reverted run instead.
+// Cancelling ctx stops the run between items, so a file is never left half handled and
+// every change made is in the journal; the rest are returned in Left.
 func (r *Runner) Apply(ctx context.Context, p planner.Plan) ApplyResult {
   var res ApplyResult
   res.Total = len(p.Items)
-  for _, it := range p.Items {
-    if _, err := os.Stat(it.To); err == nil {
-      r.log.Warnf("skip (exists): %s", it.To)
-      continue
+  cur := r.run.Load() // one batch is one run, even if another starts meanwhile
+  for i, it := range p.Items {
+    if ctx.Err() != nil {
+      res.Left = p.Items[i:]
+      break
     }
-    if err := os.Rename(it.From, it.To); err != nil {
-      r.log.Errorf("rename failed: %s -> %s: %v", it.From, it.To, err)
+    // A case-only rename, as firefly -> Firefly, finds itself on a case-insensitive filesystem
+    if to, err := os.Stat(it.To); err == nil {
+      if from, ferr := os.Stat(it.From); ferr != nil || !os.SameFile(from, to) {
+        cur.log.Warnf("skip (exists): %s", it.To)
+        continue
+      }
+    }
+    if it.Reason == "move" {
+      if err := os.MkdirAll(filepath.Dir(it.To), 0o755); err != nil {
+        cur.log.Errorf("create folder failed: %s: %v", filepath.Dir(it.To), err)
+        res.Errors++
+        continue
+      }
+    }
+    err := os.Rename(it.From, it.To)
+    if err != nil {
+      cur.log.Errorf("rename failed: %s -> %s: %v", it.From, it.To, err)
       res.Errors++
-      continue
+    } else {
+      res.Done++
+    }
+    // Undoing a move leaves the folder it created behind; drop it when empty
+    if p.Undo != "" && err == nil && filepath.Dir(it.From) != filepath.Dir(it.To) {
+      _ = os.Remove(filepath.Dir(it.From))
+    }
+    if p.Undo == "" {
+      rec := state.RunRecord{Run: cur.id, Time: time.Now(), Before: it.From, After: it.To}
+      if err != nil { rec.Error = err.Error() }
+      state.AppendRun(r.cfg.Home, rec)
+    }
+  }
+  if p.Undo != "" && res.Errors == 0 && !res.Interrupted() {
+    if err := state.DropRun(r.cfg.Home, p.Undo); err != nil {
+      cur.log.Warnf("journal: %v", err)
     }
   }
   return res
 }
 
 func (r *Runner) Report(res ApplyResult) {
-  fmt.Printf("Applied %d, errors %d\n", res.Total, res.Errors)
+  if !res.Interrupted() {
+    fmt.Printf("Applied %d, errors %d\n", res.Total, res.Errors)
+    return
+  }
+  fmt.Printf("Interrupted: renamed %d of %d, errors %d. Not renamed:\n", res.Done, res.Total, res.Errors)
+  for _, it := range res.Left { fmt.Printf("  %s\n", filepath.Base(it.From)) }
+  fmt.Println("What was renamed is journaled: run again to finish, or tvrn --undo to revert it")
 }
 
-// formatName: drop series in filename. e.g. "1x03 - Title.mkv" or "1x01-1x02.mkv"
-func formatName(scheme string, pad int, multi string, _show string, season, ep, ep2 int, title, ext string) string {
+// formatName builds an episode file's name without the series, e.g. "1x03 - Title.mkv",
+// "1x01-03 - A + B + C.mkv" in range mode or "1x01x02x03.mkv" in join mode. Episodes
+// that aren't consecutive are always listed one by one. A segment of a split episode
+// follows the number and its part number the title: "1x01a - Title (1).mkv".
+func formatName(o config.Rename, season int, eps []int, seg string, titles []string, ext string) string {
+  scheme, pad := o.Scheme, o.Pad
   if scheme == "" { scheme = "XxYY" }
   if pad <= 0 { pad = 2 }
 
@@ -271,56 +653,46 @@ func formatName(scheme string, pad int, multi string, _show string, season, ep,
     }
   }
 
-  secondInRange := func(scheme string, pad, e int) string {
+  // later renders an episode after the first, at the end of a range or in a list
+  later := func(e int, inRange bool) string {
     switch scheme {
     case "SXXEYY":
-      return fmt.Sprintf("E%0*d", pad, e)     // S01E01-E02
+      return fmt.Sprintf("E%0*d", pad, e) // S01E01-E02, S01E01E02
     case "sXXeYY":
-      return fmt.Sprintf("e%0*d", pad, e)     // s01e01-e02
-    case "XxYY", "XYY", "YY":
-      return fmt.Sprintf("%0*d", pad, e)      // 1x01-02, 101-02, 01-02
-    default:
-      return fmt.Sprintf("%0*d", pad, e)
+      return fmt.Sprintf("e%0*d", pad, e) // s01e01-e02, s01e01e02
     }
+    if inRange { return fmt.Sprintf("%0*d", pad, e) } // 1x01-02, 101-02, 01-02
+    return fmt.Sprintf("x%0*d", pad, e)               // 1x01x02
   }
 
-  epPart := epFmt(season, ep)
-  if ep2 > 0 && ep2 > ep {
-    if multi == "" || strings.EqualFold(multi, "range") {
-      epPart = epPart + "-" + secondInRange(scheme, pad, ep2)
-
-      // Try to collapse "Base (1) + Base (2)" or "Base Part 1 + Base Part 2" → "Base (1-2)"
-      rawTitle := strings.TrimSpace(title)
-      if collapsed, ok := collapseTwoPartJoined(rawTitle); ok {
-        rawTitle = collapsed
-      }
-
-      cleanTitle := sanitiseTitle(rawTitle)
-      if cleanTitle != "" {
-        return fmt.Sprintf("%s - %s.%s", epPart, cleanTitle, ext)
-      }
-      return fmt.Sprintf("%s.%s", epPart, ext)
-    }
-
-    // join mode: 1x01x02 or S01E01E02
-    switch scheme {
-    case "SXXEYY", "sXXeYY":
-      epPart = epPart + fmt.Sprintf("E%0*d", pad, ep2)
-    default:
-      epPart = epPart + fmt.Sprintf("x%0*d", pad, ep2)
+  epPart := epFmt(season, eps[0])
+  join := strings.EqualFold(o.MultiEP, "join")
+  if n := len(eps); n > 1 {
+    if !join && eps[n-1]-eps[0] == n-1 {
+      epPart += "-" + later(eps[n-1], true)
+    } else {
+      for _, e := range eps[1:] { epPart += later(e, false) }
     }
-    return fmt.Sprintf("%s.%s", epPart, ext)
+    if join { return fmt.Sprintf("%s.%s", epPart, ext) }
   }
 
-  cleanTitle := strings.TrimSpace(title)
-  cleanTitle = sanitiseTitle(cleanTitle)
-
+  cleanTitle := sanitiseTitle(joinTitles(titles, o.TitleSep, o.TitleMax))
+  if seg != "" {
+    epPart += seg
+    if cleanTitle != "" { cleanTitle += fmt.Sprintf(" (%d)", seg[0]-'a'+1) }
+  }
   if cleanTitle != "" {
     return fmt.Sprintf("%s - %s.%s", epPart, cleanTitle, ext)
   }
   return fmt.Sprintf("%s.%s", epPart, ext)
 }
 
+// nameKey is how sameFileName compares paths, for map keys
+func nameKey(p string) string {
+  if runtime.GOOS == "windows" { return strings.ToLower(p) }
+  return p
+}
+
 // sameFileName returns true when the two basenames are the same.
 // Windows is case-insensitive; Unix is case-sensitive.
 func sameFileName(a, b string) bool {
@@ -330,20 +702,25 @@ func sameFileName(a, b string) bool {
   return a == b
 }
 
-func collapseTwoPartJoined(s string) (string, bool) {
-  if m := reParen2.FindStringSubmatch(s); m != nil {
-    b1, n1, b2, n2 := strings.TrimSpace(m[1]), m[2], strings.TrimSpace(m[3]), m[4]
-    if strings.EqualFold(b1, b2) && n1 == "1" && n2 == "2" {
-      return b1 + " (1-2)", true
-    }
-  }
-  if m := rePart2.FindStringSubmatch(s); m != nil {
-    b1, n1, b2, n2 := strings.TrimSpace(m[1]), m[2], strings.TrimSpace(m[3]), m[4]
-    if strings.EqualFold(b1, b2) && n1 == "1" && n2 == "2" {
-      return b1 + " (1-2)", true
+// collapseParts names consecutive parts of one story once: "Heroes Part 1", "Heroes Part 2"
+// and "Heroes Part 3" become "Heroes (1-3)", as do "Serenity (1)" and "Serenity (2)"
+func collapseParts(titles []string) (string, bool) {
+  if len(titles) < 2 { return "", false }
+  var base string
+  var first, last int
+  for i, t := range titles {
+    m := rePart.FindStringSubmatch(t)
+    if m == nil { return "", false }
+    n, _ := strconv.Atoi(m[2] + m[3])
+    b := strings.TrimSpace(m[1])
+    if i == 0 {
+      base, first, last = b, n, n
+      continue
     }
+    if !strings.EqualFold(b, base) || n != last+1 { return "", false }
+    last = n
   }
-  return "", false
+  return fmt.Sprintf("%s (%d-%d)", base, first, last), true
 }
 
 func stripPartSuffix(t, part string) (string, bool) {
@@ -0,0 +1,519 @@
+package runner
+
+import (
+  "context"
+  "errors"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+  "testing"
+
+  "github.com/GizzmoShifu/tvrn/internal/config"
+  "github.com/GizzmoShifu/tvrn/internal/config/configtest"
+  "github.com/GizzmoShifu/tvrn/internal/logx"
+  "github.com/GizzmoShifu/tvrn/internal/planner"
+  "github.com/GizzmoShifu/tvrn/internal/state"
+  "github.com/GizzmoShifu/tvrn/internal/tvdb"
+  "github.com/GizzmoShifu/tvrn/internal/tvdb/tvdbtest"
+)
+
+// testConfig mirrors config.Load's defaults with a throwaway home
+func testConfig(t *testing.T) *config.Config { return configtest.New(t) }
+
+// copyFixture copies a show under tests/ into a temp dir, since plans are built from real files
+func copyFixture(t *testing.T, show string) string {
+  t.Helper()
+  dst := t.TempDir()
+  src := filepath.Join("..", "..", "tests", show)
+  err := filepath.WalkDir(src, func(p string, d os.DirEntry, err error) error {
+    if err != nil { return err }
+    rel, _ := filepath.Rel(src, p)
+    target := filepath.Join(dst, show, rel)
+    if d.IsDir() { return os.MkdirAll(target, 0o755) }
+    b, err := os.ReadFile(p)
+    if err != nil { return err }
+    return os.WriteFile(target, b, 0o644)
+  })
+  if err != nil { t.Fatal(err) }
+  return filepath.Join(dst, show)
+}
+
+func TestPlan(t *testing.T) {
+  tests := []struct {
+    name    string
+    show    string
+    season  string // folder under the show
+    adjust  func(*config.Config)
+    want    map[string]string // source -> target basenames
+    skipped int
+    err     string
+  }{
+    {
+      name: "aired order", show: "Firefly", season: "Season 1",
+      want: map[string]string{
+        "Firefly.1x04.720p.HDTV.mkv":         "1x04 - Jaynestown.mkv",
+        "Firefly.S01E01E02.1080p.WEB-DL.mkv": "1x01-02 - The Train Job + Bushwhacked.mkv",
+        "Firefly.S01E03.1080p.WEB-DL.mkv":    "1x03 - Our Mrs. Reynolds.mkv",
+      },
+      skipped: 2, // 1x05 is already named; E15 is not in season 1
+    },
+    {
+      name: "dvd order", show: "Firefly", season: "Season 1",
+      adjust: func(c *config.Config) { c.Defaults.Order = "dvd" },
+      want: map[string]string{
+        "1x05 - Out of Gas.mkv":              "1x05 - Safe.mkv",
+        "Firefly.1x04.720p.HDTV.mkv":         "1x04 - Shindig.mkv",
+        "Firefly.S01E01E02.1080p.WEB-DL.mkv": "1x01-02 - Serenity + The Train Job.mkv",
+        "Firefly.S01E03.1080p.WEB-DL.mkv":    "1x03 - Bushwhacked.mkv",
+      },
+      skipped: 1,
+    },
+    {
+      name: "SXXEYY with pad 3", show: "Firefly", season: "Season 1",
+      adjust: func(c *config.Config) { c.Rename.Scheme, c.Rename.Pad = "SXXEYY", 3 },
+      want: map[string]string{
+        "1x05 - Out of Gas.mkv":              "S01E005 - Out of Gas.mkv",
+        "Firefly.1x04.720p.HDTV.mkv":         "S01E004 - Jaynestown.mkv",
+        "Firefly.S01E01E02.1080p.WEB-DL.mkv": "S01E001-E002 - The Train Job + Bushwhacked.mkv",
+        "Firefly.S01E03.1080p.WEB-DL.mkv":    "S01E003 - Our Mrs. Reynolds.mkv",
+      },
+      skipped: 1,
+    },
+    {
+      name: "join multi-episode", show: "Firefly", season: "Season 1",
+      adjust: func(c *config.Config) { c.Rename.MultiEP = "join" },
+      want: map[string]string{
+        "Firefly.1x04.720p.HDTV.mkv":         "1x04 - Jaynestown.mkv",
+        "Firefly.S01E01E02.1080p.WEB-DL.mkv": "1x01x02.mkv",
+        "Firefly.S01E03.1080p.WEB-DL.mkv":    "1x03 - Our Mrs. Reynolds.mkv",
+      },
+      skipped: 2,
+    },
+    {
+      name: "show the provider doesn't know", show: "MyFakeShow", season: "Season 1",
+      err: `no tvdb results for "MyFakeShow"`,
+    },
+    {
+      name: "season the provider doesn't have", show: "Firefly", season: "Season 7",
+      err: "TVDB seasons available: [1]",
+    },
+  }
+
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      srv := tvdbtest.New(t)
+      cfg := testConfig(t)
+      if tt.adjust != nil { tt.adjust(cfg) }
+      dir := filepath.Join(copyFixture(t, tt.show), tt.season)
+      if err := os.MkdirAll(dir, 0o755); err != nil { t.Fatal(err) }
+      if tt.season == "Season 7" {
+        if err := os.WriteFile(filepath.Join(dir, "Firefly.S07E01.mkv"), nil, 0o644); err != nil { t.Fatal(err) }
+      }
+
+      rn := New(cfg, logx.New("error"), tvdb.NewHTTP(srv.URL, tvdbtest.APIKey, ""))
+      plan, st, err := rn.Plan(context.Background(), dir)
+      if tt.err != "" {
+        if err == nil || !strings.Contains(err.Error(), tt.err) { t.Fatalf("err = %v, want it to contain %q", err, tt.err) }
+        return
+      }
+      if err != nil { t.Fatal(err) }
+
+      got := map[string]string{}
+      for _, it := range plan.Items {
+        if it.Reason != "rename" { t.Errorf("unexpected %s item %s", it.Reason, it.From) }
+        if filepath.Dir(it.From) != dir || filepath.Dir(it.To) != dir { t.Errorf("item leaves the folder: %+v", it) }
+        got[filepath.Base(it.From)] = filepath.Base(it.To)
+      }
+      if len(got) != len(tt.want) { t.Errorf("got %d items, want %d: %v", len(got), len(tt.want), keys(got)) }
+      for from, to := range tt.want {
+        if got[from] != to { t.Errorf("%s -> %q, want %q", from, got[from], to) }
+      }
+      if st.Skipped != tt.skipped { t.Errorf("skipped = %d, want %d", st.Skipped, tt.skipped) }
+      if plan.SeriesID != 78874 { t.Errorf("plan series = %d, want 78874", plan.SeriesID) }
+    })
+  }
+}
+
+func TestPlanExplain(t *testing.T) {
+  srv := tvdbtest.New(t)
+  dir := filepath.Join(copyFixture(t, "Firefly"), "Season 1")
+  if err := os.WriteFile(filepath.Join(dir, "notes.txt"), nil, 0o644); err != nil { t.Fatal(err) }
+  rn := New(testConfig(t), logx.New("error"), tvdb.NewHTTP(srv.URL, tvdbtest.APIKey, ""))
+  plan, _, err := rn.Plan(context.Background(), dir)
+  if err != nil { t.Fatal(err) }
+
+  ex := plan.Explain
+  if ex == nil { t.Fatal("plan has no explanation") }
+  if ex.Query != "Firefly" || ex.Season != 1 || ex.SeasonFrom != "folder" { t.Errorf("header = %+v", ex) }
+  picked := 0
+  for _, c := range ex.Candidates {
+    if c.Picked { picked = c.ID }
+  }
+  if picked != 78874 { t.Errorf("picked candidate %d, want 78874: %+v", picked, ex.Candidates) }
+
+  files := map[string]planner.FileTrace{}
+  for _, f := range ex.Files { files[f.File] = f }
+  want := map[string]planner.FileTrace{
+    "Firefly.S01E03.1080p.WEB-DL.mkv": {Rule: "SxxEyy", Episode: 3, Result: "rename", To: "1x03 - Our Mrs. Reynolds.mkv"},
+    "Firefly.1x04.720p.HDTV.mkv":      {Rule: "XxYY", Episode: 4, Result: "rename", To: "1x04 - Jaynestown.mkv"},
+    "Firefly.S01E15.720p.Web-DL.mkv":  {Rule: "SxxEyy", Episode: 15, Result: "skipped"},
+    "1x05 - Out of Gas.mkv":           {Rule: "XxYY", Episode: 5, Result: "already named", To: "1x05 - Out of Gas.mkv"},
+    "notes.txt":                       {Result: "ignored"},
+  }
+  for name, w := range want {
+    f, ok := files[name]
+    if !ok {
+      t.Errorf("no trace for %s", name)
+      continue
+    }
+    if f.Rule != w.Rule || f.Episode != w.Episode || f.Result != w.Result || f.To != w.To {
+      t.Errorf("%s: got %s E%d %s %q, want %s E%d %s %q", name, f.Rule, f.Episode, f.Result, f.To, w.Rule, w.Episode, w.Result, w.To)
+    }
+  }
+  if f := files["Firefly.S01E03.1080p.WEB-DL.mkv"]; len(f.Captures) < 3 || f.Captures[0] != "S01E03" || f.SeasonFrom != "filename" {
+    t.Errorf("S01E03 captures = %q from %s", f.Captures, f.SeasonFrom)
+  }
+}
+
+func TestChooseSeason(t *testing.T) {
+  one, three := 1, 3
+  tests := []struct {
+    name      string
+    folder    string
+    flag, pin *int
+    files     []string
+    season    int
+    from      string
+    conflicts int
+  }{
+    {name: "season folder", folder: "Season 2", files: []string{"a.S02E01.mkv"}, season: 2, from: "folder"},
+    {name: "staffel folder", folder: "Staffel 3", season: 3, from: "folder"},
+    {name: "series folder naming its season", folder: "Firefly S01", season: 1, from: "folder"},
+    {name: "flag beats folder", folder: "Season 2", flag: &three, season: 3, from: "flag", conflicts: 1},
+    {name: "folder beats pin", folder: "Series 2", pin: &one, season: 2, from: "folder", conflicts: 1},
+    {name: "pin beats files", folder: "Firefly", pin: &one, files: []string{"a.S03E01.mkv"}, season: 1, from: "pin"},
+    {name: "files agreeing", folder: "Firefly", files: []string{"a.S03E01.mkv", "a.3x02.mkv", "notes.txt"}, season: 3, from: "files"},
+    {name: "files disagreeing", folder: "Firefly", files: []string{"a.S03E01.mkv", "a.S04E01.mkv"}, conflicts: 1},
+    {name: "nothing to go on", folder: "Firefly", files: []string{"101.mkv"}},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      cfg := testConfig(t)
+      cfg.CLI.Season = tt.flag
+      rn := New(cfg, logx.New("error"), nil)
+      root := filepath.Join(t.TempDir(), tt.folder)
+      if err := os.MkdirAll(root, 0o755); err != nil { t.Fatal(err) }
+      for _, f := range tt.files {
+        if err := os.WriteFile(filepath.Join(root, f), nil, 0o644); err != nil { t.Fatal(err) }
+      }
+      if tt.pin != nil {
+        if err := rn.pins.Put(state.Pin{Path: root, Season: tt.pin}); err != nil { t.Fatal(err) }
+      }
+      entries, _ := os.ReadDir(root)
+
+      n, fromFolder := seasonFromDir(tt.folder)
+      if !fromFolder { _, n, fromFolder = showSeasonFromDir(tt.folder) }
+      got := rn.chooseSeason(root, n, fromFolder, entries)
+      if got.Season != tt.season || got.From != tt.from || len(got.Conflicts) != tt.conflicts {
+        t.Errorf("got season %d from %q, conflicts %q; want %d from %q with %d conflicts",
+          got.Season, got.From, got.Conflicts, tt.season, tt.from, tt.conflicts)
+      }
+    })
+  }
+}
+
+func TestPlanSeasonFlagOverridesFileNames(t *testing.T) {
+  srv := tvdbtest.New(t)
+  cfg := testConfig(t)
+  one := 1
+  cfg.CLI.Season = &one
+  cfg.Rename.Folders = true
+  dir := filepath.Join(t.TempDir(), "Firefly S01")
+  if err := os.MkdirAll(dir, 0o755); err != nil { t.Fatal(err) }
+  for _, f := range []string{"Firefly.S03E03.mkv", "104.mkv"} {
+    if err := os.WriteFile(filepath.Join(dir, f), nil, 0o644); err != nil { t.Fatal(err) }
+  }
+
+  rn := New(cfg, logx.New("error"), tvdb.NewHTTP(srv.URL, tvdbtest.APIKey, ""))
+  plan, _, err := rn.Plan(context.Background(), dir)
+  if err != nil { t.Fatal(err) }
+  got := map[string]string{}
+  for _, it := range plan.Items { got[filepath.Base(it.From)] = filepath.Base(it.To) }
+  want := map[string]string{
+    "Firefly.S03E03.mkv": "1x03 - Our Mrs. Reynolds.mkv",
+    "104.mkv":            "1x04 - Jaynestown.mkv",
+  }
+  if len(got) != len(want) { t.Errorf("got %v, want %v (the folder itself is not renamed)", got, want) }
+  for from, to := range want {
+    if got[from] != to { t.Errorf("%s -> %q, want %q", from, got[from], to) }
+  }
+  if ex := plan.Explain; ex.SeasonFrom != "flag" || len(ex.Conflicts) != 0 { t.Errorf("season from %q, conflicts %q", ex.SeasonFrom, ex.Conflicts) }
+}
+
+func TestPlanSplitEpisodes(t *testing.T) {
+  srv := tvdbtest.New(t)
+  dir := filepath.Join(t.TempDir(), "Firefly", "Season 1")
+  if err := os.MkdirAll(dir, 0o755); err != nil { t.Fatal(err) }
+  for _, f := range []string{"Firefly.S01E03a.mkv", "Firefly.S01E03b.mkv", "Firefly.S01E04.pt1.mkv", "Firefly.S01E04.pt2.mkv",
+    "Firefly.1x05.720p.mkv", "Firefly.S01E05.1080p.mkv"} {
+    if err := os.WriteFile(filepath.Join(dir, f), nil, 0o644); err != nil { t.Fatal(err) }
+  }
+
+  rn := New(testConfig(t), logx.New("error"), tvdb.NewHTTP(srv.URL, tvdbtest.APIKey, ""))
+  plan, st, err := rn.Plan(context.Background(), dir)
+  if err != nil { t.Fatal(err) }
+  got := map[string]string{}
+  for _, it := range plan.Items { got[filepath.Base(it.From)] = filepath.Base(it.To) }
+  want := map[string]string{
+    "Firefly.S01E03a.mkv":    "1x03a - Our Mrs. Reynolds (1).mkv",
+    "Firefly.S01E03b.mkv":    "1x03b - Our Mrs. Reynolds (2).mkv",
+    "Firefly.S01E04.pt1.mkv": "1x04a - Jaynestown (1).mkv",
+    "Firefly.S01E04.pt2.mkv": "1x04b - Jaynestown (2).mkv",
+    "Firefly.1x05.720p.mkv":  "1x05 - Out of Gas.mkv",
+  }
+  if len(got) != len(want) { t.Errorf("got %d items, want %d: %v", len(got), len(want), got) }
+  for from, to := range want {
+    if got[from] != to { t.Errorf("%s -> %q, want %q", from, got[from], to) }
+  }
+  if st.Skipped != 1 { t.Errorf("skipped = %d, want 1: the second file named 1x05 clashes", st.Skipped) }
+}
+
+func TestPlanTitles(t *testing.T) {
+  srv := tvdbtest.New(t)
+  dir := filepath.Join(t.TempDir(), "Firefly", "Season 1")
+  if err := os.MkdirAll(dir, 0o755); err != nil { t.Fatal(err) }
+  for _, f := range []string{"Firefly - Ariel.mkv", "Firefly.S01E20.War.Stories.720p.mkv", "Firefly.S01E05.Safe.mkv",
+    "Firefly - Behind the Scenes.mkv"} {
+    if err := os.WriteFile(filepath.Join(dir, f), nil, 0o644); err != nil { t.Fatal(err) }
+  }
+
+  rn := New(testConfig(t), logx.New("error"), tvdb.NewHTTP(srv.URL, tvdbtest.APIKey, ""))
+  plan, _, err := rn.Plan(context.Background(), dir)
+  if err != nil { t.Fatal(err) }
+  got := map[string]string{}
+  for _, it := range plan.Items { got[filepath.Base(it.From)] = filepath.Base(it.To) }
+  want := map[string]string{
+    "Firefly - Ariel.mkv":                  "1x08 - Ariel.mkv",
+    "Firefly.S01E20.War.Stories.720p.mkv": "1x09 - War Stories.mkv",
+    "Firefly.S01E05.Safe.mkv":              "1x05 - Out of Gas.mkv", // the number wins, but is flagged
+  }
+  if len(got) != len(want) { t.Errorf("got %d items, want %d: %v", len(got), len(want), got) }
+  for from, to := range want {
+    if got[from] != to { t.Errorf("%s -> %q, want %q", from, got[from], to) }
+  }
+
+  traces := map[string]planner.FileTrace{}
+  for _, f := range plan.Explain.Files { traces[f.File] = f }
+  if tr := traces["Firefly - Ariel.mkv"]; tr.Rule != "title" || tr.Score != 1 { t.Errorf("title-only trace = %+v", tr) }
+  if tr := traces["Firefly.S01E05.Safe.mkv"]; !strings.Contains(tr.Mismatch, "S01E07") { t.Errorf("mismatch = %q, want S01E07", tr.Mismatch) }
+  if tr := traces["Firefly - Behind the Scenes.mkv"]; tr.Result != "ignored" { t.Errorf("unmatched title = %+v", tr) }
+
+  // Turned off, a name with no number is ignored again
+  cfg := testConfig(t)
+  cfg.Match.Titles = false
+  plan, _, err = New(cfg, logx.New("error"), tvdb.NewHTTP(srv.URL, tvdbtest.APIKey, "")).Plan(context.Background(), dir)
+  if err != nil { t.Fatal(err) }
+  if len(plan.Items) != 1 { t.Errorf("with titles off got %d items, want 1", len(plan.Items)) }
+}
+
+func TestPlanOrderAuto(t *testing.T) {
+  tests := []struct {
+    name  string
+    files map[string]int64 // name -> size
+    want  string           // order picked, or empty when it must ask
+  }{
+    {
+      name:  "aired titles",
+      files: map[string]int64{"1x05 - Out of Gas.mkv": 0, "Firefly.1x04.Jaynestown.mkv": 0, "Firefly.S01E03.mkv": 0},
+      want:  "aired",
+    },
+    {
+      name:  "dvd titles",
+      files: map[string]int64{"Firefly.S01E01.Serenity.mkv": 0, "Firefly.S01E05.Safe.720p.mkv": 0, "Firefly.S01E02.mkv": 0},
+      want:  "dvd",
+    },
+    {
+      name:  "a double-length first file",
+      files: map[string]int64{"Firefly.S01E01.mkv": 2000, "Firefly.S01E02.mkv": 1000, "Firefly.S01E03.mkv": 1000, "Firefly.S01E04.mkv": 1000},
+      want:  "dvd",
+    },
+    {
+      name:  "numbers only",
+      files: map[string]int64{"Firefly.S01E02.mkv": 0, "Firefly.S01E03.mkv": 0},
+    },
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      srv := tvdbtest.New(t)
+      dir := filepath.Join(t.TempDir(), "Firefly", "Season 1")
+      if err := os.MkdirAll(dir, 0o755); err != nil { t.Fatal(err) }
+      for f, size := range tt.files {
+        if err := os.WriteFile(filepath.Join(dir, f), nil, 0o644); err != nil { t.Fatal(err) }
+        if err := os.Truncate(filepath.Join(dir, f), size); err != nil { t.Fatal(err) }
+      }
+      cfg := testConfig(t)
+      cfg.Defaults.Order = "auto"
+      rn := New(cfg, logx.New("error"), tvdb.NewHTTP(srv.URL, tvdbtest.APIKey, ""))
+      plan, _, err := rn.Plan(context.Background(), dir)
+
+      var oe *OrderError
+      if tt.want == "" {
+        if !errors.As(err, &oe) { t.Fatalf("err = %v, want an OrderError", err) }
+        // Answering pins the order on the series folder, and the next plan uses it
+        if err := rn.PinOrder(dir, oe.SeriesID, "dvd"); err != nil { t.Fatal(err) }
+        plan, _, err = rn.Plan(context.Background(), dir)
+        if err != nil { t.Fatal(err) }
+        if pin, _ := rn.pins.Get(filepath.Dir(dir)); pin.Order != "dvd" || pin.SeriesID != 78874 { t.Errorf("pin = %+v", pin) }
+        tt.want = "dvd"
+      }
+      if err != nil { t.Fatal(err) }
+      if plan.Order != tt.want { t.Errorf("order = %q, want %q; scores %+v", plan.Order, tt.want, plan.Explain.Orders) }
+      if len(plan.Explain.Orders) == 0 || !plan.Explain.Orders[0].Picked { t.Errorf("scores = %+v, want the pick first", plan.Explain.Orders) }
+    })
+  }
+}
+
+func TestTitleText(t *testing.T) {
+  tests := []struct{ in, want string }{
+    {"Firefly - Out of Gas", "out of gas"},
+    {".Our.Mrs.Reynolds.1080p.WEB-DL", "our mrs reynolds"},
+    {" - Jaynestown [GROUP]", "jaynestown"},
+    {"Firefly (2002) - Trash.720p.HDTV", "trash"},
+    {".PROPER.720p", ""},
+  }
+  for _, tt := range tests {
+    if got := titleText(tt.in, "Firefly"); got != tt.want { t.Errorf("titleText(%q) = %q, want %q", tt.in, got, tt.want) }
+  }
+}
+
+func TestMatchTitle(t *testing.T) {
+  eps := []tvdb.Episode{{Season: 1, Number: 1, Title: "The Train Job"}, {Season: 1, Number: 7, Title: "Safe"},
+    {Season: 1, Number: 13, Title: "Trash"}, {Season: 1, Number: 14, Title: "The Message"}}
+  tests := []struct {
+    text   string
+    number int // 0 for no match
+  }{
+    {"the train job", 1},
+    {"the trian job", 1}, // a typo still counts
+    {"safe extended", 7}, // holds the whole title
+    {"the mesage", 14},
+    {"objects in space", 0},
+    {"the", 0},
+  }
+  for _, tt := range tests {
+    ep, score, ok := matchTitle(tt.text, eps, 0.8)
+    got := 0
+    if ok { got = ep.Number }
+    if got != tt.number { t.Errorf("%q -> E%d (best %q, %.2f), want E%d", tt.text, got, ep.Title, score, tt.number) }
+  }
+}
+
+func TestFormatName(t *testing.T) {
+  tests := []struct {
+    scheme, multi string
+    pad           int
+    season, ep    int
+    ep2           int
+    title, want   string
+  }{
+    {"XxYY", "range", 2, 1, 3, 0, "Bushwhacked", "1x03 - Bushwhacked.mkv"},
+    {"", "", 0, 1, 3, 0, "Bushwhacked", "1x03 - Bushwhacked.mkv"},
+    {"SXXEYY", "range", 2, 1, 3, 0, "Bushwhacked", "S01E03 - Bushwhacked.mkv"},
+    {"sXXeYY", "range", 2, 10, 3, 0, "Bushwhacked", "s10e03 - Bushwhacked.mkv"},
+    {"XYY", "range", 2, 1, 3, 0, "Bushwhacked", "103 - Bushwhacked.mkv"},
+    {"YY", "range", 3, 1, 3, 0, "Bushwhacked", "003 - Bushwhacked.mkv"},
+    {"XxYY", "range", 2, 1, 3, 0, "", "1x03.mkv"},
+    {"XxYY", "range", 2, 1, 1, 2, "The Train Job + Bushwhacked", "1x01-02 - The Train Job + Bushwhacked.mkv"},
+    {"SXXEYY", "range", 2, 1, 1, 2, "Serenity (1) + Serenity (2)", "S01E01-E02 - Serenity (1-2).mkv"},
+    {"XxYY", "range", 2, 3, 4, 5, "Heroes Part 1 + Heroes Part 2", "3x04-05 - Heroes (1-2).mkv"},
+    {"XxYY", "join", 2, 1, 1, 2, "A + B", "1x01x02.mkv"},
+    {"SXXEYY", "join", 2, 1, 1, 2, "A + B", "S01E01E02.mkv"},
+    {"XxYY", "range", 2, 1, 3, 2, "Backwards", "1x03 - Backwards.mkv"}, // ep2 before ep is ignored
+    {"XxYY", "range", 2, 2, 7, 0, `Who: "What"? A/B <c> | d*`, "2x07 - Who - 'What' A-B (c) - d.mkv"},
+  }
+  for _, tt := range tests {
+    eps := []int{tt.ep}
+    if tt.ep2 > tt.ep { eps = append(eps, tt.ep2) }
+    o := config.Rename{Scheme: tt.scheme, Pad: tt.pad, MultiEP: tt.multi}
+    got := formatName(o, tt.season, eps, "", strings.Split(tt.title, " + "), "mkv")
+    if got != tt.want {
+      t.Errorf("formatName(%q, %d, %q, S%dE%d-%d, %q) = %q, want %q", tt.scheme, tt.pad, tt.multi, tt.season, tt.ep, tt.ep2, tt.title, got, tt.want)
+    }
+  }
+}
+
+func TestFormatNameMultiEpisode(t *testing.T) {
+  tests := []struct {
+    scheme, multi, sep string
+    max                int
+    eps                []int
+    titles             []string
+    want               string
+  }{
+    {"XxYY", "range", "", 0, []int{1, 2, 3}, []string{"Serenity", "The Train Job", "Bushwhacked"}, "1x01-03 - Serenity + The Train Job + Bushwhacked.mkv"},
+    {"SXXEYY", "range", "", 0, []int{1, 2, 3, 4}, []string{"A", "B", "C", "D"}, "S01E01-E04 - A + B + C + D.mkv"},
+    {"XxYY", "range", "", 0, []int{1, 3}, []string{"A", "C"}, "1x01x03 - A + C.mkv"},
+    {"SXXEYY", "range", "", 0, []int{1, 3}, []string{"A", "C"}, "S01E01E03 - A + C.mkv"},
+    {"XxYY", "join", "", 0, []int{1, 2, 3}, []string{"A", "B", "C"}, "1x01x02x03.mkv"},
+    {"sXXeYY", "join", "", 0, []int{1, 2, 3}, []string{"A", "B", "C"}, "s01e01e02e03.mkv"},
+    {"XxYY", "range", " & ", 0, []int{1, 2}, []string{"A", "B"}, "1x01-02 - A & B.mkv"},
+    {"XxYY", "range", "", 0, []int{4, 5, 6}, []string{"Heroes Part 1", "Heroes Part 2", "Heroes - Part 3"}, "1x04-06 - Heroes (1-3).mkv"},
+    {"XxYY", "range", "", 0, []int{4, 5}, []string{"Heroes Part 2", "Heroes Part 4"}, "1x04-05 - Heroes Part 2 + Heroes Part 4.mkv"},
+    {"XxYY", "range", "", 0, []int{1, 2}, []string{"Pilot", "Pilot"}, "1x01-02 - Pilot.mkv"},
+    {"XxYY", "range", "", 0, []int{1, 2}, []string{"", "B"}, "1x01-02 - B.mkv"},
+    {"XxYY", "range", "", 30, []int{1, 2, 3}, []string{"Serenity", "The Train Job", "Bushwhacked"}, "1x01-03 - Serenity + The Train Job….mkv"},
+    {"XxYY", "range", "", 20, []int{1, 2}, []string{"A Very Long Opening Episode Title", "B"}, "1x01-02 - A Very Long Opening….mkv"},
+  }
+  for _, tt := range tests {
+    o := config.Rename{Scheme: tt.scheme, Pad: 2, MultiEP: tt.multi, TitleSep: tt.sep, TitleMax: tt.max}
+    if got := formatName(o, 1, tt.eps, "", tt.titles, "mkv"); got != tt.want {
+      t.Errorf("formatName(%s %s, %v, %q) = %q, want %q", tt.scheme, tt.multi, tt.eps, tt.titles, got, tt.want)
+    }
+  }
+}
+
+func keys(m map[string]string) []string {
+  var out []string
+  for k := range m { out = append(out, k) }
+  sort.Strings(out)
+  return out
+}
+
+// cancelAfter is a context that reports cancellation once Err has been asked n times
+type cancelAfter struct {
+  context.Context
+  n int
+}
+
+func (c *cancelAfter) Err() error {
+  if c.n <= 0 { return context.Canceled }
+  c.n--
+  return nil
+}
+
+func TestApplyStopsBetweenItemsWhenCancelled(t *testing.T) {
+  cfg := testConfig(t)
+  dir := t.TempDir()
+  var p planner.Plan
+  for _, n := range []string{"a", "b", "c"} {
+    from := filepath.Join(dir, n+".mkv")
+    if err := os.WriteFile(from, nil, 0o644); err != nil { t.Fatal(err) }
+    p.Items = append(p.Items, planner.Item{From: from, To: filepath.Join(dir, "1x0"+n+".mkv"), Reason: "rename"})
+  }
+
+  rn := New(cfg, logx.New("error"), nil)
+  rn.NewRun()
+  res := rn.Apply(&cancelAfter{Context: context.Background(), n: 1}, p)
+
+  if res.Done != 1 || !res.Interrupted() || len(res.Left) != 2 {
+    t.Fatalf("done %d, left %d; want 1 renamed and 2 left", res.Done, len(res.Left))
+  }
+  if _, err := os.Stat(p.Items[0].To); err != nil { t.Errorf("first item not renamed: %v", err) }
+  for _, it := range res.Left {
+    if _, err := os.Stat(it.From); err != nil { t.Errorf("%s touched after cancel: %v", it.From, err) }
+  }
+  _, recs, err := state.LastRun(cfg.Home)
+  if err != nil { t.Fatal(err) }
+  if len(recs) != 1 || recs[0].After != p.Items[0].To { t.Errorf("journal = %+v, want just the first rename", recs) }
+}
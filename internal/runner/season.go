@@ -0,0 +1,97 @@
+package runner
+
+import (
+  "fmt"
+  "os"
+  "regexp"
+  "sort"
+  "strings"
+)
+
+// showSeasonRe matches a series folder that also names its season: "Firefly S01",
+// "Firefly - Season 2", "Dark Staffel 3"
+var showSeasonRe = regexp.MustCompile(`(?i)^(.+?)[\s._-]+(?:s|season|series|staffel|saison|temporada|stagione)[\s._-]*(\d{1,2})$`)
+
+// showSeasonFromDir splits such a folder name into the series and the season
+func showSeasonFromDir(name string) (string, int, bool) {
+  m := showSeasonRe.FindStringSubmatch(strings.TrimSpace(name))
+  if m == nil { return "", 0, false }
+  n := 0
+  fmt.Sscanf(m[2], "%d", &n)
+  return strings.TrimRight(m[1], " ._-"), n, true
+}
+
+// seasonChoice is the season a folder is planned against and where it came from
+type seasonChoice struct {
+  Season    int
+  From      string   // flag | folder | pin | files, or empty to look up every season
+  Force     bool     // files are read as Season whatever season their names say
+  Conflicts []string // sources that disagreed with the one used
+}
+
+// chooseSeason applies the season precedence: --season, then the folder name, then a pin
+// for the folder, then the file names when they all name one season. The flag and a pin
+// are deliberate, so they override what the files say; a folder only sets the default.
+func (r *Runner) chooseSeason(root string, folder int, fromFolder bool, entries []os.DirEntry) seasonChoice {
+  type source struct {
+    from   string
+    season int
+  }
+  var sources []source
+  if s := r.cfg.CLI.Season; s != nil { sources = append(sources, source{"flag", *s}) }
+  if fromFolder { sources = append(sources, source{"folder", folder}) }
+  if pin, ok := r.pins.Get(root); ok && pin.Season != nil { sources = append(sources, source{"pin", *pin.Season}) }
+  files := r.fileSeasons(entries)
+  if len(files) == 1 { sources = append(sources, source{"files", files[0]}) }
+
+  var ch seasonChoice
+  if len(sources) == 0 {
+    if len(files) > 1 {
+      ch.Conflicts = append(ch.Conflicts, fmt.Sprintf("the file names say seasons %s; looking up every season", joinInts(files)))
+    }
+    return ch
+  }
+  used := sources[0]
+  ch.Season, ch.From = used.season, used.from
+  ch.Force = used.from == "flag" || used.from == "pin"
+  for _, s := range sources[1:] {
+    if s.season == used.season || s.from == "files" { continue } // files are checked one by one
+    ch.Conflicts = append(ch.Conflicts, fmt.Sprintf("%s says season %d, but %s says %d and wins",
+      seasonSource(s.from), s.season, seasonSource(used.from), used.season))
+  }
+  return ch
+}
+
+// fileSeasons lists the seasons named by the media files' own SxxEyy or 1x02 numbers
+func (r *Runner) fileSeasons(entries []os.DirEntry) []int {
+  seen := map[int]bool{}
+  var out []int
+  for _, e := range entries {
+    if e.IsDir() || !IsMedia(e.Name()) { continue }
+    p, ok := r.parse.Parse(e.Name(), 0, "")
+    if !ok || seen[p.Season] { continue }
+    seen[p.Season] = true
+    out = append(out, p.Season)
+  }
+  sort.Ints(out)
+  return out
+}
+
+// seasonSource names where a season came from, for messages and --explain
+func seasonSource(from string) string {
+  switch from {
+  case "flag": return "--season"
+  case "folder": return "the folder name"
+  case "pin": return "the pin"
+  case "files": return "the file names"
+  case "filename": return "the file name"
+  case "title": return "the episode title"
+  }
+  return from
+}
+
+func joinInts(ns []int) string {
+  s := make([]string, len(ns))
+  for i, n := range ns { s[i] = fmt.Sprint(n) }
+  return strings.Join(s, ", ")
+}
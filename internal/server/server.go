@@ -0,0 +1,348 @@
+// Package server is the local HTTP API and web UI behind `tvrn serve`. It plans
+// and applies through the same Runner as the command line, one request at a time.
+package server
+
+import (
+  "crypto/rand"
+  "crypto/subtle"
+  "embed"
+  "encoding/hex"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io/fs"
+  "mime"
+  "net"
+  "net/http"
+  "net/url"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "sync"
+  "time"
+
+  "github.com/GizzmoShifu/tvrn/internal/config"
+  "github.com/GizzmoShifu/tvrn/internal/planner"
+  "github.com/GizzmoShifu/tvrn/internal/runner"
+  "github.com/GizzmoShifu/tvrn/internal/state"
+)
+
+//go:embed ui
+var uiFiles embed.FS
+
+// maxPlans bounds how many unapplied plans are kept in memory
+const maxPlans = 32
+
+type Server struct {
+  cfg   *config.Config
+  rn    *runner.Runner
+  token string          // required on every API call
+  root  string          // only paths inside it can be planned
+  hosts map[string]bool // Host and Origin values that name this server
+
+  mu    sync.Mutex // the runner and the filesystem are not shared between requests
+  plans map[string]*session
+  order []string // plan IDs, oldest first
+}
+
+// session is a plan under review; items can be switched off before it is applied
+type session struct {
+  ID      string
+  Path    string
+  Plan    planner.Plan
+  Stats   planner.Stats
+  Enabled []bool
+  Applied bool
+  Created time.Time
+  Explain bool // include the match trace in views
+}
+
+// Item is the API view of a planner.Item
+type Item struct {
+  Index    int    `json:"index"`
+  From     string `json:"from"`
+  To       string `json:"to"`
+  Reason   string `json:"reason"`
+  Season   int    `json:"season"`
+  Episode  int    `json:"episode"`
+  Episode2 int    `json:"episode2,omitempty"`
+  Episodes []int  `json:"episodes,omitempty"` // every episode, when several
+  Segment  string `json:"segment,omitempty"`  // a, b… for one file of a split episode
+  Enabled  bool   `json:"enabled"`
+}
+
+type planView struct {
+  ID      string           `json:"id"`
+  Path    string           `json:"path"`
+  Items   []Item           `json:"items"`
+  Skipped int              `json:"skipped"`
+  Applied bool             `json:"applied"`
+  Explain *planner.Explain `json:"explain,omitempty"`
+}
+
+// New serves rn for requests carrying token, planning inside root, from pages and
+// clients that reach it as addr, the address it listens on.
+func New(cfg *config.Config, rn *runner.Runner, token, root, addr string) *Server {
+  return &Server{cfg: cfg, rn: rn, token: token, root: root, hosts: Hosts(addr), plans: map[string]*session{}}
+}
+
+// Hosts lists the host:port values a server listening on addr is reached by: addr itself,
+// the loopback names when it is local, and the machine's names and addresses when it
+// listens on all interfaces.
+func Hosts(addr string) map[string]bool {
+  out := map[string]bool{}
+  host, port, err := net.SplitHostPort(addr)
+  if err != nil { return out }
+  names := []string{host}
+  ip := net.ParseIP(host)
+  if host == "localhost" || host == "" || (ip != nil && (ip.IsLoopback() || ip.IsUnspecified())) {
+    names = append(names, "localhost", "127.0.0.1", "::1")
+  }
+  if host == "" || (ip != nil && ip.IsUnspecified()) {
+    if h, err := os.Hostname(); err == nil { names = append(names, h) }
+    addrs, _ := net.InterfaceAddrs()
+    for _, a := range addrs {
+      if n, ok := a.(*net.IPNet); ok { names = append(names, n.IP.String()) }
+    }
+  }
+  for _, n := range names { out[strings.ToLower(net.JoinHostPort(n, port))] = true }
+  return out
+}
+
+// Handler routes the API under /api and serves the UI from everything else
+func (s *Server) Handler() http.Handler {
+  mux := http.NewServeMux()
+  mux.HandleFunc("POST /api/plans", s.createPlan)
+  mux.HandleFunc("GET /api/plans/{id}", s.getPlan)
+  mux.HandleFunc("PATCH /api/plans/{id}/items/{n}", s.toggleItem)
+  mux.HandleFunc("POST /api/plans/{id}/apply", s.applyPlan)
+  mux.HandleFunc("POST /api/undo", s.undo)
+  mux.HandleFunc("GET /api/journal", s.journal)
+
+  ui, _ := fs.Sub(uiFiles, "ui")
+  mux.Handle("GET /", http.FileServer(http.FS(ui)))
+  return s.guard(s.auth(mux))
+}
+
+// guard turns away requests another site could make on the user's behalf: a Host or
+// Origin that isn't this server, as DNS rebinding and cross-site pages send, and an API
+// call with a body that isn't JSON, as a form or a "simple" cross-site fetch sends.
+func (s *Server) guard(next http.Handler) http.Handler {
+  return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if !s.hosts[strings.ToLower(r.Host)] {
+      writeError(w, http.StatusForbidden, fmt.Errorf("unexpected host %q", r.Host))
+      return
+    }
+    if o := r.Header.Get("Origin"); o != "" {
+      u, err := url.Parse(o)
+      if err != nil || u.Scheme != "http" || !s.hosts[strings.ToLower(u.Host)] {
+        writeError(w, http.StatusForbidden, fmt.Errorf("unexpected origin %q", o))
+        return
+      }
+    }
+    if strings.HasPrefix(r.URL.Path, "/api/") && r.Method != http.MethodGet {
+      if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/json" {
+        writeError(w, http.StatusUnsupportedMediaType, errors.New("Content-Type must be application/json"))
+        return
+      }
+    }
+    next.ServeHTTP(w, r)
+  })
+}
+
+// auth requires the token on every API call. The UI itself is static and asks for the
+// token, sending it back as a bearer header.
+func (s *Server) auth(next http.Handler) http.Handler {
+  return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if strings.HasPrefix(r.URL.Path, "/api/") {
+      got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+      if s.token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) != 1 {
+        writeError(w, http.StatusUnauthorized, errors.New("missing or wrong token"))
+        return
+      }
+    }
+    next.ServeHTTP(w, r)
+  })
+}
+
+func (s *Server) createPlan(w http.ResponseWriter, r *http.Request) {
+  var req struct {
+    Path    string `json:"path"`
+    Explain bool   `json:"explain"`
+  }
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    writeError(w, http.StatusBadRequest, err)
+    return
+  }
+  path, err := s.checkPath(req.Path)
+  if err != nil {
+    writeError(w, http.StatusBadRequest, err)
+    return
+  }
+
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  plan, st, err := s.rn.Plan(r.Context(), path)
+  if err != nil && !errors.Is(err, runner.ErrNothingToRename) {
+    if req.Explain && plan.Explain != nil {
+      writeJSON(w, http.StatusUnprocessableEntity, map[string]any{"error": err.Error(), "explain": plan.Explain})
+      return
+    }
+    writeError(w, http.StatusUnprocessableEntity, err)
+    return
+  }
+  sess := &session{ID: newID(), Path: path, Plan: plan, Stats: st, Enabled: make([]bool, len(plan.Items)), Created: time.Now(),
+    Explain: req.Explain}
+  for i := range sess.Enabled { sess.Enabled[i] = true }
+  s.keep(sess)
+  writeJSON(w, http.StatusCreated, sess.view())
+}
+
+func (s *Server) getPlan(w http.ResponseWriter, r *http.Request) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  sess, ok := s.plans[r.PathValue("id")]
+  if !ok {
+    writeError(w, http.StatusNotFound, errors.New("no such plan"))
+    return
+  }
+  writeJSON(w, http.StatusOK, sess.view())
+}
+
+func (s *Server) toggleItem(w http.ResponseWriter, r *http.Request) {
+  var req struct{ Enabled bool `json:"enabled"` }
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+    writeError(w, http.StatusBadRequest, err)
+    return
+  }
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  sess, ok := s.plans[r.PathValue("id")]
+  if !ok {
+    writeError(w, http.StatusNotFound, errors.New("no such plan"))
+    return
+  }
+  n, err := strconv.Atoi(r.PathValue("n"))
+  if err != nil || n < 0 || n >= len(sess.Enabled) {
+    writeError(w, http.StatusNotFound, errors.New("no such item"))
+    return
+  }
+  if sess.Applied {
+    writeError(w, http.StatusConflict, errors.New("plan already applied"))
+    return
+  }
+  sess.Enabled[n] = req.Enabled
+  writeJSON(w, http.StatusOK, sess.view())
+}
+
+func (s *Server) applyPlan(w http.ResponseWriter, r *http.Request) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  sess, ok := s.plans[r.PathValue("id")]
+  if !ok {
+    writeError(w, http.StatusNotFound, errors.New("no such plan"))
+    return
+  }
+  if sess.Applied {
+    writeError(w, http.StatusConflict, errors.New("plan already applied"))
+    return
+  }
+  var chosen planner.Plan
+  for i, it := range sess.Plan.Items {
+    if sess.Enabled[i] { chosen.Items = append(chosen.Items, it) }
+  }
+  s.rn.NewRun()
+  res := s.rn.Apply(r.Context(), chosen)
+  sess.Applied = true
+  writeJSON(w, http.StatusOK, map[string]int{"total": res.Total, "errors": res.Errors})
+}
+
+func (s *Server) undo(w http.ResponseWriter, r *http.Request) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  plan, err := s.rn.PlanUndo()
+  if err != nil {
+    writeError(w, http.StatusConflict, err)
+    return
+  }
+  res := s.rn.Apply(r.Context(), plan)
+  writeJSON(w, http.StatusOK, map[string]any{"run": plan.Undo, "total": res.Total, "errors": res.Errors})
+}
+
+// journal lists applied runs, newest first
+func (s *Server) journal(w http.ResponseWriter, r *http.Request) {
+  recs, err := state.LoadRuns(s.cfg.Home)
+  if err != nil {
+    writeError(w, http.StatusInternalServerError, err)
+    return
+  }
+  type run struct {
+    Run     string            `json:"run"`
+    Records []state.RunRecord `json:"records"`
+  }
+  out := []run{}
+  for _, rec := range recs {
+    if len(out) == 0 || out[len(out)-1].Run != rec.Run { out = append(out, run{Run: rec.Run}) }
+    out[len(out)-1].Records = append(out[len(out)-1].Records, rec)
+  }
+  for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 { out[i], out[j] = out[j], out[i] }
+  writeJSON(w, http.StatusOK, out)
+}
+
+// ===== helpers =====
+
+// checkPath resolves a requested folder, relative to the root, and keeps it inside the root
+func (s *Server) checkPath(p string) (string, error) {
+  if strings.TrimSpace(p) == "" { return "", errors.New("path is required") }
+  if s.root == "" { return "", errors.New("no root folder configured") }
+  if !filepath.IsAbs(p) { p = filepath.Join(s.root, p) }
+  abs, err := filepath.Abs(p)
+  if err != nil { return "", err }
+  rel, err := filepath.Rel(s.root, abs)
+  if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+    return "", fmt.Errorf("%s is outside %s", abs, s.root)
+  }
+  st, err := os.Stat(abs)
+  if err != nil { return "", err }
+  if !st.IsDir() { return "", fmt.Errorf("not a folder: %s", abs) }
+  return abs, nil
+}
+
+// keep stores a session, dropping the oldest once there are too many
+func (s *Server) keep(sess *session) {
+  s.plans[sess.ID] = sess
+  s.order = append(s.order, sess.ID)
+  for len(s.order) > maxPlans {
+    delete(s.plans, s.order[0])
+    s.order = s.order[1:]
+  }
+}
+
+func (sess *session) view() planView {
+  v := planView{ID: sess.ID, Path: sess.Path, Skipped: sess.Stats.Skipped, Applied: sess.Applied, Items: []Item{}}
+  if sess.Explain { v.Explain = sess.Plan.Explain }
+  for i, it := range sess.Plan.Items {
+    v.Items = append(v.Items, Item{
+      Index: i, From: it.From, To: it.To, Reason: it.Reason,
+      Season: it.S, Episode: it.E1, Episode2: it.E2, Episodes: it.Eps, Segment: it.Seg, Enabled: sess.Enabled[i],
+    })
+  }
+  return v
+}
+
+func newID() string {
+  b := make([]byte, 8)
+  _, _ = rand.Read(b)
+  return hex.EncodeToString(b)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+  w.Header().Set("Content-Type", "application/json")
+  w.WriteHeader(code)
+  _ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+  writeJSON(w, code, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+  "net/http"
+  "net/http/httptest"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+
+  "github.com/GizzmoShifu/tvrn/internal/config/configtest"
+  "github.com/GizzmoShifu/tvrn/internal/logx"
+  "github.com/GizzmoShifu/tvrn/internal/runner"
+  "github.com/GizzmoShifu/tvrn/internal/tvdb"
+  "github.com/GizzmoShifu/tvrn/internal/tvdb/tvdbtest"
+)
+
+func TestGuard(t *testing.T) {
+  srv := tvdbtest.New(t)
+  cfg := configtest.New(t)
+  cfg.CLI.Yes = true
+
+  root := t.TempDir()
+  season := filepath.Join(root, "Firefly", "Season 1")
+  if err := os.MkdirAll(season, 0o755); err != nil { t.Fatal(err) }
+  if err := os.WriteFile(filepath.Join(season, "Firefly.S01E03.mkv"), nil, 0o644); err != nil { t.Fatal(err) }
+
+  rn := runner.New(cfg, logx.New("error"), tvdb.NewHTTP(srv.URL, tvdbtest.APIKey, ""))
+  h := New(cfg, rn, "s3cret", root, "127.0.0.1:8765").Handler()
+
+  tests := []struct {
+    name   string
+    host   string
+    origin string
+    ctype  string
+    token  string
+    body   string
+    want   int
+  }{
+    {"ok", "127.0.0.1:8765", "", "application/json", "s3cret", `{"path": "Firefly/Season 1"}`, http.StatusCreated},
+    {"localhost", "localhost:8765", "http://localhost:8765", "application/json; charset=utf-8", "s3cret", `{"path": "Firefly/Season 1"}`, http.StatusCreated},
+    {"no token", "127.0.0.1:8765", "", "application/json", "", `{"path": "Firefly/Season 1"}`, http.StatusUnauthorized},
+    {"wrong token", "127.0.0.1:8765", "", "application/json", "guess", `{"path": "Firefly/Season 1"}`, http.StatusUnauthorized},
+    {"rebound host", "evil.example:8765", "", "application/json", "s3cret", `{"path": "Firefly/Season 1"}`, http.StatusForbidden},
+    {"other port", "127.0.0.1:9000", "", "application/json", "s3cret", `{"path": "Firefly/Season 1"}`, http.StatusForbidden},
+    {"cross-site", "127.0.0.1:8765", "https://evil.example", "application/json", "s3cret", `{"path": "Firefly/Season 1"}`, http.StatusForbidden},
+    {"text/plain", "127.0.0.1:8765", "", "text/plain", "s3cret", `{"path": "Firefly/Season 1"}`, http.StatusUnsupportedMediaType},
+    {"no type", "127.0.0.1:8765", "", "", "s3cret", `{"path": "Firefly/Season 1"}`, http.StatusUnsupportedMediaType},
+    {"outside root", "127.0.0.1:8765", "", "application/json", "s3cret", `{"path": "/etc"}`, http.StatusBadRequest},
+    {"escapes root", "127.0.0.1:8765", "", "application/json", "s3cret", `{"path": "../.."}`, http.StatusBadRequest},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      req := httptest.NewRequest(http.MethodPost, "/api/plans", strings.NewReader(tt.body))
+      req.Host = tt.host
+      if tt.origin != "" { req.Header.Set("Origin", tt.origin) }
+      if tt.ctype != "" { req.Header.Set("Content-Type", tt.ctype) }
+      if tt.token != "" { req.Header.Set("Authorization", "Bearer "+tt.token) }
+      rec := httptest.NewRecorder()
+      h.ServeHTTP(rec, req)
+      if rec.Code != tt.want { t.Errorf("status %d, want %d: %s", rec.Code, tt.want, rec.Body) }
+    })
+  }
+}
+
+func TestHosts(t *testing.T) {
+  h := Hosts("127.0.0.1:8765")
+  for _, want := range []string{"127.0.0.1:8765", "localhost:8765", "[::1]:8765"} {
+    if !h[want] { t.Errorf("%s not allowed", want) }
+  }
+  if h["localhost:80"] { t.Error("another port allowed") }
+  if h := Hosts("192.0.2.7:8765"); len(h) != 1 || !h["192.0.2.7:8765"] { t.Errorf("got %v, want only the bound address", h) }
+}
@@ -0,0 +1,45 @@
+package state
+
+import (
+  "encoding/json"
+  "os"
+  "path/filepath"
+)
+
+// Decision is one answer given in --interactive mode, kept until the run is applied
+// so a cancelled run can pick up where it stopped.
+type Decision struct {
+  From string `json:"from"`
+  To   string `json:"to"`             // the target proposed when the answer was given
+  Keep bool   `json:"keep"`
+  Name string `json:"name,omitempty"` // target typed in instead of To
+}
+
+func decisionsFile(home string) string { return filepath.Join(home, "state", "decisions.json") }
+
+func loadAllDecisions(home string) map[string][]Decision {
+  all := map[string][]Decision{}
+  if b, err := os.ReadFile(decisionsFile(home)); err == nil {
+    _ = json.Unmarshal(b, &all)
+  }
+  return all
+}
+
+// LoadDecisions returns the answers saved for a plan key, by source path.
+func LoadDecisions(home, key string) map[string]Decision {
+  out := map[string]Decision{}
+  for _, d := range loadAllDecisions(home)[key] { out[d.From] = d }
+  return out
+}
+
+// SaveDecisions replaces the answers saved for a plan key; no answers removes the key.
+func SaveDecisions(home, key string, ds []Decision) error {
+  all := loadAllDecisions(home)
+  if len(ds) == 0 {
+    delete(all, key)
+  } else {
+    all[key] = ds
+  }
+  b, _ := json.MarshalIndent(all, "", "  ")
+  return os.WriteFile(decisionsFile(home), b, 0o644)
+}
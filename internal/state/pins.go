@@ -4,6 +4,8 @@ import (
   "encoding/json"
   "os"
   "path/filepath"
+
+  "github.com/GizzmoShifu/tvrn/pkg/types"
 )
 
 type Pin struct {
@@ -12,6 +14,8 @@ type Pin struct {
   Order   string `json:"order"`
   Lang    string `json:"lang"`
   Locked  bool   `json:"locked"`
+  IDs     types.RemoteIDs `json:"ids,omitempty"` // the same series at other providers
+  Season  *int   `json:"season,omitempty"` // season of a folder whose name doesn't give one
 }
 
 type Pins struct {
@@ -1,24 +1,78 @@
 package state
 
 import (
+  "bufio"
   "encoding/json"
+  "errors"
   "os"
   "path/filepath"
   "time"
 )
 
 type RunRecord struct {
+  Run    string    `json:"run,omitempty"`
   Time   time.Time `json:"time"`
   Before string    `json:"before"`
   After  string    `json:"after"`
   Error  string    `json:"error,omitempty"`
 }
 
+// ErrLegacyRun is returned when the latest records were journaled before runs had IDs.
+// Nothing marks where one of those runs ended, so they are never undone.
+var ErrLegacyRun = errors.New("the latest journal records predate run IDs, so which of them form the last run is unknown; nothing was undone")
+
+func runsFile(home string) string { return filepath.Join(home, "state", "last_run.jsonl") }
+
 func AppendRun(home string, rec RunRecord) {
-  f := filepath.Join(home, "state", "last_run.jsonl")
+  f := runsFile(home)
   fd, err := os.OpenFile(f, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
   if err != nil { return }
   defer fd.Close()
   b, _ := json.Marshal(rec)
-  fd.Write(append(b, '\n'))
+  if _, err := fd.Write(append(b, '\n')); err == nil { fd.Sync() } // on disk before the next rename
+}
+
+// LoadRuns returns every journal record in the order it was written.
+func LoadRuns(home string) ([]RunRecord, error) {
+  fd, err := os.Open(runsFile(home))
+  if os.IsNotExist(err) { return nil, nil }
+  if err != nil { return nil, err }
+  defer fd.Close()
+
+  var out []RunRecord
+  s := bufio.NewScanner(fd)
+  for s.Scan() {
+    var rec RunRecord
+    if json.Unmarshal(s.Bytes(), &rec) != nil { continue }
+    out = append(out, rec)
+  }
+  return out, s.Err()
+}
+
+// LastRun returns the records of the most recent run, in the order they were applied,
+// or ErrLegacyRun when that run has no ID.
+func LastRun(home string) (string, []RunRecord, error) {
+  all, err := LoadRuns(home)
+  if err != nil || len(all) == 0 { return "", nil, err }
+  id := all[len(all)-1].Run
+  if id == "" { return "", nil, ErrLegacyRun }
+  var out []RunRecord
+  for _, rec := range all {
+    if rec.Run == id { out = append(out, rec) }
+  }
+  return id, out, nil
+}
+
+// DropRun removes every record of the given run from the journal.
+func DropRun(home, id string) error {
+  all, err := LoadRuns(home)
+  if err != nil { return err }
+  var b []byte
+  for _, rec := range all {
+    if rec.Run == id { continue }
+    line, _ := json.Marshal(rec)
+    b = append(b, line...)
+    b = append(b, '\n')
+  }
+  return os.WriteFile(runsFile(home), b, 0o644)
 }
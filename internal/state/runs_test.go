@@ -0,0 +1,29 @@
+package state
+
+import (
+  "errors"
+  "os"
+  "path/filepath"
+  "testing"
+)
+
+func TestLastRun(t *testing.T) {
+  home := t.TempDir()
+  if err := os.MkdirAll(filepath.Join(home, "state"), 0o755); err != nil { t.Fatal(err) }
+  // Written before runs had IDs
+  legacy := `{"time":"2024-01-02T03:04:05Z","before":"/tv/a.mkv","after":"/tv/1x01.mkv"}` + "\n"
+  if err := os.WriteFile(runsFile(home), []byte(legacy), 0o644); err != nil { t.Fatal(err) }
+
+  if _, _, err := LastRun(home); !errors.Is(err, ErrLegacyRun) { t.Fatalf("legacy last run: err = %v, want ErrLegacyRun", err) }
+
+  AppendRun(home, RunRecord{Run: "r1", Before: "/tv/b.mkv", After: "/tv/1x02.mkv"})
+  AppendRun(home, RunRecord{Run: "r1", Before: "/tv/c.mkv", After: "/tv/1x03.mkv"})
+  id, recs, err := LastRun(home)
+  if err != nil || id != "r1" || len(recs) != 2 { t.Fatalf("LastRun = %q, %d records, %v; want r1 with 2", id, len(recs), err) }
+
+  // Undoing r1 leaves the legacy record, which can't be undone in turn
+  if err := DropRun(home, id); err != nil { t.Fatal(err) }
+  all, err := LoadRuns(home)
+  if err != nil || len(all) != 1 || all[0].Before != "/tv/a.mkv" { t.Fatalf("after DropRun: %+v, %v", all, err) }
+  if _, _, err := LastRun(home); !errors.Is(err, ErrLegacyRun) { t.Errorf("legacy run after DropRun: err = %v, want ErrLegacyRun", err) }
+}
@@ -0,0 +1,52 @@
+package state
+
+import (
+  "crypto/rand"
+  "encoding/hex"
+  "encoding/json"
+  "os"
+  "path/filepath"
+  "strings"
+  "time"
+)
+
+// Token is a provider login kept between runs. Key identifies the credentials it was
+// issued for, so a changed API key or PIN never reuses it.
+type Token struct {
+  Key     string    `json:"key"`
+  Token   string    `json:"token"`
+  Expires time.Time `json:"expires"`
+}
+
+func tokenFile(home, provider string) string { return filepath.Join(home, "state", provider+"_token.json") }
+
+// LoadToken returns the saved login for a provider, if there is one.
+func LoadToken(home, provider string) (Token, bool) {
+  var t Token
+  b, err := os.ReadFile(tokenFile(home, provider))
+  if err != nil || json.Unmarshal(b, &t) != nil || t.Token == "" { return Token{}, false }
+  return t, true
+}
+
+// SaveToken writes the login readable by the owner only.
+func SaveToken(home, provider string, t Token) error {
+  f := tokenFile(home, provider)
+  b, _ := json.MarshalIndent(t, "", "  ")
+  if err := os.WriteFile(f, b, 0o600); err != nil { return err }
+  return os.Chmod(f, 0o600) // WriteFile keeps the mode of a file that already exists
+}
+
+func serveTokenFile(home string) string { return filepath.Join(home, "state", "serve_token") }
+
+// ServeToken returns the access token `tvrn serve` requires when none is configured,
+// generating one on first use and saving it readable by the owner only. fresh reports
+// whether it was just made.
+func ServeToken(home string) (token string, fresh bool, err error) {
+  f := serveTokenFile(home)
+  if b, err := os.ReadFile(f); err == nil && len(strings.TrimSpace(string(b))) >= 32 { return strings.TrimSpace(string(b)), false, nil }
+  b := make([]byte, 24)
+  if _, err := rand.Read(b); err != nil { return "", false, err }
+  token = hex.EncodeToString(b)
+  if err := os.WriteFile(f, []byte(token+"\n"), 0o600); err != nil { return "", false, err }
+  return token, true, os.Chmod(f, 0o600)
+}
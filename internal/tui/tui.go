@@ -0,0 +1,312 @@
+// Package tui is the full-screen plan editor: every item can be included or left out,
+// renamed by hand or pointed at another episode before the chosen subset is applied.
+package tui
+
+import (
+  "errors"
+  "fmt"
+  "io"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "unicode/utf8"
+
+  "golang.org/x/term"
+
+  "github.com/GizzmoShifu/tvrn/internal/parse"
+  "github.com/GizzmoShifu/tvrn/internal/planner"
+  "github.com/GizzmoShifu/tvrn/internal/runner"
+)
+
+// Actions are the edits that need metadata; the caller backs them with a Runner.
+type Actions struct {
+  // Strict accepts only a capital Y at the final confirmation
+  Strict bool
+  // Renumber retargets an item at another episode of the plan's series
+  Renumber func(p planner.Plan, it planner.Item, season int, eps []int) (planner.Item, error)
+  // Research plans the folder again against another series name; nil disables it
+  Research func(name string) (planner.Plan, error)
+}
+
+// ErrCancelled is returned when the user quits without applying
+var ErrCancelled = errors.New("cancelled")
+
+// Supported reports whether in and out are a terminal that can take the full-screen editor.
+// Dumb terminals, pipes and an unset TERM keep the plain prompt.
+func Supported(in, out *os.File) bool {
+  t := os.Getenv("TERM")
+  return t != "" && t != "dumb" && term.IsTerminal(int(in.Fd())) && term.IsTerminal(int(out.Fd()))
+}
+
+const help = "↑/↓ move  space toggle  a all  e edit name  n episode  s series  enter apply  q quit"
+
+type editor struct {
+  in      io.Reader
+  out     io.Writer
+  plan    planner.Plan
+  on      []bool
+  cur     int
+  top     int // first item on screen
+  status  string
+  act     Actions
+}
+
+// Review shows the plan full screen and returns the items chosen for applying, in plan order.
+func Review(in, out *os.File, p planner.Plan, act Actions) (planner.Plan, error) {
+  old, err := term.MakeRaw(int(in.Fd()))
+  if err != nil { return planner.Plan{}, err }
+  fmt.Fprint(out, "\x1b[?1049h\x1b[?25l") // alternate screen, hide cursor
+  defer func() {
+    fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+    term.Restore(int(in.Fd()), old)
+  }()
+
+  e := &editor{in: in, out: out, act: act}
+  e.load(p)
+  return e.run()
+}
+
+// run handles keys until the chosen items are confirmed or the editor is quit
+func (e *editor) run() (planner.Plan, error) {
+  for {
+    e.draw()
+    k, err := e.key()
+    if err != nil { return planner.Plan{}, err }
+    e.status = ""
+    cmd := k.name
+    if cmd == "" { cmd = k.text }
+    switch cmd {
+    case "up", "k":
+      if e.cur > 0 { e.cur-- }
+    case "down", "j":
+      if e.cur < len(e.plan.Items)-1 { e.cur++ }
+    case "home", "g":
+      e.cur = 0
+    case "end", "G":
+      if len(e.plan.Items) > 0 { e.cur = len(e.plan.Items) - 1 }
+    case " ", "x":
+      if len(e.on) > 0 { e.on[e.cur] = !e.on[e.cur] }
+    case "a":
+      all := e.count() < len(e.on)
+      for i := range e.on { e.on[i] = all }
+    case "e":
+      e.editName()
+    case "n":
+      e.renumber()
+    case "s":
+      e.research()
+    case "enter":
+      n := e.count()
+      if n == 0 {
+        e.status = "Nothing selected"
+        continue
+      }
+      prompt := fmt.Sprintf("Apply %d of %d changes? [y/N] ", n, len(e.plan.Items))
+      if e.act.Strict { prompt = fmt.Sprintf("Apply %d of %d changes? Type Y to continue: ", n, len(e.plan.Items)) }
+      ans, ok := e.line(prompt, "")
+      if !ok { continue }
+      if runner.Accepts(ans, e.act.Strict) { return e.chosen(), nil }
+      e.status = "Not applied"
+    case "q", "esc", "ctrl-c":
+      return planner.Plan{}, ErrCancelled
+    }
+  }
+}
+
+func (e *editor) load(p planner.Plan) {
+  e.plan = p
+  e.on = make([]bool, len(p.Items))
+  for i := range e.on { e.on[i] = true }
+  e.cur, e.top = 0, 0
+}
+
+func (e *editor) count() int {
+  n := 0
+  for _, on := range e.on {
+    if on { n++ }
+  }
+  return n
+}
+
+func (e *editor) chosen() planner.Plan {
+  out := e.plan
+  out.Items = nil
+  for i, it := range e.plan.Items {
+    if e.on[i] { out.Items = append(out.Items, it) }
+  }
+  return out
+}
+
+func (e *editor) editName() {
+  if len(e.plan.Items) == 0 { return }
+  it := &e.plan.Items[e.cur]
+  name, ok := e.line("New name: ", filepath.Base(it.To))
+  name = strings.TrimSpace(name)
+  if !ok || name == "" { return }
+  if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+    e.status = "A name can't contain a path separator"
+    return
+  }
+  it.To = filepath.Join(filepath.Dir(it.To), name)
+  e.on[e.cur] = true
+}
+
+// renumber accepts "7", "S01E07", "1x07", a range such as "S01E07-09" or a list such as "S01E07E09"
+func (e *editor) renumber() {
+  if len(e.plan.Items) == 0 || e.act.Renumber == nil { return }
+  it := e.plan.Items[e.cur]
+  if it.Reason == "folder" || it.Reason == "undo" {
+    e.status = "Only episode files can be renumbered"
+    return
+  }
+  text, ok := e.line("Episode (e.g. 7 or S01E07): ", "")
+  text = strings.TrimSpace(text)
+  if !ok || text == "" { return }
+
+  season, eps := it.S, []int(nil)
+  if n, err := strconv.Atoi(text); err == nil {
+    eps = []int{n}
+  } else if p, ok := parse.FromFilename(text+".mkv", it.S, ""); ok {
+    season, eps = p.Season, p.Episodes
+  } else {
+    e.status = fmt.Sprintf("Can't read an episode number from %q", text)
+    return
+  }
+  e.status = "Looking up…"
+  e.draw()
+  upd, err := e.act.Renumber(e.plan, it, season, eps)
+  if err != nil {
+    e.status = err.Error()
+    return
+  }
+  e.plan.Items[e.cur] = upd
+  e.on[e.cur] = true
+}
+
+func (e *editor) research() {
+  if e.act.Research == nil {
+    e.status = "This plan can't be searched again"
+    return
+  }
+  name, ok := e.line("Series name: ", e.plan.Series)
+  name = strings.TrimSpace(name)
+  if !ok || name == "" { return }
+  e.status = "Searching…"
+  e.draw()
+  p, err := e.act.Research(name)
+  if err != nil {
+    e.status = err.Error()
+    return
+  }
+  e.load(p)
+  e.status = fmt.Sprintf("Matched %s", p.Series)
+}
+
+// ===== drawing and input =====
+
+func (e *editor) size() (int, int) {
+  f, ok := e.out.(*os.File)
+  if !ok { return 80, 24 }
+  w, h, err := term.GetSize(int(f.Fd()))
+  if err != nil || w <= 0 || h <= 0 { return 80, 24 }
+  return w, h
+}
+
+func (e *editor) draw() {
+  w, h := e.size()
+  rows := h - 4
+  if rows < 1 { rows = 1 }
+  if e.cur < e.top { e.top = e.cur }
+  if e.cur >= e.top+rows { e.top = e.cur - rows + 1 }
+
+  var b strings.Builder
+  b.WriteString("\x1b[H\x1b[2J")
+  title := fmt.Sprintf("tvrn  %s  %d of %d selected", e.plan.Series, e.count(), len(e.plan.Items))
+  b.WriteString("\x1b[1m" + fit(title, w) + "\x1b[0m\r\n\r\n")
+  for i := e.top; i < len(e.plan.Items) && i < e.top+rows; i++ {
+    it := e.plan.Items[i]
+    box := "[ ]"
+    if e.on[i] { box = "[x]" }
+    from, to := filepath.Base(it.From), filepath.Base(it.To)
+    switch it.Reason {
+    case "folder":
+      from, to = from+string(filepath.Separator), to+string(filepath.Separator)
+    case "move":
+      to = filepath.Join(filepath.Base(filepath.Dir(it.To)), to)
+    }
+    line := fit(fmt.Sprintf("%s %s  <-  %s", box, to, from), w)
+    if i == e.cur { line = "\x1b[7m" + line + "\x1b[0m" }
+    b.WriteString(line + "\r\n")
+  }
+  fmt.Fprintf(&b, "\x1b[%d;1H", h-1)
+  b.WriteString(fit(e.status, w) + "\r\n")
+  b.WriteString("\x1b[2m" + fit(help, w) + "\x1b[0m")
+  fmt.Fprint(e.out, b.String())
+}
+
+// line reads a line of text on the status row, starting from initial.
+// Enter accepts; Esc or Ctrl-C cancels.
+func (e *editor) line(prompt, initial string) (string, bool) {
+  text := []rune(initial)
+  fmt.Fprint(e.out, "\x1b[?25h")
+  defer fmt.Fprint(e.out, "\x1b[?25l")
+  for {
+    w, h := e.size()
+    fmt.Fprintf(e.out, "\x1b[%d;1H\x1b[2K%s", h-1, fit(prompt+string(text), w))
+    k, err := e.key()
+    if err != nil { return "", false }
+    switch k.name {
+    case "enter":
+      return string(text), true
+    case "esc", "ctrl-c":
+      return "", false
+    case "backspace":
+      if len(text) > 0 { text = text[:len(text)-1] }
+    case "ctrl-u":
+      text = text[:0]
+    case "":
+      text = append(text, []rune(strings.TrimRight(k.text, "\r\n"))...)
+    }
+  }
+}
+
+// key is one keypress: a named special key, or the text typed or pasted
+type key struct{ name, text string }
+
+// key reads one keypress. Terminals send an escape sequence in a single read, so a
+// lone ESC byte is the Esc key itself.
+func (e *editor) key() (key, error) {
+  buf := make([]byte, 64)
+  n, err := e.in.Read(buf)
+  if err != nil { return key{}, err }
+  b := buf[:n]
+  if n == 1 {
+    switch b[0] {
+    case 27: return key{name: "esc"}, nil
+    case '\r', '\n': return key{name: "enter"}, nil
+    case 127, 8: return key{name: "backspace"}, nil
+    case 3: return key{name: "ctrl-c"}, nil
+    case 21: return key{name: "ctrl-u"}, nil
+    }
+  }
+  if n >= 3 && b[0] == 27 && (b[1] == '[' || b[1] == 'O') {
+    switch b[2] {
+    case 'A': return key{name: "up"}, nil
+    case 'B': return key{name: "down"}, nil
+    case 'H': return key{name: "home"}, nil
+    case 'F': return key{name: "end"}, nil
+    }
+    return key{}, nil
+  }
+  if b[0] < ' ' { return key{}, nil }
+  return key{text: string(b)}, nil
+}
+
+// fit cuts s to w display columns
+func fit(s string, w int) string {
+  if utf8.RuneCountInString(s) <= w { return s }
+  r := []rune(s)
+  if w < 1 { return "" }
+  return string(r[:w-1]) + "…"
+}
@@ -0,0 +1,118 @@
+package tui
+
+import (
+  "errors"
+  "fmt"
+  "io"
+  "path/filepath"
+  "reflect"
+  "testing"
+
+  "github.com/GizzmoShifu/tvrn/internal/planner"
+)
+
+// keys feeds one keypress per read, as a terminal in raw mode does
+type keys []string
+
+func (k *keys) Read(b []byte) (int, error) {
+  if len(*k) == 0 { return 0, io.EOF }
+  n := copy(b, (*k)[0])
+  *k = (*k)[1:]
+  return n, nil
+}
+
+const (
+  up    = "\x1b[A"
+  down  = "\x1b[B"
+  enter = "\r"
+  esc   = "\x1b"
+)
+
+func TestKey(t *testing.T) {
+  tests := []struct {
+    in   string
+    want key
+  }{
+    {esc, key{name: "esc"}},
+    {"\r", key{name: "enter"}},
+    {"\n", key{name: "enter"}},
+    {"\x7f", key{name: "backspace"}},
+    {"\x03", key{name: "ctrl-c"}},
+    {"\x15", key{name: "ctrl-u"}},
+    {up, key{name: "up"}},
+    {down, key{name: "down"}},
+    {"\x1bOH", key{name: "home"}},
+    {"\x1b[F", key{name: "end"}},
+    {"\x1b[5~", key{}},  // page up: ignored
+    {"\x01", key{}},     // other control keys: ignored
+    {"j", key{text: "j"}},
+    {"Firefly", key{text: "Firefly"}}, // pasted
+  }
+  for _, tt := range tests {
+    e := &editor{in: &keys{tt.in}}
+    got, err := e.key()
+    if err != nil || got != tt.want { t.Errorf("key(%q) = %+v, %v; want %+v", tt.in, got, err, tt.want) }
+  }
+}
+
+func TestReview(t *testing.T) {
+  dir := filepath.Join("tv", "Firefly", "Season 1")
+  plan := planner.Plan{Series: "Firefly", Items: []planner.Item{
+    {From: filepath.Join(dir, "a.mkv"), To: filepath.Join(dir, "1x01 - Serenity.mkv"), S: 1},
+    {From: filepath.Join(dir, "b.mkv"), To: filepath.Join(dir, "1x02 - The Train Job.mkv"), S: 1},
+    {From: filepath.Join(dir, "c.mkv"), To: filepath.Join(dir, "1x03 - Bushwhacked.mkv"), S: 1},
+  }}
+  renumber := func(p planner.Plan, it planner.Item, season int, eps []int) (planner.Item, error) {
+    if eps[0] > 14 { return it, errors.New("no such episode") }
+    it.To = filepath.Join(filepath.Dir(it.To), fmt.Sprintf("%dx%02d.mkv", season, eps[0]))
+    return it, nil
+  }
+
+  tests := []struct {
+    name   string
+    strict bool
+    keys   []string
+    want   []string // names chosen, in plan order
+    err    error
+  }{
+    {"apply all", false, []string{enter, "y", enter}, []string{"1x01 - Serenity.mkv", "1x02 - The Train Job.mkv", "1x03 - Bushwhacked.mkv"}, nil},
+    {"leave one out", false, []string{down, " ", enter, "y", enter}, []string{"1x01 - Serenity.mkv", "1x03 - Bushwhacked.mkv"}, nil},
+    {"up stops at the top", false, []string{up, "k", "x", enter, "y", enter}, []string{"1x02 - The Train Job.mkv", "1x03 - Bushwhacked.mkv"}, nil},
+    {"down stops at the bottom", false, []string{"j", "j", "j", "j", " ", enter, "y", enter}, []string{"1x01 - Serenity.mkv", "1x02 - The Train Job.mkv"}, nil},
+    {"end and home", false, []string{"G", " ", "g", " ", enter, "y", enter}, []string{"1x02 - The Train Job.mkv"}, nil},
+    {"none then one", false, []string{"a", enter, down, " ", enter, "y", enter}, []string{"1x02 - The Train Job.mkv"}, nil},
+    {"all back on", false, []string{"a", "a", enter, "y", enter}, []string{"1x01 - Serenity.mkv", "1x02 - The Train Job.mkv", "1x03 - Bushwhacked.mkv"}, nil},
+    {"no at the prompt", false, []string{" ", enter, "n", enter, enter, "yes", enter}, []string{"1x02 - The Train Job.mkv", "1x03 - Bushwhacked.mkv"}, nil},
+    {"esc at the prompt", false, []string{enter, esc, "q"}, nil, ErrCancelled},
+    {"strict wants Y", true, []string{enter, "y", enter, enter, "Y", enter}, []string{"1x01 - Serenity.mkv", "1x02 - The Train Job.mkv", "1x03 - Bushwhacked.mkv"}, nil},
+    {"edit a name", false, []string{"e", "\x15", "Pilot.mkv", enter, enter, "y", enter}, []string{"Pilot.mkv", "1x02 - The Train Job.mkv", "1x03 - Bushwhacked.mkv"}, nil},
+    {"edit with backspace", false, []string{"e", "\x15", "Pilots", "\x7f", ".mkv", enter, enter, "y", enter}, []string{"Pilot.mkv", "1x02 - The Train Job.mkv", "1x03 - Bushwhacked.mkv"}, nil},
+    {"a name can't hold a folder", false, []string{"e", "\x15", "x/y.mkv", enter, enter, "y", enter}, []string{"1x01 - Serenity.mkv", "1x02 - The Train Job.mkv", "1x03 - Bushwhacked.mkv"}, nil},
+    {"editing selects", false, []string{" ", "e", enter, enter, "y", enter}, []string{"1x01 - Serenity.mkv", "1x02 - The Train Job.mkv", "1x03 - Bushwhacked.mkv"}, nil},
+    {"renumber", false, []string{down, "n", "S01E07", enter, enter, "y", enter}, []string{"1x01 - Serenity.mkv", "1x07.mkv", "1x03 - Bushwhacked.mkv"}, nil},
+    {"renumber by number", false, []string{"n", "9", enter, enter, "y", enter}, []string{"1x09.mkv", "1x02 - The Train Job.mkv", "1x03 - Bushwhacked.mkv"}, nil},
+    {"renumber fails", false, []string{"n", "20", enter, enter, "y", enter}, []string{"1x01 - Serenity.mkv", "1x02 - The Train Job.mkv", "1x03 - Bushwhacked.mkv"}, nil},
+    {"no search without Research", false, []string{"s", enter, "y", enter}, []string{"1x01 - Serenity.mkv", "1x02 - The Train Job.mkv", "1x03 - Bushwhacked.mkv"}, nil},
+    {"quit", false, []string{" ", "q"}, nil, ErrCancelled},
+    {"esc quits", false, []string{esc}, nil, ErrCancelled},
+    {"ctrl-c quits", false, []string{"\x03"}, nil, ErrCancelled},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      in := keys(tt.keys)
+      e := &editor{in: &in, out: io.Discard, act: Actions{Strict: tt.strict, Renumber: renumber}}
+      e.load(plan)
+      e.plan.Items = append([]planner.Item(nil), plan.Items...) // edits must not reach the shared plan
+      got, err := e.run()
+      if !errors.Is(err, tt.err) { t.Fatalf("err = %v, want %v", err, tt.err) }
+      if len(in) != 0 { t.Errorf("%d keys left unread", len(in)) }
+      var names []string
+      for _, it := range got.Items {
+        names = append(names, filepath.Base(it.To))
+        if filepath.Dir(it.To) != dir { t.Errorf("%s moved out of %s", it.To, dir) }
+      }
+      if !reflect.DeepEqual(names, tt.want) { t.Errorf("chosen %q, want %q", names, tt.want) }
+      if err == nil && got.Series != "Firefly" { t.Errorf("series %q lost", got.Series) }
+    })
+  }
+}
@@ -0,0 +1,109 @@
+package tvdb
+
+import (
+  "context"
+  "encoding/json"
+  "fmt"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/GizzmoShifu/tvrn/internal/cache"
+)
+
+// TTLs bounds how long each kind of cached response is served before refetching.
+type TTLs struct {
+  Episodes time.Duration
+  Series   time.Duration
+  Search   time.Duration
+}
+
+// Cached wraps a provider and stores its decoded results in a cache.Store under the keys
+// below, so later runs, offline mode and `tvrn cache` all see the same entries.
+type Cached struct {
+  Provider
+  store cache.Store
+  ttl   TTLs
+}
+
+func NewCached(p Provider, s cache.Store, ttl TTLs) *Cached {
+  return &Cached{Provider: p, store: s, ttl: ttl}
+}
+
+func (c *Cached) SearchSeries(ctx context.Context, q, lang string) ([]Series, error) {
+  var out []Series
+  key := CacheKeySearch(c.Name(), q, lang)
+  if c.load(key, &out) { return out, nil }
+  out, err := c.Provider.SearchSeries(ctx, q, lang)
+  if err != nil { return nil, err }
+  c.save(key, out, c.ttl.Search)
+  return out, nil
+}
+
+func (c *Cached) GetSeries(ctx context.Context, id int, lang string) (Series, error) {
+  var out Series
+  key := CacheKeySeries(c.Name(), id, lang)
+  if c.load(key, &out) { return out, nil }
+  out, err := c.Provider.GetSeries(ctx, id, lang)
+  if err != nil { return Series{}, err }
+  c.save(key, out, c.ttl.Series)
+  return out, nil
+}
+
+func (c *Cached) GetEpisodes(ctx context.Context, id int, order string, season int, lang string) ([]Episode, error) {
+  var out []Episode
+  key := CacheKeyEpisodes(c.Name(), id, order, season, lang)
+  if c.load(key, &out) { return out, nil }
+  out, err := c.Provider.GetEpisodes(ctx, id, order, season, lang)
+  if err != nil { return nil, err }
+  c.save(key, out, c.ttl.Episodes)
+  return out, nil
+}
+
+func (c *Cached) load(key string, out any) bool {
+  e, ok := c.store.Get(key)
+  return ok && json.Unmarshal(e.Body, out) == nil
+}
+
+// save is best effort: a cache write failure never fails the lookup that produced it
+func (c *Cached) save(key string, v any, ttl time.Duration) {
+  b, err := json.Marshal(v)
+  if err != nil { return }
+  now := time.Now()
+  e := cache.Entry{Body: b, Modified: now}
+  if ttl > 0 { e.Expires = now.Add(ttl) }
+  _ = c.store.Put(key, e)
+}
+
+// ===== keys =====
+// TVDB keys carry no prefix, e.g. episodes:{seriesID}:{order}:{season}:{lang};
+// other providers prefix their name, e.g. tmdb:episodes:1437:default:1:en
+
+func keyPrefix(provider string) string {
+  if provider == "" || provider == "tvdb" { return "" }
+  return provider + ":"
+}
+
+func CacheKeyEpisodes(provider string, id int, order string, season int, lang string) string {
+  return fmt.Sprintf("%sepisodes:%d:%s:%d:%s", keyPrefix(provider), id, normaliseOrder(order), season, strings.ToLower(lang))
+}
+
+func CacheKeySeries(provider string, id int, lang string) string {
+  return fmt.Sprintf("%sseries:%d:%s", keyPrefix(provider), id, strings.ToLower(lang))
+}
+
+func CacheKeySearch(provider, q, lang string) string {
+  return fmt.Sprintf("%ssearch:%s:%s", keyPrefix(provider), strings.ToLower(lang), strings.ToLower(strings.TrimSpace(q)))
+}
+
+// KeySeriesID returns the series ID a series or episodes key belongs to.
+func KeySeriesID(key string) (int, bool) {
+  parts := strings.Split(key, ":")
+  for i := 0; i < 2 && i+1 < len(parts); i++ { // the kind follows an optional provider prefix
+    if parts[i] == "series" || parts[i] == "episodes" {
+      n, err := strconv.Atoi(parts[i+1])
+      return n, err == nil
+    }
+  }
+  return 0, false
+}
@@ -1,12 +1,83 @@
 package tvdb
 
-import "context"
+import (
+  "context"
+  "errors"
+  "fmt"
+  "net/http"
+  "strings"
 
-// Client is the surface the runner depends on.
-// Concrete implementation (HTTPClient) lives in http.go.
+  "github.com/GizzmoShifu/tvrn/internal/cache"
+  "github.com/GizzmoShifu/tvrn/internal/logx"
+)
+
+// Client is the metadata provider surface the runner depends on.
+// Implementations: HTTPClient (TVDB v4) in http.go, TMDB in tmdb.go and TVmaze in tvmaze.go.
+// Each maps its own season/episode/order model onto Series and Episode.
 type Client interface {
   Login(ctx context.Context) error
   SearchSeries(ctx context.Context, q, lang string) ([]Series, error)
   GetSeries(ctx context.Context, id int, lang string) (Series, error)
   GetEpisodes(ctx context.Context, id int, order string, season int, lang string) ([]Episode, error)
 }
+
+// Provider is a Client that can name itself for messages, cache keys and config.
+type Provider interface {
+  Client
+  Name() string
+}
+
+// Options holds the credentials each provider may need and the shared response cache.
+type Options struct {
+  TVDBKey   string
+  TVDBPIN   string
+  TMDBKey   string // v3 API key or v4 read access token
+  Cache     cache.Store
+  TTL       TTLs
+  Offline   bool              // serve from Cache only, never the network
+  Transport http.RoundTripper // a Recorder or Replayer under every provider; nil for the network
+  Home      string            // where logins are kept between runs; empty keeps them in memory
+  Retry     RetryPolicy       // zero fields take DefaultRetry
+  Log       *logx.Logger      // request traces at debug, retries and outages above, with the run from the request context; nil is silent
+}
+
+// Providers lists the names accepted by NewProvider.
+var Providers = []string{"tvdb", "tmdb", "tvmaze"}
+
+// NewProvider builds the named provider with its default base URL, behind the cache
+// when one is set, or entirely from the cache when offline.
+func NewProvider(name string, o Options) (Provider, error) {
+  p, err := newProvider(name, o)
+  if err != nil { return nil, err }
+  switch {
+  case o.Offline:
+    if o.Cache == nil { return nil, errors.New("offline mode needs the cache; drop --no-cache") }
+    return NewOffline(p.Name(), o.Cache), nil
+  case o.Cache != nil:
+    return NewCached(p, o.Cache, o.TTL), nil
+  }
+  return p, nil
+}
+
+func newProvider(name string, o Options) (Provider, error) {
+  switch strings.ToLower(strings.TrimSpace(name)) {
+  case "", "tvdb":
+    c := NewHTTP("", o.TVDBKey, o.TVDBPIN)
+    c.retry = newRetrier(o.Retry, o.Log.With("provider", "tvdb"))
+    c.Home = o.Home
+    c.hc.Transport = o.Transport
+    return c, nil
+  case "tmdb":
+    c := NewTMDB("", o.TMDBKey)
+    c.retry = newRetrier(o.Retry, o.Log.With("provider", "tmdb"))
+    c.hc.Transport = o.Transport
+    return c, nil
+  case "tvmaze":
+    c := NewTVmaze("")
+    c.retry = newRetrier(o.Retry, o.Log.With("provider", "tvmaze"))
+    c.hc.Transport = o.Transport
+    return c, nil
+  default:
+    return nil, fmt.Errorf("unknown provider %q (want one of %s)", name, strings.Join(Providers, ", "))
+  }
+}
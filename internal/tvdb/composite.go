@@ -0,0 +1,194 @@
+package tvdb
+
+import (
+  "context"
+  "errors"
+  "fmt"
+  "strings"
+  "sync"
+  "time"
+)
+
+// Composite queries providers in priority order. The first provider owns the series IDs
+// the runner sees; the others fill gaps in its episode titles and air dates per S/E and add
+// episodes it lacks. A fallback's own series ID is found through the shared remote IDs, or
+// by name and year when no cross-reference exists.
+type Composite struct {
+  providers []Provider
+  cooldown  time.Duration // how long a fallback that failed to log in is skipped
+
+  mu     sync.Mutex
+  down   map[string]time.Time      // fallbacks that failed to log in, until when they are skipped
+  series map[int]Series            // primary series with merged IDs, by primary ID
+  mapped map[string]map[int]Series // provider -> primary ID -> provider's record (zero if none)
+}
+
+func NewComposite(primary Provider, fallbacks ...Provider) *Composite {
+  return &Composite{
+    providers: append([]Provider{primary}, fallbacks...),
+    cooldown:  DefaultRetry.BreakerCooldown,
+    down:      map[string]time.Time{},
+    series:    map[int]Series{},
+    mapped:    map[string]map[int]Series{},
+  }
+}
+
+func (c *Composite) Name() string { return c.providers[0].Name() }
+
+// Login fails only when the primary does; a fallback that can't log in is left out
+// until the cooldown passes, when it is tried again.
+func (c *Composite) Login(ctx context.Context) error {
+  if err := c.providers[0].Login(ctx); err != nil { return err }
+  for _, p := range c.providers[1:] { c.login(ctx, p) }
+  return nil
+}
+
+// login logs a fallback in, and marks it down for the cooldown when that fails
+func (c *Composite) login(ctx context.Context, p Provider) bool {
+  err := p.Login(ctx)
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  if err != nil {
+    c.down[p.Name()] = time.Now().Add(c.cooldown)
+    return false
+  }
+  delete(c.down, p.Name())
+  return true
+}
+
+// SearchSeries returns the primary's hits. Only the primary's IDs are valid elsewhere in
+// the Client surface, so fallbacks don't contribute hits here.
+func (c *Composite) SearchSeries(ctx context.Context, q, lang string) ([]Series, error) {
+  return c.providers[0].SearchSeries(ctx, q, lang)
+}
+
+// GetSeries returns the primary's series with remote IDs merged from every fallback that
+// can be matched to it.
+func (c *Composite) GetSeries(ctx context.Context, id int, lang string) (Series, error) {
+  s, err := c.providers[0].GetSeries(ctx, id, lang)
+  if err != nil { return Series{}, err }
+  for _, p := range c.fallbacks(ctx) {
+    if fs, ok := c.resolve(ctx, p, s, lang); ok { s.IDs = s.IDs.Merge(fs.IDs) }
+  }
+  c.mu.Lock()
+  c.series[id] = s
+  c.mu.Unlock()
+  return s, nil
+}
+
+func (c *Composite) GetEpisodes(ctx context.Context, id int, order string, season int, lang string) ([]Episode, error) {
+  out, err := c.providers[0].GetEpisodes(ctx, id, order, season, lang)
+  if err != nil { return nil, err }
+
+  s, err := c.primarySeries(ctx, id, lang)
+  if err != nil { return out, nil }
+
+  type key struct{ s, e int }
+  for _, p := range c.fallbacks(ctx) {
+    fs, ok := c.resolve(ctx, p, s, lang)
+    if !ok { continue }
+    more, err := p.GetEpisodes(ctx, fs.ID, order, season, lang)
+    if err != nil {
+      if errors.Is(err, context.Canceled) { return nil, err }
+      continue
+    }
+
+    idx := map[key]int{}
+    for i, e := range out { idx[key{e.Season, e.Number}] = i }
+    for _, e := range more {
+      i, ok := idx[key{e.Season, e.Number}]
+      if !ok {
+        out = append(out, e)
+        continue
+      }
+      if strings.TrimSpace(out[i].Title) == "" { out[i].Title = e.Title }
+      if out[i].AirDate.IsZero() { out[i].AirDate = e.AirDate }
+      if out[i].Absolute == 0 { out[i].Absolute = e.Absolute }
+      if out[i].Runtime == 0 { out[i].Runtime = e.Runtime }
+      out[i].IDs = out[i].IDs.Merge(e.IDs)
+    }
+  }
+  return out, nil
+}
+
+// ===== helpers =====
+
+// fallbacks lists the fallbacks logged in, retrying those whose cooldown has passed
+func (c *Composite) fallbacks(ctx context.Context) []Provider {
+  var out []Provider
+  for _, p := range c.providers[1:] {
+    c.mu.Lock()
+    until, down := c.down[p.Name()]
+    c.mu.Unlock()
+    if down && (time.Now().Before(until) || !c.login(ctx, p)) { continue }
+    out = append(out, p)
+  }
+  return out
+}
+
+func (c *Composite) primarySeries(ctx context.Context, id int, lang string) (Series, error) {
+  c.mu.Lock()
+  s, ok := c.series[id]
+  c.mu.Unlock()
+  if ok { return s, nil }
+  return c.GetSeries(ctx, id, lang)
+}
+
+// resolve finds the fallback's record for a primary series: by a known ID for that
+// provider, else by searching its name and keeping the hit that shares an ID or year.
+func (c *Composite) resolve(ctx context.Context, p Provider, s Series, lang string) (Series, bool) {
+  c.mu.Lock()
+  m := c.mapped[p.Name()]
+  if m == nil {
+    m = map[int]Series{}
+    c.mapped[p.Name()] = m
+  }
+  fs, seen := m[s.ID]
+  c.mu.Unlock()
+  if seen { return fs, fs.ID != 0 }
+
+  fid := s.IDs.Get(p.Name())
+  if fid == 0 {
+    if hits, err := p.SearchSeries(ctx, s.Name, lang); err == nil { fid = pickMatch(hits, s) }
+  }
+  if fid != 0 {
+    var err error
+    if fs, err = p.GetSeries(ctx, fid, lang); err != nil { fs = Series{ID: fid} }
+  }
+
+  c.mu.Lock()
+  m[s.ID] = fs
+  c.mu.Unlock()
+  return fs, fs.ID != 0
+}
+
+// pickMatch prefers a hit sharing a remote ID, then an exact name with the same year.
+func pickMatch(hits []Series, s Series) int {
+  for _, h := range hits {
+    if h.IDs.Shares(s.IDs) { return h.ID }
+  }
+  for _, h := range hits {
+    if strings.EqualFold(h.Name, s.Name) && (s.Year == 0 || h.Year == 0 || h.Year == s.Year) { return h.ID }
+  }
+  return 0
+}
+
+// ProviderChain builds a single provider or a Composite from a priority list of names.
+func ProviderChain(names []string, o Options) (Provider, error) {
+  if len(names) == 0 { names = []string{"tvdb"} }
+  var ps []Provider
+  seen := map[string]bool{}
+  for _, n := range names {
+    n = strings.ToLower(strings.TrimSpace(n))
+    if n == "" || seen[n] { continue }
+    seen[n] = true
+    p, err := NewProvider(n, o)
+    if err != nil { return nil, err }
+    ps = append(ps, p)
+  }
+  if len(ps) == 0 { return nil, fmt.Errorf("no providers configured") }
+  if len(ps) == 1 { return ps[0], nil }
+  c := NewComposite(ps[0], ps[1:]...)
+  if o.Retry.BreakerCooldown > 0 { c.cooldown = o.Retry.BreakerCooldown }
+  return c, nil
+}
@@ -0,0 +1,48 @@
+package tvdb
+
+import (
+  "context"
+  "errors"
+  "sync"
+  "testing"
+  "time"
+)
+
+// flakyLogin is a fallback whose first logins fail
+type flakyLogin struct {
+  Provider
+  name   string
+  fails  int
+  logins int
+}
+
+func (f *flakyLogin) Name() string { return f.name }
+
+func (f *flakyLogin) Login(context.Context) error {
+  f.logins++
+  if f.logins <= f.fails { return errors.New("login refused") }
+  return nil
+}
+
+func TestCompositeRetriesFallbackLogin(t *testing.T) {
+  ctx := context.Background()
+  fb := &flakyLogin{name: "tmdb", fails: 1}
+  c := NewComposite(&flakyLogin{name: "tvdb"}, fb)
+  c.cooldown = 20 * time.Millisecond
+  if err := c.Login(ctx); err != nil { t.Fatal(err) }
+
+  // Plans run side by side in watch and serve mode
+  var wg sync.WaitGroup
+  for range 4 {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      if n := len(c.fallbacks(ctx)); n != 0 { t.Errorf("during the cooldown got %d fallbacks, want 0", n) }
+    }()
+  }
+  wg.Wait()
+
+  time.Sleep(30 * time.Millisecond)
+  if n := len(c.fallbacks(ctx)); n != 1 { t.Fatalf("after the cooldown got %d fallbacks, want 1", n) }
+  if fb.logins != 2 { t.Errorf("logins = %d, want 2", fb.logins) }
+}
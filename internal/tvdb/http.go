@@ -3,6 +3,9 @@ package tvdb
 import (
   "bytes"
   "context"
+  "crypto/sha256"
+  "encoding/base64"
+  "encoding/hex"
   "encoding/json"
   "errors"
   "fmt"
@@ -12,21 +15,24 @@ import (
   "path"
   "strconv"
   "strings"
+  "sync"
   "time"
 
-  "github.com/GizzmoShifu/tvrn/internal/cache"
+  "github.com/GizzmoShifu/tvrn/internal/state"
+  "github.com/GizzmoShifu/tvrn/pkg/types"
 )
 
 type HTTPClient struct {
   BaseURL string
   APIKey  string
   PIN     string
+  Home    string // the token is kept in Home/state between runs when set
 
   hc       *http.Client
+  retry    *retrier
+  mu       sync.Mutex // guards the token; held for the whole of a login so only one runs
   token    string
   tokenExp time.Time
-
-  cache    cache.Store
 }
 
 func NewHTTP(base, apikey, pin string) *HTTPClient {
@@ -36,14 +42,31 @@ func NewHTTP(base, apikey, pin string) *HTTPClient {
     APIKey:  apikey,
     PIN:     pin,
     hc:      &http.Client{Timeout: 20 * time.Second},
+    retry:   newRetrier(DefaultRetry, nil),
   }
 }
 
-func (c *HTTPClient) WithCache(s cache.Store) *HTTPClient { c.cache = s; return c }
+func (c *HTTPClient) Name() string { return "tvdb" }
 
 // ===== Interface methods =====
 
-func (c *HTTPClient) Login(ctx context.Context) error {
+// Login makes sure a usable token is held: the one in memory, the one saved by an earlier
+// run for the same key, or a new one.
+func (c *HTTPClient) Login(ctx context.Context) error { return c.authenticate(ctx, "") }
+
+// authenticate logs in unless a fresh token is already held. stale is a token the server
+// just refused; it is replaced unless a concurrent caller has done so already.
+func (c *HTTPClient) authenticate(ctx context.Context, stale string) error {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  if c.token != "" && c.token != stale && c.fresh() { return nil }
+  if c.Home != "" {
+    if t, ok := state.LoadToken(c.Home, c.Name()); ok && t.Key == c.keyID() && t.Token != stale {
+      c.token, c.tokenExp = t.Token, t.Expires
+      if c.fresh() { return nil }
+    }
+  }
+
   if c.APIKey == "" { return errors.New("missing API key") }
   var lr struct {
     Status string `json:"status"`
@@ -59,7 +82,11 @@ func (c *HTTPClient) Login(ctx context.Context) error {
   if err != nil { return err }
   if lr.Data.Token == "" { return errors.New("empty token from login") }
   c.token = lr.Data.Token
-  c.tokenExp = time.Now().Add(30 * 24 * time.Hour)
+  c.tokenExp = tokenExpiry(lr.Data.Token)
+  if c.Home != "" {
+    // a token that can't be saved still works for this run
+    _ = state.SaveToken(c.Home, c.Name(), state.Token{Key: c.keyID(), Token: c.token, Expires: c.tokenExp})
+  }
   return nil
 }
 
@@ -78,6 +105,7 @@ func (c *HTTPClient) SearchSeries(ctx context.Context, q, lang string) ([]Series
       Slug    string  `json:"slug"`
       Aliases []string`json:"aliases"`
       Type    string  `json:"type"`
+      Remote  []tvdbRemoteID `json:"remote_ids"`
     } `json:"data"`
   }
   if err := c.doJSON(ctx, http.MethodGet, c.u("/search")+"?"+v.Encode(), nil, lang, &sr, true); err != nil {
@@ -87,7 +115,8 @@ func (c *HTTPClient) SearchSeries(ctx context.Context, q, lang string) ([]Series
   out := make([]Series, 0, len(sr.Data))
   for _, d := range sr.Data {
     if strings.ToLower(d.Type) != "series" { continue }
-    out = append(out, Series{ID: intFromAny(d.ID), Name: d.Name, Year: intFromAny(d.Year), Slug: d.Slug, Aliases: d.Aliases})
+    id := intFromAny(d.ID)
+    out = append(out, Series{ID: id, Name: d.Name, Year: intFromAny(d.Year), Slug: d.Slug, Aliases: d.Aliases, IDs: remoteIDs(id, d.Remote)})
   }
   return out, nil
 }
@@ -103,7 +132,8 @@ func (c *HTTPClient) GetSeries(ctx context.Context, id int, lang string) (Series
       Name    string   `json:"name"`
       Slug    string   `json:"slug"`
       Year    any      `json:"year"`
-      Aliases []string `json:"aliases"`
+      Aliases json.RawMessage `json:"aliases"`
+      Remote  []tvdbRemoteID `json:"remoteIds"`
     } `json:"data"`
   }
 
@@ -125,7 +155,8 @@ func (c *HTTPClient) GetSeries(ctx context.Context, id int, lang string) (Series
     Name:    d.Name,
     Slug:    d.Slug,
     Year:    intFromAny(d.Year),
-    Aliases: d.Aliases,
+    Aliases: aliasNames(d.Aliases),
+    IDs:     remoteIDs(intFromAny(d.ID), d.Remote),
   }, nil
 }
 
@@ -143,6 +174,7 @@ func (c *HTTPClient) GetEpisodes(ctx context.Context, id int, order string, seas
         Number   any    `json:"number"`
         Absolute any    `json:"absoluteNumber"`
         Season   any    `json:"seasonNumber"`
+        Runtime  any    `json:"runtime"`
       } `json:"episodes"`
     } `json:"data"`
     Links struct{ Next any `json:"next"` } `json:"links"`
@@ -168,19 +200,27 @@ func (c *HTTPClient) GetEpisodes(ctx context.Context, id int, order string, seas
         if tt, _ := time.Parse("2006-01-02", d.Aired); !tt.IsZero() { t = tt }
       }
       out = append(out, Episode{
+        IDs:      types.RemoteIDs{TVDB: intFromAny(d.ID)},
         ID:       intFromAny(d.ID),
         Title:    d.Name,
         AirDate:  t,
         Season:   intFromAny(d.Season),
         Number:   intFromAny(d.Number),
         Absolute: intFromAny(d.Absolute),
+        Runtime:  intFromAny(d.Runtime),
       })
     }
 
+    // links.next is the next page's URL in v4, or a bare page number
     next := 0
     switch v := er.Links.Next.(type) {
     case float64: next = int(v)
-    case string:  if n, _ := strconv.Atoi(v); n > 0 { next = n }
+    case string:
+      if n, err := strconv.Atoi(v); err == nil {
+        next = n
+      } else if nu, err := url.Parse(v); err == nil {
+        next, _ = strconv.Atoi(nu.Query().Get("page"))
+      }
     }
     if next == 0 { break }
     page = next
@@ -190,15 +230,63 @@ func (c *HTTPClient) GetEpisodes(ctx context.Context, id int, order string, seas
 
 // ===== helpers =====
 
-func (c *HTTPClient) ensureAuth(ctx context.Context) error {
-  if c.token == "" || time.Now().After(c.tokenExp.Add(-2*time.Minute)) {
-    return c.Login(ctx)
+// tvdbRemoteID is one entry of TVDB's cross-reference list
+type tvdbRemoteID struct {
+  ID         string `json:"id"`
+  SourceName string `json:"sourceName"`
+}
+
+func remoteIDs(tvdbID int, list []tvdbRemoteID) types.RemoteIDs {
+  ids := types.RemoteIDs{TVDB: tvdbID}
+  for _, r := range list {
+    switch strings.ToLower(strings.ReplaceAll(r.SourceName, " ", "")) {
+    case "imdb": ids.IMDb = r.ID
+    case "themoviedb.com", "tmdb": ids.TMDB = intFromAny(r.ID)
+    case "tvmaze": ids.TVmaze = intFromAny(r.ID)
+    }
   }
-  return nil
+  return ids
 }
 
-func cacheKeyEpisodes(id int, order string, season int, lang string) string {
-  return fmt.Sprintf("episodes:%d:%s:%d:%s", id, normaliseOrder(order), season, strings.ToLower(lang))
+// aliasNames reads aliases as search returns them, plain strings, or as the series
+// endpoint does, {"language": "eng", "name": "..."} objects
+func aliasNames(raw json.RawMessage) []string {
+  var names []string
+  if json.Unmarshal(raw, &names) == nil { return names }
+  var objs []struct{ Name string `json:"name"` }
+  if json.Unmarshal(raw, &objs) != nil { return nil }
+  for _, o := range objs { names = append(names, o.Name) }
+  return names
+}
+
+func (c *HTTPClient) ensureAuth(ctx context.Context) error { return c.authenticate(ctx, "") }
+
+// fresh reports whether the held token has more than two minutes left. Call with mu held.
+func (c *HTTPClient) fresh() bool { return time.Now().Before(c.tokenExp.Add(-2 * time.Minute)) }
+
+func (c *HTTPClient) bearer() string {
+  c.mu.Lock()
+  defer c.mu.Unlock()
+  return c.token
+}
+
+// keyID fingerprints the credentials a token was issued for without storing them
+func (c *HTTPClient) keyID() string {
+  sum := sha256.Sum256([]byte(c.APIKey + "\x00" + c.PIN))
+  return hex.EncodeToString(sum[:8])
+}
+
+// tokenExpiry reads the exp claim of a TVDB token, a JWT. Tokens that can't be read are
+// assumed to last the documented month.
+func tokenExpiry(tok string) time.Time {
+  parts := strings.Split(tok, ".")
+  if len(parts) == 3 {
+    var claims struct{ Exp json.Number `json:"exp"` }
+    if b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "=")); err == nil && json.Unmarshal(b, &claims) == nil {
+      if n, err := claims.Exp.Float64(); err == nil && n > 0 { return time.Unix(int64(n), 0) }
+    }
+  }
+  return time.Now().Add(30 * 24 * time.Hour)
 }
 
 func intFromAny(v any) int {
@@ -243,7 +331,8 @@ func retryAfterDelay(h string) time.Duration {
   return 2 * time.Second
 }
 
-// doJSON sends the request, retries on 429, optionally re-logins on 401, and decodes JSON into out
+// doJSON sends the request under the retry policy, re-logs in once on 401 when auth was
+// requested, and decodes JSON into out
 func (c *HTTPClient) doJSON(ctx context.Context, method, urlStr string, body any, acceptLang string, out any, withAuth bool) error {
   // marshal once so we can reuse on retries
   var payload []byte
@@ -253,44 +342,86 @@ func (c *HTTPClient) doJSON(ctx context.Context, method, urlStr string, body any
     payload = b
   }
 
-  for attempt := 0; attempt < 3; attempt++ {
-    var rdr io.Reader
-    if payload != nil { rdr = bytes.NewReader(payload) }
-
-    req, err := http.NewRequestWithContext(ctx, method, urlStr, rdr)
+  for relogged := false; ; relogged = true {
+    tok := ""
+    if withAuth { tok = c.bearer() }
+    resp, err := c.retry.do(ctx, method+" "+redactURL(urlStr), func() (*http.Response, error) {
+      var rdr io.Reader
+      if payload != nil { rdr = bytes.NewReader(payload) }
+      req, err := http.NewRequestWithContext(ctx, method, urlStr, rdr)
+      if err != nil { return nil, err }
+      req.Header.Set("User-Agent", userAgent)
+      if acceptLang != "" { req.Header.Set("Accept-Language", acceptLang) }
+      if payload != nil { req.Header.Set("Content-Type", "application/json") }
+      if tok != "" { req.Header.Set("Authorization", "Bearer "+tok) }
+      return c.hc.Do(req)
+    })
     if err != nil { return err }
-    req.Header.Set("User-Agent", userAgent)
-    if acceptLang != "" { req.Header.Set("Accept-Language", acceptLang) }
-    if payload != nil { req.Header.Set("Content-Type", "application/json") }
-    if withAuth && c.token != "" { req.Header.Set("Authorization", "Bearer "+c.token) }
 
-    resp, err := c.hc.Do(req)
-    if err != nil { return err }
-
-    // 429 backoff & retry
-    if resp.StatusCode == http.StatusTooManyRequests {
-      d := retryAfterDelay(resp.Header.Get("Retry-After"))
-      resp.Body.Close()
-      time.Sleep(d)
-      continue
-    }
-
-    // one re-login on 401 when auth was requested
-    if resp.StatusCode == http.StatusUnauthorized && withAuth && attempt == 0 {
+    if resp.StatusCode == http.StatusUnauthorized && withAuth && !relogged {
       resp.Body.Close()
-      if err := c.Login(ctx); err != nil { return err }
+      if err := c.authenticate(ctx, tok); err != nil { return err }
       continue
     }
-
     if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-      b, _ := io.ReadAll(resp.Body)
-      resp.Body.Close()
-      return fmt.Errorf("%s %s failed: %s: %s", method, urlStr, resp.Status, string(b))
+      return statusError(method, urlStr, resp)
     }
 
     decErr := json.NewDecoder(resp.Body).Decode(out)
     resp.Body.Close()
     return decErr
   }
-  return fmt.Errorf("%s %s failed after retries", method, urlStr)
+}
+
+// getJSON is the plain GET used by the providers that need no login dance.
+// It retries under rt like doJSON and decodes a 2xx body into out.
+func getJSON(ctx context.Context, hc *http.Client, rt *retrier, urlStr string, hdr http.Header, out any) error {
+  resp, err := rt.do(ctx, "GET "+redactURL(urlStr), func() (*http.Response, error) {
+    req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlStr, nil)
+    if err != nil { return nil, err }
+    req.Header.Set("User-Agent", userAgent)
+    req.Header.Set("Accept", "application/json")
+    for k, v := range hdr { req.Header[k] = v }
+    return hc.Do(req)
+  })
+  if err != nil { return err }
+  if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+    return statusError(http.MethodGet, urlStr, resp)
+  }
+
+  decErr := json.NewDecoder(resp.Body).Decode(out)
+  resp.Body.Close()
+  return decErr
+}
+
+// StatusError is a non-2xx API response. Callers can check Code with errors.As.
+type StatusError struct {
+  Method string
+  URL    string
+  Status string
+  Code   int
+  Body   string
+}
+
+func (e *StatusError) Error() string {
+  return fmt.Sprintf("%s %s failed: %s: %s", e.Method, e.URL, e.Status, e.Body)
+}
+
+// statusError drains and closes the body into a StatusError
+func statusError(method, urlStr string, resp *http.Response) error {
+  b, _ := io.ReadAll(resp.Body)
+  resp.Body.Close()
+  return &StatusError{Method: method, URL: redactURL(urlStr), Status: resp.Status, Code: resp.StatusCode, Body: string(b)}
+}
+
+// redactURL drops credentials passed as query parameters so they never reach logs
+func redactURL(s string) string {
+  u, err := url.Parse(s)
+  if err != nil || u.RawQuery == "" { return s }
+  q := u.Query()
+  if q.Has("api_key") {
+    q.Del("api_key")
+    u.RawQuery = q.Encode()
+  }
+  return u.String()
 }
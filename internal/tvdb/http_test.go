@@ -0,0 +1,178 @@
+package tvdb
+
+import (
+  "context"
+  "errors"
+  "os"
+  "path/filepath"
+  "runtime"
+  "sync"
+  "testing"
+  "time"
+
+  "github.com/GizzmoShifu/tvrn/internal/tvdb/tvdbtest"
+)
+
+func newTestClient(t *testing.T) (*HTTPClient, *tvdbtest.Server) {
+  t.Helper()
+  srv := tvdbtest.New(t)
+  return NewHTTP(srv.URL, tvdbtest.APIKey, ""), srv
+}
+
+func TestHTTPLogin(t *testing.T) {
+  ctx := context.Background()
+  c, srv := newTestClient(t)
+  if err := c.Login(ctx); err != nil { t.Fatalf("login: %v", err) }
+  if srv.Logins() != 1 { t.Fatalf("logins = %d, want 1", srv.Logins()) }
+
+  bad := NewHTTP(srv.URL, "wrong", "")
+  err := bad.Login(ctx)
+  var se *StatusError
+  if !errors.As(err, &se) || se.Code != 401 { t.Fatalf("wrong key: err = %v, want a 401 StatusError", err) }
+}
+
+func TestHTTPSearchSeries(t *testing.T) {
+  ctx := context.Background()
+  c, _ := newTestClient(t)
+
+  hits, err := c.SearchSeries(ctx, "Firefly", "en")
+  if err != nil { t.Fatal(err) }
+  if len(hits) != 2 { t.Fatalf("got %d hits, want 2 (the movie is dropped)", len(hits)) }
+  ff := hits[0]
+  if ff.ID != 78874 || ff.Name != "Firefly" || ff.Year != 2002 {
+    t.Errorf("first hit = %+v", ff)
+  }
+  if ff.IDs.TMDB != 1437 || ff.IDs.IMDb != "tt0303461" || ff.IDs.TVmaze != 180 {
+    t.Errorf("remote IDs = %+v", ff.IDs)
+  }
+
+  none, err := c.SearchSeries(ctx, "My Fake Show", "en")
+  if err != nil || len(none) != 0 { t.Fatalf("unknown show: %v, %v", none, err) }
+}
+
+func TestHTTPGetSeries(t *testing.T) {
+  c, _ := newTestClient(t)
+  s, err := c.GetSeries(context.Background(), 78874, "en")
+  if err != nil { t.Fatal(err) }
+  if s.Name != "Firefly" || s.Year != 2002 || s.IDs.TMDB != 1437 { t.Errorf("series = %+v", s) }
+}
+
+func TestHTTPGetEpisodesPaginates(t *testing.T) {
+  tests := []struct {
+    name     string
+    order    string
+    season   int
+    pageSize int
+    want     int
+    first    string
+  }{
+    {"aired season 1 over three pages", "aired", 1, 5, 14, "The Train Job"},
+    {"all seasons include specials", "aired", 0, 5, 15, "Here's How It Was: The Making of Firefly"},
+    {"single page", "default", 1, 500, 14, "The Train Job"},
+    {"dvd order", "dvd", 1, 4, 14, "Serenity"},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      c, srv := newTestClient(t)
+      srv.PageSize = tt.pageSize
+      eps, err := c.GetEpisodes(context.Background(), 78874, tt.order, tt.season, "en")
+      if err != nil { t.Fatal(err) }
+      if len(eps) != tt.want { t.Fatalf("got %d episodes, want %d", len(eps), tt.want) }
+      if eps[0].Title != tt.first { t.Errorf("first title = %q, want %q", eps[0].Title, tt.first) }
+      pages := (tt.want + tt.pageSize - 1) / tt.pageSize
+      if got := srv.Hits("/series/78874/episodes/" + normaliseOrder(tt.order)); got != pages {
+        t.Errorf("fetched %d pages, want %d", got, pages)
+      }
+    })
+  }
+}
+
+func TestHTTPRelogsInOn401(t *testing.T) {
+  ctx := context.Background()
+  c, srv := newTestClient(t)
+  if _, err := c.GetSeries(ctx, 78874, "en"); err != nil { t.Fatal(err) }
+
+  srv.ExpireTokens()
+  if _, err := c.GetSeries(ctx, 78874, "en"); err != nil { t.Fatalf("after expiry: %v", err) }
+  if srv.Logins() != 2 { t.Errorf("logins = %d, want 2", srv.Logins()) }
+}
+
+func TestHTTPRetriesAfter429(t *testing.T) {
+  ctx := context.Background()
+  c, srv := newTestClient(t)
+  if err := c.Login(ctx); err != nil { t.Fatal(err) }
+
+  srv.Throttle(1, "1")
+  s, err := c.GetSeries(ctx, 78874, "en")
+  if err != nil { t.Fatalf("after 429: %v", err) }
+  if s.ID != 78874 { t.Errorf("series = %+v", s) }
+  if got := srv.Hits("/series/78874"); got != 2 { t.Errorf("requests = %d, want 2", got) }
+}
+
+func TestHTTPMalformedPayload(t *testing.T) {
+  c, srv := newTestClient(t)
+  srv.Malform("/series/78874/episodes")
+  if _, err := c.GetEpisodes(context.Background(), 78874, "aired", 1, "en"); err == nil {
+    t.Fatal("want a decode error for a truncated body")
+  }
+}
+
+func TestHTTPTokenExpiryFromJWT(t *testing.T) {
+  c, srv := newTestClient(t)
+  srv.TokenTTL = 6 * time.Hour
+  if err := c.Login(context.Background()); err != nil { t.Fatal(err) }
+  if d := time.Until(c.tokenExp); d < 5*time.Hour || d > 7*time.Hour {
+    t.Errorf("token expires in %v, want about 6h from the exp claim", d)
+  }
+
+  // a token inside the two-minute margin is replaced before use
+  srv.TokenTTL = time.Minute
+  c2 := NewHTTP(srv.URL, tvdbtest.APIKey, "")
+  for i := 0; i < 2; i++ {
+    if _, err := c2.GetSeries(context.Background(), 78874, "en"); err != nil { t.Fatal(err) }
+  }
+  if srv.Logins() != 3 { t.Errorf("logins = %d, want 3", srv.Logins()) }
+}
+
+func TestHTTPTokenSharedAcrossProcesses(t *testing.T) {
+  ctx := context.Background()
+  srv := tvdbtest.New(t)
+  home := t.TempDir()
+  if err := os.MkdirAll(filepath.Join(home, "state"), 0o755); err != nil { t.Fatal(err) }
+  client := func(key string) *HTTPClient {
+    c := NewHTTP(srv.URL, key, "")
+    c.Home = home
+    return c
+  }
+
+  for i := 0; i < 3; i++ {
+    if _, err := client(tvdbtest.APIKey).GetSeries(ctx, 78874, "en"); err != nil { t.Fatal(err) }
+  }
+  if srv.Logins() != 1 { t.Errorf("three runs logged in %d times, want 1", srv.Logins()) }
+
+  st, err := os.Stat(filepath.Join(home, "state", "tvdb_token.json"))
+  if err != nil { t.Fatal(err) }
+  if runtime.GOOS != "windows" && st.Mode().Perm() != 0o600 { t.Errorf("token file mode = %v, want 0600", st.Mode().Perm()) }
+
+  // a different key must not pick up the saved token
+  if err := client("another-key").Login(ctx); err == nil { t.Error("login with a changed key reused the saved token") }
+
+  // a saved token the server has revoked is replaced once
+  srv.ExpireTokens()
+  if _, err := client(tvdbtest.APIKey).GetSeries(ctx, 78874, "en"); err != nil { t.Fatal(err) }
+  if srv.Logins() != 2 { t.Errorf("logins after revocation = %d, want 2", srv.Logins()) }
+}
+
+func TestHTTPLoginIsSingleFlight(t *testing.T) {
+  c, srv := newTestClient(t)
+  var wg sync.WaitGroup
+  for i := 0; i < 8; i++ {
+    wg.Add(1)
+    go func() {
+      defer wg.Done()
+      if _, err := c.GetSeries(context.Background(), 78874, "en"); err != nil { t.Error(err) }
+    }()
+  }
+  wg.Wait()
+  if srv.Logins() != 1 { t.Errorf("concurrent requests logged in %d times, want 1", srv.Logins()) }
+}
@@ -0,0 +1,144 @@
+package tvdb
+
+import (
+  "context"
+  "encoding/csv"
+  "encoding/json"
+  "fmt"
+  "io"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+)
+
+// Local serves one hand-written series from a JSON or CSV file, for shows no provider carries.
+//
+// JSON is either a bare episode list or {"series": {...}, "episodes": [...]}:
+//
+//   {"series": {"name": "My Fake Show", "year": 2021},
+//    "episodes": [{"season": 1, "number": 1, "title": "Pilot", "aired": "2021-01-04"}]}
+//
+// CSV needs a header with at least season, number and title; aired, absolute, order and runtime
+// are optional. Rows without an order are aired order.
+//
+// Whatever name is searched for matches, so the file should hold a single series.
+type Local struct {
+  series   Series
+  episodes map[string][]Episode // by normalised order
+}
+
+type localEpisode struct {
+  Season   int    `json:"season"`
+  Number   int    `json:"number"`
+  Absolute int    `json:"absolute"`
+  Title    string `json:"title"`
+  Aired    string `json:"aired"`
+  Order    string `json:"order"`
+  Runtime  int    `json:"runtime"` // minutes
+}
+
+func NewLocal(path string) (*Local, error) {
+  fd, err := os.Open(path)
+  if err != nil { return nil, err }
+  defer fd.Close()
+
+  var eps []localEpisode
+  var head struct {
+    Name string `json:"name"`
+    Year int    `json:"year"`
+    ID   int    `json:"id"`
+  }
+  switch strings.ToLower(filepath.Ext(path)) {
+  case ".csv":
+    eps, err = readLocalCSV(fd)
+  default:
+    eps, err = readLocalJSON(fd, &head)
+  }
+  if err != nil { return nil, fmt.Errorf("metadata %s: %w", path, err) }
+  if len(eps) == 0 { return nil, fmt.Errorf("metadata %s: no episodes", path) }
+
+  l := &Local{episodes: map[string][]Episode{}}
+  l.series = Series{ID: head.ID, Name: head.Name, Year: head.Year}
+  if l.series.ID == 0 { l.series.ID = 1 }
+  for _, e := range eps {
+    order := normaliseOrder(e.Order)
+    l.episodes[order] = append(l.episodes[order], Episode{
+      Season: e.Season, Number: e.Number, Absolute: e.Absolute, Title: e.Title,
+      AirDate: dateOf(e.Aired), Runtime: e.Runtime, IsSpecial: e.Season == 0,
+    })
+  }
+  for order := range l.episodes { absoluteNumbers(l.episodes[order]) }
+  return l, nil
+}
+
+func (l *Local) Name() string { return "local" }
+
+func (l *Local) Login(ctx context.Context) error { return nil }
+
+// SearchSeries always hits; an unnamed file takes the name searched for.
+func (l *Local) SearchSeries(ctx context.Context, q, lang string) ([]Series, error) {
+  s := l.series
+  if s.Name == "" { s.Name = q }
+  return []Series{s}, nil
+}
+
+func (l *Local) GetSeries(ctx context.Context, id int, lang string) (Series, error) { return l.series, nil }
+
+func (l *Local) GetEpisodes(ctx context.Context, id int, order string, season int, lang string) ([]Episode, error) {
+  var out []Episode
+  for _, e := range l.episodes[normaliseOrder(order)] {
+    if season == 0 || e.Season == season { out = append(out, e) }
+  }
+  return out, nil
+}
+
+// ===== readers =====
+
+func readLocalJSON(r io.Reader, head any) ([]localEpisode, error) {
+  b, err := io.ReadAll(r)
+  if err != nil { return nil, err }
+  var list []localEpisode
+  if json.Unmarshal(b, &list) == nil { return list, nil }
+
+  var doc struct {
+    Series   json.RawMessage `json:"series"`
+    Episodes []localEpisode  `json:"episodes"`
+  }
+  if err := json.Unmarshal(b, &doc); err != nil { return nil, err }
+  if len(doc.Series) > 0 {
+    if err := json.Unmarshal(doc.Series, head); err != nil { return nil, err }
+  }
+  return doc.Episodes, nil
+}
+
+func readLocalCSV(r io.Reader) ([]localEpisode, error) {
+  rows, err := csv.NewReader(r).ReadAll()
+  if err != nil { return nil, err }
+  if len(rows) < 2 { return nil, nil }
+
+  col := map[string]int{}
+  for i, h := range rows[0] { col[strings.ToLower(strings.TrimSpace(h))] = i }
+  for _, need := range []string{"season", "number", "title"} {
+    if _, ok := col[need]; !ok { return nil, fmt.Errorf("csv header needs a %q column", need) }
+  }
+  field := func(row []string, name string) string {
+    i, ok := col[name]
+    if !ok || i >= len(row) { return "" }
+    return strings.TrimSpace(row[i])
+  }
+
+  var out []localEpisode
+  for n, row := range rows[1:] {
+    s, err1 := strconv.Atoi(field(row, "season"))
+    e, err2 := strconv.Atoi(field(row, "number"))
+    if err1 != nil || err2 != nil { return nil, fmt.Errorf("csv line %d: bad season or number", n+2) }
+    abs, _ := strconv.Atoi(field(row, "absolute"))
+    runtime, _ := strconv.Atoi(field(row, "runtime"))
+    out = append(out, localEpisode{
+      Season: s, Number: e, Absolute: abs, Title: field(row, "title"),
+      Aired: field(row, "aired"), Order: field(row, "order"), Runtime: runtime,
+    })
+  }
+  return out, nil
+}
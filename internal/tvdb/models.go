@@ -1,6 +1,10 @@
 package tvdb
 
-import "time"
+import (
+  "time"
+
+  "github.com/GizzmoShifu/tvrn/pkg/types"
+)
 
 type Series struct {
   ID      int
@@ -8,6 +12,7 @@ type Series struct {
   Year    int
   Slug    string
   Aliases []string
+  IDs     types.RemoteIDs // cross-references, including the provider's own ID
 }
 
 type Episode struct {
@@ -17,5 +22,7 @@ type Episode struct {
   Absolute  int
   Title     string
   AirDate   time.Time
+  Runtime   int // minutes, when the provider knows
   IsSpecial bool
+  IDs       types.RemoteIDs
 }
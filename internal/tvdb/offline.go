@@ -0,0 +1,53 @@
+package tvdb
+
+import (
+  "context"
+  "encoding/json"
+  "fmt"
+
+  "github.com/GizzmoShifu/tvrn/internal/cache"
+)
+
+// Offline serves a provider's results from the cache alone and never touches the network.
+// Expired entries are still served. A miss names the key so the user knows what to warm.
+type Offline struct {
+  name  string
+  store cache.Store
+}
+
+func NewOffline(provider string, s cache.Store) *Offline { return &Offline{name: provider, store: s} }
+
+func (o *Offline) Name() string { return o.name }
+
+func (o *Offline) Login(ctx context.Context) error { return nil }
+
+func (o *Offline) SearchSeries(ctx context.Context, q, lang string) ([]Series, error) {
+  var out []Series
+  return out, o.load(CacheKeySearch(o.name, q, lang), &out)
+}
+
+func (o *Offline) GetSeries(ctx context.Context, id int, lang string) (Series, error) {
+  var out Series
+  return out, o.load(CacheKeySeries(o.name, id, lang), &out)
+}
+
+func (o *Offline) GetEpisodes(ctx context.Context, id int, order string, season int, lang string) ([]Episode, error) {
+  var out []Episode
+  return out, o.load(CacheKeyEpisodes(o.name, id, order, season, lang), &out)
+}
+
+// MissingKeyError is returned for every offline cache miss.
+type MissingKeyError struct{ Key string }
+
+func (e *MissingKeyError) Error() string {
+  return fmt.Sprintf("offline: no cached entry %q (run once online or `tvrn cache warm` first)", e.Key)
+}
+
+func (o *Offline) load(key string, out any) error {
+  e, ok := o.store.Peek(key)
+  if !ok { return &MissingKeyError{Key: key} }
+  if err := json.Unmarshal(e.Body, out); err != nil {
+    return fmt.Errorf("offline: cached entry %q is unreadable: %w", key, err)
+  }
+  return nil
+}
@@ -0,0 +1,176 @@
+package tvdb
+
+import (
+  "bytes"
+  "encoding/json"
+  "fmt"
+  "io"
+  "net/http"
+  "os"
+  "path/filepath"
+  "sort"
+  "strings"
+  "sync"
+)
+
+// Recorder and Replayer sit at the HTTP transport of every provider client. A recorded
+// folder holds one JSON file per request/response pair with API keys, PINs and tokens
+// stripped, so it can be attached to a bug report and replayed offline.
+
+// Exchange is one recorded request and its response
+type Exchange struct {
+  Method   string            `json:"method"`
+  URL      string            `json:"url"`
+  Request  json.RawMessage   `json:"request,omitempty"` // JSON request body, credentials redacted
+  Status   int               `json:"status"`
+  Header   map[string]string `json:"header,omitempty"`
+  Response json.RawMessage   `json:"response,omitempty"` // JSON response body, tokens redacted
+  Text     string            `json:"text,omitempty"`     // a response body that isn't JSON
+}
+
+// redacted replaces credential values in recorded bodies
+const redacted = "REDACTED"
+
+// secretKeys are JSON fields blanked wherever they appear in a body
+var secretKeys = map[string]bool{"apikey": true, "api_key": true, "pin": true, "token": true, "access_token": true}
+
+// keptHeaders are the response headers the clients act on
+var keptHeaders = []string{"Content-Type", "Retry-After"}
+
+// Recorder passes requests through to the network and writes each exchange to Dir
+type Recorder struct {
+  Dir  string
+  next http.RoundTripper
+  mu   sync.Mutex
+  seq  int
+}
+
+func NewRecorder(dir string) (*Recorder, error) {
+  if err := os.MkdirAll(dir, 0o755); err != nil { return nil, err }
+  // carry on after an earlier recording in the same folder rather than overwrite it
+  old, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+  return &Recorder{Dir: dir, next: http.DefaultTransport, seq: len(old)}, nil
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+  var reqBody []byte
+  if req.GetBody != nil {
+    rc, err := req.GetBody()
+    if err != nil { return nil, err }
+    reqBody, err = io.ReadAll(rc)
+    rc.Close()
+    if err != nil { return nil, err }
+  }
+
+  resp, err := r.next.RoundTrip(req)
+  if err != nil { return nil, err }
+  b, err := io.ReadAll(resp.Body)
+  resp.Body.Close()
+  if err != nil { return nil, err }
+  resp.Body = io.NopCloser(bytes.NewReader(b))
+
+  ex := Exchange{Method: req.Method, URL: redactURL(req.URL.String()), Status: resp.StatusCode, Header: map[string]string{}}
+  if len(reqBody) > 0 { ex.Request = scrubJSON(reqBody) }
+  if json.Valid(b) {
+    ex.Response = scrubJSON(b)
+  } else {
+    ex.Text = string(b)
+  }
+  for _, h := range keptHeaders {
+    if v := resp.Header.Get(h); v != "" { ex.Header[h] = v }
+  }
+  if err := r.write(ex, req); err != nil { return nil, fmt.Errorf("record: %w", err) }
+  return resp, nil
+}
+
+func (r *Recorder) write(ex Exchange, req *http.Request) error {
+  b, err := json.MarshalIndent(ex, "", "  ")
+  if err != nil { return err }
+  r.mu.Lock()
+  defer r.mu.Unlock()
+  r.seq++
+  slug := strings.ToLower(req.Method) + strings.ReplaceAll(strings.TrimRight(req.URL.Path, "/"), "/", "-")
+  name := fmt.Sprintf("%04d-%s-%s.json", r.seq, req.URL.Hostname(), slug)
+  return os.WriteFile(filepath.Join(r.Dir, name), append(b, '\n'), 0o644)
+}
+
+// Replayer answers requests from a folder written by Recorder and never touches the network.
+// Requests are matched on method and URL; a request made more than once gets the recorded
+// responses in order, then the last one again.
+type Replayer struct {
+  mu    sync.Mutex
+  queue map[string][]Exchange
+  used  map[string]int
+}
+
+func NewReplayer(dir string) (*Replayer, error) {
+  files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+  if err != nil { return nil, err }
+  if len(files) == 0 { return nil, fmt.Errorf("replay: no recorded exchanges in %s", dir) }
+  sort.Strings(files)
+
+  r := &Replayer{queue: map[string][]Exchange{}, used: map[string]int{}}
+  for _, f := range files {
+    b, err := os.ReadFile(f)
+    if err != nil { return nil, err }
+    var ex Exchange
+    if err := json.Unmarshal(b, &ex); err != nil { return nil, fmt.Errorf("replay: %s: %w", filepath.Base(f), err) }
+    k := ex.Method + " " + ex.URL
+    r.queue[k] = append(r.queue[k], ex)
+  }
+  return r, nil
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+  if req.Body != nil { req.Body.Close() }
+  k := req.Method + " " + redactURL(req.URL.String())
+
+  r.mu.Lock()
+  q := r.queue[k]
+  i := r.used[k]
+  if i < len(q)-1 { r.used[k]++ }
+  r.mu.Unlock()
+  if len(q) == 0 { return nil, fmt.Errorf("replay: nothing recorded for %s", k) }
+
+  ex := q[i]
+  body := []byte(ex.Response)
+  if ex.Text != "" { body = []byte(ex.Text) }
+  hdr := http.Header{}
+  for h, v := range ex.Header { hdr.Set(h, v) }
+  return &http.Response{
+    Status:        fmt.Sprintf("%d %s", ex.Status, http.StatusText(ex.Status)),
+    StatusCode:    ex.Status,
+    Proto:         "HTTP/1.1",
+    ProtoMajor:    1,
+    ProtoMinor:    1,
+    Header:        hdr,
+    Body:          io.NopCloser(bytes.NewReader(body)),
+    ContentLength: int64(len(body)),
+    Request:       req,
+  }, nil
+}
+
+// scrubJSON blanks every credential field in a JSON document, at any depth
+func scrubJSON(b []byte) json.RawMessage {
+  var v any
+  if err := json.Unmarshal(b, &v); err != nil { return b }
+  out, err := json.Marshal(scrub(v))
+  if err != nil { return b }
+  return out
+}
+
+func scrub(v any) any {
+  switch t := v.(type) {
+  case map[string]any:
+    for k, x := range t {
+      if _, ok := x.(string); ok && secretKeys[strings.ToLower(k)] {
+        t[k] = redacted
+        continue
+      }
+      t[k] = scrub(x)
+    }
+  case []any:
+    for i := range t { t[i] = scrub(t[i]) }
+  }
+  return v
+}
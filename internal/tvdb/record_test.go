@@ -0,0 +1,74 @@
+package tvdb
+
+import (
+  "context"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+
+  "github.com/GizzmoShifu/tvrn/internal/tvdb/tvdbtest"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+  ctx := context.Background()
+  dir := t.TempDir()
+  srv := tvdbtest.New(t)
+
+  rec, err := NewRecorder(dir)
+  if err != nil { t.Fatal(err) }
+  c := NewHTTP(srv.URL, tvdbtest.APIKey, "1234")
+  c.hc.Transport = rec
+  if err := c.Login(ctx); err != nil { t.Fatal(err) }
+  token := c.token
+  hits, err := c.SearchSeries(ctx, "Firefly", "en")
+  if err != nil { t.Fatal(err) }
+  live, err := c.GetEpisodes(ctx, hits[0].ID, "aired", 1, "en")
+  if err != nil { t.Fatal(err) }
+
+  files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+  if len(files) != 5 { t.Fatalf("recorded %d exchanges, want 5 (login, search, three pages)", len(files)) }
+  for _, f := range files {
+    b, _ := os.ReadFile(f)
+    for _, secret := range []string{tvdbtest.APIKey, "1234", token} {
+      if strings.Contains(string(b), secret) { t.Errorf("%s leaks %q", filepath.Base(f), secret) }
+    }
+  }
+
+  // the server is gone: everything must come from the folder
+  srv.Close()
+  rep, err := NewReplayer(dir)
+  if err != nil { t.Fatal(err) }
+  r := NewHTTP(srv.URL, "some-other-key", "")
+  r.hc.Transport = rep
+  again, err := r.SearchSeries(ctx, "Firefly", "en")
+  if err != nil { t.Fatal(err) }
+  if again[0].ID != hits[0].ID { t.Errorf("replayed series %d, want %d", again[0].ID, hits[0].ID) }
+  eps, err := r.GetEpisodes(ctx, hits[0].ID, "aired", 1, "en")
+  if err != nil { t.Fatal(err) }
+  if len(eps) != len(live) || eps[3].Title != live[3].Title { t.Errorf("replayed %d episodes, want %d", len(eps), len(live)) }
+
+  if _, err := r.GetEpisodes(ctx, hits[0].ID, "dvd", 1, "en"); err == nil || !strings.Contains(err.Error(), "nothing recorded") {
+    t.Errorf("unrecorded request: err = %v", err)
+  }
+}
+
+func TestReplayReplaysRetriesInOrder(t *testing.T) {
+  ctx := context.Background()
+  dir := t.TempDir()
+  srv := tvdbtest.New(t)
+  rec, _ := NewRecorder(dir)
+  c := NewHTTP(srv.URL, tvdbtest.APIKey, "")
+  c.hc.Transport = rec
+  if err := c.Login(ctx); err != nil { t.Fatal(err) }
+  srv.ExpireTokens()
+  if _, err := c.GetSeries(ctx, 78874, "en"); err != nil { t.Fatal(err) }
+
+  rep, err := NewReplayer(dir)
+  if err != nil { t.Fatal(err) }
+  r := NewHTTP(srv.URL, "replay", "")
+  r.hc.Transport = rep
+  s, err := r.GetSeries(ctx, 78874, "en")
+  if err != nil { t.Fatalf("401 then success should replay as recorded: %v", err) }
+  if s.Name != "Firefly" { t.Errorf("series = %+v", s) }
+}
@@ -0,0 +1,184 @@
+package tvdb
+
+import (
+  "context"
+  "errors"
+  "fmt"
+  "io"
+  "math/rand/v2"
+  "net"
+  "net/http"
+  "sync"
+  "syscall"
+  "time"
+
+  "github.com/GizzmoShifu/tvrn/internal/logx"
+)
+
+// RetryPolicy is how provider requests ride out rate limits and outages. Zero fields
+// take the value from DefaultRetry.
+type RetryPolicy struct {
+  Attempts        int           // tries per request, the first included
+  BaseDelay       time.Duration // wait before the first retry, doubled after each with jitter
+  MaxDelay        time.Duration // cap on a backoff wait, and on the wait a Retry-After asks for
+  BreakerFailures int           // requests failing in a row before the provider is treated as down
+  BreakerCooldown time.Duration // how long requests are refused once it is
+}
+
+var DefaultRetry = RetryPolicy{
+  Attempts:        4,
+  BaseDelay:       500 * time.Millisecond,
+  MaxDelay:        30 * time.Second,
+  BreakerFailures: 5,
+  BreakerCooldown: time.Minute,
+}
+
+// ErrUnavailable is returned without a request being sent while a provider's breaker is open
+var ErrUnavailable = errors.New("provider unavailable")
+
+// retrier applies a RetryPolicy and keeps one provider's breaker
+type retrier struct {
+  policy RetryPolicy
+  log    *logx.Logger
+
+  mu        sync.Mutex
+  failures  int       // consecutive failed requests
+  openUntil time.Time // zero while the breaker is closed
+  probing   bool      // after the cooldown, the one request let through is in flight
+}
+
+func newRetrier(p RetryPolicy, log *logx.Logger) *retrier {
+  d := DefaultRetry
+  if p.Attempts <= 0 { p.Attempts = d.Attempts }
+  if p.BaseDelay <= 0 { p.BaseDelay = d.BaseDelay }
+  if p.MaxDelay <= 0 { p.MaxDelay = d.MaxDelay }
+  if p.BreakerFailures <= 0 { p.BreakerFailures = d.BreakerFailures }
+  if p.BreakerCooldown <= 0 { p.BreakerCooldown = d.BreakerCooldown }
+  return &retrier{policy: p, log: log}
+}
+
+// do sends the request built by send until it gets an answer worth returning: a response
+// other than 429 or 502/503/504, an error that retrying won't fix, or the last attempt's result.
+// A returned response's body is the caller's to close. what names the request in logs.
+func (r *retrier) do(ctx context.Context, what string, send func() (*http.Response, error)) (*http.Response, error) {
+  probe, err := r.allow()
+  if err != nil { return nil, err }
+  attempts := r.policy.Attempts
+  if probe {
+    attempts = 1 // one request tells whether the provider is back
+    defer r.endProbe()
+  }
+  log := r.log.For(ctx)
+  for attempt := 1; ; attempt++ {
+    start := time.Now()
+    resp, err := send()
+    if err != nil {
+      log.Debugf("%s: %v after %v", what, err, time.Since(start).Round(time.Millisecond))
+    } else {
+      log.Debugf("%s: %s in %v", what, resp.Status, time.Since(start).Round(time.Millisecond))
+    }
+    if ctx.Err() != nil {
+      if resp != nil { resp.Body.Close() }
+      return nil, ctx.Err()
+    }
+    wait, again := r.retryable(resp, err, attempt)
+    if !again || attempt >= attempts {
+      r.record(log, what, resp, err)
+      return resp, err
+    }
+    why := fmt.Sprint(err)
+    if resp != nil {
+      why = resp.Status
+      io.Copy(io.Discard, resp.Body)
+      resp.Body.Close()
+    }
+    log.Warnf("%s: %s; retry %d of %d in %v", what, why, attempt, r.policy.Attempts-1, wait.Round(time.Millisecond))
+    if err := sleep(ctx, wait); err != nil { return nil, err }
+  }
+}
+
+// retryable reports whether an attempt is worth repeating, and after how long. A 500 is
+// not repeated: it is the API failing on this request, which the same request again
+// won't fix, where 502/503/504 are a gateway or an overloaded server that may recover.
+// It still counts towards the breaker.
+func (r *retrier) retryable(resp *http.Response, err error, attempt int) (time.Duration, bool) {
+  if err != nil { return r.backoff(attempt), transient(err) }
+  switch resp.StatusCode {
+  case http.StatusTooManyRequests:
+    return min(retryAfterDelay(resp.Header.Get("Retry-After")), r.policy.MaxDelay), true
+  case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+    if h := resp.Header.Get("Retry-After"); h != "" { return min(retryAfterDelay(h), r.policy.MaxDelay), true }
+    return r.backoff(attempt), true
+  }
+  return 0, false
+}
+
+// backoff doubles from BaseDelay up to MaxDelay, then picks a point in its upper half
+// so clients that failed together don't retry together
+func (r *retrier) backoff(attempt int) time.Duration {
+  d := r.policy.BaseDelay << (attempt - 1)
+  if d <= 0 || d > r.policy.MaxDelay { d = r.policy.MaxDelay }
+  return d/2 + rand.N(d/2+1)
+}
+
+// transient reports network failures that may pass: timeouts, resets and refused connections
+func transient(err error) bool {
+  var ne net.Error
+  if errors.As(err, &ne) && ne.Timeout() { return true }
+  return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+    errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// allow refuses requests while the breaker is open. After the cooldown it is half open:
+// one request, the probe, is let through and the rest refused until it is answered.
+// Its success closes the breaker; its failure opens it again straight away.
+func (r *retrier) allow() (probe bool, err error) {
+  r.mu.Lock()
+  defer r.mu.Unlock()
+  switch until := r.openUntil; {
+  case until.IsZero():
+    return false, nil
+  case time.Now().Before(until):
+    return false, fmt.Errorf("%w: %d requests failed in a row; retrying after %s", ErrUnavailable, r.failures, until.Format("15:04:05"))
+  case r.probing:
+    return false, fmt.Errorf("%w: %d requests failed in a row; checking whether it is back", ErrUnavailable, r.failures)
+  }
+  r.probing = true
+  return true, nil
+}
+
+// endProbe lets another request probe when this one ended without an answer, e.g. cancelled
+func (r *retrier) endProbe() {
+  r.mu.Lock()
+  r.probing = false
+  r.mu.Unlock()
+}
+
+// record counts a request's outcome towards the breaker. Any answer from the API short of
+// 5xx or 429 shows it is up.
+func (r *retrier) record(log *logx.Logger, what string, resp *http.Response, err error) {
+  r.mu.Lock()
+  defer r.mu.Unlock()
+  if err == nil && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+    r.failures = 0
+    r.openUntil = time.Time{}
+    return
+  }
+  r.failures++
+  if r.failures >= r.policy.BreakerFailures {
+    r.openUntil = time.Now().Add(r.policy.BreakerCooldown)
+    log.Errorf("%d requests failed in a row, the last %s; sending no more for %v", r.failures, what, r.policy.BreakerCooldown)
+  }
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+  t := time.NewTimer(d)
+  defer t.Stop()
+  select {
+  case <-ctx.Done():
+    return ctx.Err()
+  case <-t.C:
+    return nil
+  }
+}
@@ -0,0 +1,152 @@
+package tvdb
+
+import (
+  "context"
+  "encoding/json"
+  "errors"
+  "net/http"
+  "os"
+  "path/filepath"
+  "testing"
+  "time"
+
+  "github.com/GizzmoShifu/tvrn/internal/logx"
+  "github.com/GizzmoShifu/tvrn/internal/tvdb/tvdbtest"
+)
+
+// fastRetry keeps backoff waits short enough for tests
+var fastRetry = RetryPolicy{Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond, BreakerFailures: 2, BreakerCooldown: time.Minute}
+
+func TestRetryRidesOutServerErrors(t *testing.T) {
+  tests := []struct {
+    name  string
+    fails int
+    code  int
+    ok    bool
+    hits  int
+  }{
+    {"503 then success", 2, 503, true, 3},
+    {"504 then success", 1, 504, true, 2},
+    {"502 on every attempt", 3, 502, false, 3},
+    {"500 is not retried", 1, 500, false, 1},
+    {"404 is not retried", 1, 404, false, 1},
+  }
+  for _, tt := range tests {
+    t.Run(tt.name, func(t *testing.T) {
+      ctx := context.Background()
+      c, srv := newTestClient(t)
+      c.retry = newRetrier(fastRetry, nil)
+      if err := c.Login(ctx); err != nil { t.Fatal(err) }
+
+      srv.Fail(tt.fails, tt.code)
+      _, err := c.GetSeries(ctx, 78874, "en")
+      if tt.ok && err != nil { t.Fatalf("err = %v", err) }
+      var se *StatusError
+      if !tt.ok && (!errors.As(err, &se) || se.Code != tt.code) { t.Fatalf("err = %v, want a %d StatusError", err, tt.code) }
+      if got := srv.Hits("/series/78874"); got != tt.hits { t.Errorf("requests = %d, want %d", got, tt.hits) }
+    })
+  }
+}
+
+func TestRetryBreakerStopsRequests(t *testing.T) {
+  ctx := context.Background()
+  srv := tvdbtest.New(t)
+  c := NewHTTP(srv.URL, tvdbtest.APIKey, "")
+  c.retry = newRetrier(fastRetry, nil)
+  if err := c.Login(ctx); err != nil { t.Fatal(err) }
+  srv.Close() // connections are now refused
+
+  for i := 0; i < fastRetry.BreakerFailures; i++ {
+    if _, err := c.GetSeries(ctx, 78874, "en"); err == nil || errors.Is(err, ErrUnavailable) {
+      t.Fatalf("request %d: err = %v, want a network error", i+1, err)
+    }
+  }
+  start := time.Now()
+  _, err := c.GetSeries(ctx, 78874, "en")
+  if !errors.Is(err, ErrUnavailable) { t.Fatalf("err = %v, want ErrUnavailable once the breaker is open", err) }
+  if time.Since(start) > 10*time.Millisecond { t.Error("an open breaker should fail without waiting") }
+}
+
+func TestRetryBreakerHalfOpen(t *testing.T) {
+  fail := &http.Response{StatusCode: http.StatusServiceUnavailable}
+  ok := &http.Response{StatusCode: http.StatusOK}
+  p := fastRetry
+  p.BreakerCooldown = 10 * time.Millisecond
+  r := newRetrier(p, nil)
+  for range p.BreakerFailures { r.record(nil, "GET /series", fail, nil) }
+  if _, err := r.allow(); !errors.Is(err, ErrUnavailable) { t.Fatalf("open breaker: err = %v", err) }
+
+  // After the cooldown one probe goes through and the others wait for its answer
+  time.Sleep(15 * time.Millisecond)
+  probe, err := r.allow()
+  if !probe || err != nil { t.Fatalf("after the cooldown: probe %v, err %v; want the probe", probe, err) }
+  if _, err := r.allow(); !errors.Is(err, ErrUnavailable) { t.Fatalf("second request during the probe: err = %v", err) }
+
+  // A failed probe opens the breaker again at once
+  r.record(nil, "GET /series", fail, nil)
+  r.endProbe()
+  if _, err := r.allow(); !errors.Is(err, ErrUnavailable) { t.Fatalf("after a failed probe: err = %v", err) }
+
+  // A probe that ends unanswered lets the next request probe; an answer closes the breaker
+  time.Sleep(15 * time.Millisecond)
+  if probe, _ := r.allow(); !probe { t.Fatal("no probe after the second cooldown") }
+  r.endProbe()
+  if probe, _ := r.allow(); !probe { t.Fatal("a cancelled probe kept the breaker half open") }
+  r.record(nil, "GET /series", ok, nil)
+  r.endProbe()
+  for range 3 {
+    if probe, err := r.allow(); probe || err != nil { t.Fatalf("closed breaker: probe %v, err %v", probe, err) }
+  }
+}
+
+func TestRetryAfterIsCapped(t *testing.T) {
+  r := newRetrier(RetryPolicy{MaxDelay: time.Second}, nil)
+  for _, code := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+    resp := &http.Response{StatusCode: code, Header: http.Header{"Retry-After": {"3600"}}}
+    if d, again := r.retryable(resp, nil, 1); !again || d != time.Second { t.Errorf("%d with Retry-After 3600: wait %v, %v; want 1s", code, d, again) }
+  }
+}
+
+func TestRetrySleepHonoursContext(t *testing.T) {
+  c, srv := newTestClient(t)
+  if err := c.Login(context.Background()); err != nil { t.Fatal(err) }
+  srv.Throttle(1, "30")
+
+  ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+  defer cancel()
+  start := time.Now()
+  _, err := c.GetSeries(ctx, 78874, "en")
+  if !errors.Is(err, context.DeadlineExceeded) { t.Fatalf("err = %v, want the context's error", err) }
+  if time.Since(start) > time.Second { t.Errorf("waited %v through a cancelled context", time.Since(start)) }
+}
+
+func TestRetryBackoffIsJitteredAndCapped(t *testing.T) {
+  r := newRetrier(RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}, nil)
+  for attempt, full := range map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond, 8: time.Second} {
+    for i := 0; i < 50; i++ {
+      if d := r.backoff(attempt); d < full/2 || d > full {
+        t.Fatalf("backoff(%d) = %v, want within [%v, %v]", attempt, d, full/2, full)
+      }
+    }
+  }
+}
+
+func TestRetryLogsCarryTheRun(t *testing.T) {
+  dir := t.TempDir()
+  log, err := logx.Open(logx.Options{Level: "warn", Dir: dir})
+  if err != nil { t.Fatal(err) }
+  c, srv := newTestClient(t)
+  c.retry = newRetrier(fastRetry, log.With("provider", "tvdb"))
+  if err := c.Login(context.Background()); err != nil { t.Fatal(err) }
+
+  // The client outlives runs in watch and serve mode, so the run comes with the request
+  srv.Fail(1, 503)
+  if _, err := c.GetSeries(logx.WithAttrs(context.Background(), "run", "R1"), 78874, "en"); err != nil { t.Fatal(err) }
+  log.Close()
+
+  b, err := os.ReadFile(filepath.Join(dir, "tvrn.log"))
+  if err != nil { t.Fatal(err) }
+  var rec map[string]any
+  if err := json.Unmarshal(b, &rec); err != nil { t.Fatalf("%v:\n%s", err, b) }
+  if rec["run"] != "R1" || rec["provider"] != "tvdb" { t.Errorf("retry record = %v, want run and provider", rec) }
+}
@@ -0,0 +1,234 @@
+package tvdb
+
+import (
+  "context"
+  "errors"
+  "net/http"
+  "net/url"
+  "sort"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/GizzmoShifu/tvrn/pkg/types"
+)
+
+// TMDBClient talks to The Movie Database v3 API.
+// Aired order comes from the season endpoints; other orders come from TMDB episode groups,
+// where each group is a season (by its position) and each episode is numbered by its position.
+type TMDBClient struct {
+  BaseURL string
+  APIKey  string // 32 char v3 key, or a v4 read access token sent as a bearer token
+
+  hc    *http.Client
+  retry *retrier
+}
+
+func NewTMDB(base, apikey string) *TMDBClient {
+  if base == "" { base = "https://api.themoviedb.org/3" }
+  return &TMDBClient{BaseURL: base, APIKey: apikey, hc: &http.Client{Timeout: 20 * time.Second}, retry: newRetrier(DefaultRetry, nil)}
+}
+
+func (c *TMDBClient) Name() string { return "tmdb" }
+
+// TMDB has no session to open; Login only checks a key is configured.
+func (c *TMDBClient) Login(ctx context.Context) error {
+  if c.APIKey == "" { return errors.New("missing TMDB API key: set auth.tmdb_apikey or TMDB_APIKEY") }
+  return nil
+}
+
+func (c *TMDBClient) SearchSeries(ctx context.Context, q, lang string) ([]Series, error) {
+  v := url.Values{}
+  v.Set("query", q)
+  var sr struct {
+    Results []struct {
+      ID           int    `json:"id"`
+      Name         string `json:"name"`
+      OriginalName string `json:"original_name"`
+      FirstAir     string `json:"first_air_date"`
+    } `json:"results"`
+  }
+  if err := c.get(ctx, "/search/tv", v, lang, &sr); err != nil { return nil, err }
+
+  out := make([]Series, 0, len(sr.Results))
+  for _, d := range sr.Results {
+    s := Series{ID: d.ID, Name: d.Name, Year: yearOf(d.FirstAir), IDs: types.RemoteIDs{TMDB: d.ID}}
+    if d.OriginalName != "" && d.OriginalName != d.Name { s.Aliases = []string{d.OriginalName} }
+    out = append(out, s)
+  }
+  return out, nil
+}
+
+func (c *TMDBClient) GetSeries(ctx context.Context, id int, lang string) (Series, error) {
+  v := url.Values{}
+  v.Set("append_to_response", "external_ids")
+  var d struct {
+    tmdbShow
+    External struct {
+      TVDB int    `json:"tvdb_id"`
+      IMDb string `json:"imdb_id"`
+    } `json:"external_ids"`
+  }
+  if err := c.get(ctx, "/tv/"+strconv.Itoa(id), v, lang, &d); err != nil { return Series{}, err }
+  return Series{
+    ID: d.ID, Name: d.Name, Year: yearOf(d.FirstAir),
+    IDs: types.RemoteIDs{TMDB: d.ID, TVDB: d.External.TVDB, IMDb: d.External.IMDb},
+  }, nil
+}
+
+func (c *TMDBClient) GetEpisodes(ctx context.Context, id int, order string, season int, lang string) ([]Episode, error) {
+  order = normaliseOrder(order)
+  if order != "default" { return c.groupEpisodes(ctx, id, order, season, lang) }
+
+  seasons := []int{season}
+  if season == 0 {
+    d, err := c.show(ctx, id, lang)
+    if err != nil { return nil, err }
+    seasons = seasons[:0]
+    for _, s := range d.Seasons { seasons = append(seasons, s.Number) }
+    sort.Ints(seasons)
+  }
+
+  var out []Episode
+  for _, n := range seasons {
+    var sr struct {
+      Episodes []tmdbEpisode `json:"episodes"`
+    }
+    if err := c.get(ctx, "/tv/"+strconv.Itoa(id)+"/season/"+strconv.Itoa(n), nil, lang, &sr); err != nil {
+      // a season the show doesn't have is an empty season, not a failed run
+      var se *StatusError
+      if season > 0 && errors.As(err, &se) && se.Code == http.StatusNotFound { return nil, nil }
+      return nil, err
+    }
+    for _, e := range sr.Episodes {
+      out = append(out, Episode{
+        ID: e.ID, Season: e.Season, Number: e.Number, Title: e.Name,
+        AirDate: dateOf(e.AirDate), Runtime: e.Runtime, IsSpecial: e.Season == 0, IDs: types.RemoteIDs{TMDB: e.ID},
+      })
+    }
+  }
+  if season == 0 { absoluteNumbers(out) }
+  return out, nil
+}
+
+// ===== helpers =====
+
+type tmdbEpisode struct {
+  ID      int    `json:"id"`
+  Name    string `json:"name"`
+  AirDate string `json:"air_date"`
+  Season  int    `json:"season_number"`
+  Number  int    `json:"episode_number"`
+  Order   int    `json:"order"`
+  Runtime int    `json:"runtime"`
+}
+
+type tmdbShow struct {
+  ID       int    `json:"id"`
+  Name     string `json:"name"`
+  FirstAir string `json:"first_air_date"`
+  Seasons  []struct {
+    Number int `json:"season_number"`
+  } `json:"seasons"`
+}
+
+func (c *TMDBClient) show(ctx context.Context, id int, lang string) (tmdbShow, error) {
+  var d tmdbShow
+  err := c.get(ctx, "/tv/"+strconv.Itoa(id), nil, lang, &d)
+  return d, err
+}
+
+// tmdbGroupTypes maps our order names onto TMDB episode group types.
+var tmdbGroupTypes = map[string]int{
+  "absolute":      2,
+  "dvd":           3,
+  "alternate":     4, // digital
+  "alternate-dvd": 3,
+  "regional":      7, // TV
+}
+
+func (c *TMDBClient) groupEpisodes(ctx context.Context, id int, order string, season int, lang string) ([]Episode, error) {
+  want, ok := tmdbGroupTypes[order]
+  if !ok { return nil, errors.New("tmdb: unsupported order " + order) }
+
+  var gl struct {
+    Results []struct {
+      ID    string `json:"id"`
+      Type  int    `json:"type"`
+      Count int    `json:"episode_count"`
+    } `json:"results"`
+  }
+  if err := c.get(ctx, "/tv/"+strconv.Itoa(id)+"/episode_groups", nil, lang, &gl); err != nil { return nil, err }
+
+  // several groups may share a type; the most complete one wins
+  gid, best := "", -1
+  for _, g := range gl.Results {
+    if g.Type == want && g.Count > best { gid, best = g.ID, g.Count }
+  }
+  if gid == "" { return nil, nil }
+
+  var gd struct {
+    Groups []struct {
+      Name     string        `json:"name"`
+      Order    int           `json:"order"`
+      Episodes []tmdbEpisode `json:"episodes"`
+    } `json:"groups"`
+  }
+  if err := c.get(ctx, "/tv/episode_group/"+gid, nil, lang, &gd); err != nil { return nil, err }
+
+  var out []Episode
+  abs := 0
+  for _, g := range gd.Groups {
+    sn := g.Order
+    if strings.EqualFold(strings.TrimSpace(g.Name), "specials") { sn = 0 }
+    for _, e := range g.Episodes {
+      ep := Episode{
+        ID: e.ID, Season: sn, Number: e.Order + 1, Title: e.Name,
+        AirDate: dateOf(e.AirDate), Runtime: e.Runtime, IsSpecial: sn == 0, IDs: types.RemoteIDs{TMDB: e.ID},
+      }
+      if sn > 0 { abs++; ep.Absolute = abs }
+      if order == "absolute" && sn > 0 { ep.Season, ep.Number = 1, abs }
+      if season == 0 || ep.Season == season { out = append(out, ep) }
+    }
+  }
+  return out, nil
+}
+
+func (c *TMDBClient) get(ctx context.Context, p string, v url.Values, lang string, out any) error {
+  if v == nil { v = url.Values{} }
+  if lang != "" { v.Set("language", lang) }
+  hdr := http.Header{}
+  if len(c.APIKey) > 40 {
+    hdr.Set("Authorization", "Bearer "+c.APIKey)
+  } else {
+    v.Set("api_key", c.APIKey)
+  }
+  u := strings.TrimRight(c.BaseURL, "/") + p
+  if len(v) > 0 { u += "?" + v.Encode() }
+  return getJSON(ctx, c.hc, c.retry, u, hdr, out)
+}
+
+func yearOf(date string) int {
+  if len(date) < 4 { return 0 }
+  y, _ := strconv.Atoi(date[:4])
+  return y
+}
+
+func dateOf(s string) time.Time {
+  t, _ := time.Parse("2006-01-02", strings.TrimSpace(s))
+  return t
+}
+
+// absoluteNumbers fills Absolute for regular episodes in aired sequence when the provider has none.
+func absoluteNumbers(eps []Episode) {
+  sort.SliceStable(eps, func(i, j int) bool {
+    if eps[i].Season != eps[j].Season { return eps[i].Season < eps[j].Season }
+    return eps[i].Number < eps[j].Number
+  })
+  n := 0
+  for i := range eps {
+    if eps[i].Season == 0 || eps[i].Absolute > 0 { continue }
+    n++
+    eps[i].Absolute = n
+  }
+}
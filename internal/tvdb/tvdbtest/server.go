@@ -0,0 +1,245 @@
+// Package tvdbtest is a fake TVDB v4 API for tests. It serves recorded JSON for login,
+// search, series and paginated episodes, and can be told to expire tokens, rate limit
+// or send malformed payloads so the client's recovery paths can be exercised.
+package tvdbtest
+
+import (
+  "embed"
+  "encoding/base64"
+  "encoding/json"
+  "fmt"
+  "net/http"
+  "net/http/httptest"
+  "net/url"
+  "strconv"
+  "strings"
+  "sync"
+  "testing"
+  "time"
+)
+
+// APIKey is the only key the fake server accepts
+const APIKey = "test-apikey"
+
+//go:embed fixtures/*.json
+var fixtures embed.FS
+
+type Server struct {
+  *httptest.Server
+  PageSize int           // episodes per page; small by default so pagination is exercised
+  TokenTTL time.Duration // lifetime written into each token's exp claim
+
+  mu         sync.Mutex
+  issued     int
+  valid      map[string]bool
+  throttle   int             // 429s still to send
+  retryAfter string
+  failing    int             // errors still to send
+  failCode   int
+  malformed  map[string]bool // path prefixes answered with broken JSON
+  hits       map[string]int  // requests by path
+}
+
+// New starts a fake server that is closed when the test ends
+func New(t testing.TB) *Server {
+  s := &Server{PageSize: 5, TokenTTL: 30 * 24 * time.Hour, valid: map[string]bool{}, malformed: map[string]bool{}, hits: map[string]int{}}
+  mux := http.NewServeMux()
+  mux.HandleFunc("POST /login", s.login)
+  mux.HandleFunc("GET /search", s.authed(s.search))
+  mux.HandleFunc("GET /series/{id}", s.authed(s.series))
+  mux.HandleFunc("GET /series/{id}/episodes/{order}", s.authed(s.episodes))
+  s.Server = httptest.NewServer(s.faults(mux))
+  t.Cleanup(s.Close)
+  return s
+}
+
+// ExpireTokens makes every token issued so far answer 401, as after a server-side expiry
+func (s *Server) ExpireTokens() {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  s.valid = map[string]bool{}
+}
+
+// Throttle answers the next n requests with 429 and the given Retry-After header
+func (s *Server) Throttle(n int, retryAfter string) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  s.throttle, s.retryAfter = n, retryAfter
+}
+
+// Fail answers the next n requests with the given status, e.g. 503
+func (s *Server) Fail(n, code int) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  s.failing, s.failCode = n, code
+}
+
+// Malform answers requests whose path starts with prefix with a truncated JSON body
+func (s *Server) Malform(prefix string) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  s.malformed[prefix] = true
+}
+
+// Logins counts successful logins
+func (s *Server) Logins() int {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  return s.issued
+}
+
+// Hits counts requests for a path, e.g. "/series/78874/episodes/default"
+func (s *Server) Hits(path string) int {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  return s.hits[path]
+}
+
+// ===== handlers =====
+
+func (s *Server) faults(next http.Handler) http.Handler {
+  return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    s.mu.Lock()
+    s.hits[r.URL.Path]++
+    throttled := s.throttle > 0
+    if throttled { s.throttle-- }
+    retry := s.retryAfter
+    failed, code := s.failing > 0 && !throttled, s.failCode
+    if failed { s.failing-- }
+    broken := false
+    for p := range s.malformed {
+      if strings.HasPrefix(r.URL.Path, p) { broken = true }
+    }
+    s.mu.Unlock()
+
+    switch {
+    case throttled:
+      w.Header().Set("Retry-After", retry)
+      writeJSON(w, http.StatusTooManyRequests, failure("rate limit exceeded"))
+    case failed:
+      writeJSON(w, code, failure(http.StatusText(code)))
+    case broken:
+      w.Header().Set("Content-Type", "application/json")
+      fmt.Fprint(w, `{"status":"success","data":{"episodes":[{"id":1,"name":"Tru`)
+    default:
+      next.ServeHTTP(w, r)
+    }
+  })
+}
+
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+  var req struct{ APIKey string `json:"apikey"` }
+  if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.APIKey != APIKey {
+    writeJSON(w, http.StatusUnauthorized, failure("InvalidAPIKey"))
+    return
+  }
+  s.mu.Lock()
+  s.issued++
+  tok := jwt(s.issued, time.Now().Add(s.TokenTTL))
+  s.valid[tok] = true
+  s.mu.Unlock()
+  writeJSON(w, http.StatusOK, map[string]any{"status": "success", "data": map[string]string{"token": tok}})
+}
+
+func (s *Server) authed(h http.HandlerFunc) http.HandlerFunc {
+  return func(w http.ResponseWriter, r *http.Request) {
+    tok := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+    s.mu.Lock()
+    ok := s.valid[tok]
+    s.mu.Unlock()
+    if !ok {
+      writeJSON(w, http.StatusUnauthorized, failure("Unauthorized"))
+      return
+    }
+    h(w, r)
+  }
+}
+
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+  q := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+  var body json.RawMessage
+  if err := load("search_"+strings.ReplaceAll(q, " ", "-")+".json", &body); err != nil {
+    writeJSON(w, http.StatusOK, map[string]any{"status": "success", "data": []any{}})
+    return
+  }
+  writeRaw(w, body)
+}
+
+func (s *Server) series(w http.ResponseWriter, r *http.Request) {
+  var body json.RawMessage
+  if err := load("series_"+r.PathValue("id")+".json", &body); err != nil {
+    writeJSON(w, http.StatusNotFound, failure("NotFoundException"))
+    return
+  }
+  writeRaw(w, body)
+}
+
+// episodes pages through the recorded list the way TVDB does: page from 0, and
+// links.next as the URL of the next page or null
+func (s *Server) episodes(w http.ResponseWriter, r *http.Request) {
+  var all []map[string]any
+  if err := load("episodes_"+r.PathValue("id")+"_"+r.PathValue("order")+".json", &all); err != nil {
+    writeJSON(w, http.StatusNotFound, failure("NotFoundException"))
+    return
+  }
+  q := r.URL.Query()
+  if season, err := strconv.Atoi(q.Get("season")); err == nil && season > 0 {
+    var in []map[string]any
+    for _, e := range all {
+      if n, _ := e["seasonNumber"].(float64); int(n) == season { in = append(in, e) }
+    }
+    all = in
+  }
+
+  page, _ := strconv.Atoi(q.Get("page"))
+  size := s.PageSize
+  if size <= 0 { size = 500 }
+  from, to := page*size, (page+1)*size
+  if from > len(all) { from = len(all) }
+  if to > len(all) { to = len(all) }
+
+  links := map[string]any{"prev": nil, "next": nil, "total_items": len(all), "page_size": size}
+  self := url.URL{Scheme: "http", Host: r.Host, Path: r.URL.Path}
+  if to < len(all) {
+    nq := url.Values{}
+    for k, v := range q { nq[k] = v }
+    nq.Set("page", strconv.Itoa(page+1))
+    self.RawQuery = nq.Encode()
+    links["next"] = self.String()
+  }
+  writeJSON(w, http.StatusOK, map[string]any{
+    "status": "success",
+    "data":   map[string]any{"series": map[string]any{"id": r.PathValue("id")}, "episodes": all[from:to]},
+    "links":  links,
+  })
+}
+
+// ===== helpers =====
+
+// jwt shapes a token like TVDB's: three base64url parts, the middle one carrying exp
+func jwt(n int, exp time.Time) string {
+  enc := base64.RawURLEncoding.EncodeToString
+  claims := fmt.Sprintf(`{"exp":%d,"id":%d}`, exp.Unix(), n)
+  return enc([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + enc([]byte(claims)) + ".c2lnbmF0dXJl"
+}
+
+func load(name string, out any) error {
+  b, err := fixtures.ReadFile("fixtures/" + name)
+  if err != nil { return err }
+  return json.Unmarshal(b, out)
+}
+
+func failure(msg string) map[string]any {
+  return map[string]any{"status": "failure", "message": msg, "data": nil}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+  w.Header().Set("Content-Type", "application/json")
+  w.WriteHeader(code)
+  _ = json.NewEncoder(w).Encode(v)
+}
+
+func writeRaw(w http.ResponseWriter, b []byte) {
+  w.Header().Set("Content-Type", "application/json")
+  w.Write(b)
+}
@@ -0,0 +1,172 @@
+package tvdb
+
+import (
+  "context"
+  "net/http"
+  "net/url"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/GizzmoShifu/tvrn/pkg/types"
+)
+
+// TVmazeClient talks to the public TVmaze API, which needs no key.
+// Aired order is the show's episode list; other orders come from TVmaze alternate lists.
+// TVmaze files specials inside their season with no number, so they are mapped to season 0
+// and numbered in air order.
+type TVmazeClient struct {
+  BaseURL string
+
+  hc    *http.Client
+  retry *retrier
+}
+
+func NewTVmaze(base string) *TVmazeClient {
+  if base == "" { base = "https://api.tvmaze.com" }
+  return &TVmazeClient{BaseURL: base, hc: &http.Client{Timeout: 20 * time.Second}, retry: newRetrier(DefaultRetry, nil)}
+}
+
+func (c *TVmazeClient) Name() string { return "tvmaze" }
+
+func (c *TVmazeClient) Login(ctx context.Context) error { return nil }
+
+func (c *TVmazeClient) SearchSeries(ctx context.Context, q, _lang string) ([]Series, error) {
+  v := url.Values{}
+  v.Set("q", q)
+  var sr []struct {
+    Show tvmazeShow `json:"show"`
+  }
+  if err := c.get(ctx, "/search/shows?"+v.Encode(), &sr); err != nil { return nil, err }
+
+  out := make([]Series, 0, len(sr))
+  for _, d := range sr { out = append(out, d.Show.series()) }
+  return out, nil
+}
+
+func (c *TVmazeClient) GetSeries(ctx context.Context, id int, _lang string) (Series, error) {
+  var d tvmazeShow
+  if err := c.get(ctx, "/shows/"+strconv.Itoa(id), &d); err != nil { return Series{}, err }
+  return d.series(), nil
+}
+
+func (c *TVmazeClient) GetEpisodes(ctx context.Context, id int, order string, season int, _lang string) ([]Episode, error) {
+  order = normaliseOrder(order)
+
+  var out []Episode
+  switch order {
+  case "default", "absolute":
+    var eps []tvmazeEpisode
+    if err := c.get(ctx, "/shows/"+strconv.Itoa(id)+"/episodes?specials=1", &eps); err != nil { return nil, err }
+    out = mapTVmaze(eps)
+  default:
+    list, err := c.alternateList(ctx, id, order)
+    if err != nil || list == 0 { return nil, err }
+    var alt []struct {
+      Season   int  `json:"season"`
+      Number   *int `json:"number"`
+      Embedded struct {
+        Episodes []tvmazeEpisode `json:"episodes"`
+      } `json:"_embedded"`
+    }
+    if err := c.get(ctx, "/alternatelists/"+strconv.Itoa(list)+"/alternateepisodes?embed=episodes", &alt); err != nil {
+      return nil, err
+    }
+    var eps []tvmazeEpisode
+    for _, a := range alt {
+      for _, e := range a.Embedded.Episodes {
+        e.Season, e.Number = a.Season, a.Number
+        eps = append(eps, e)
+      }
+    }
+    out = mapTVmaze(eps)
+  }
+
+  absoluteNumbers(out)
+  if order == "absolute" {
+    for i := range out {
+      if out[i].Season > 0 { out[i].Season, out[i].Number = 1, out[i].Absolute }
+    }
+  }
+  if season == 0 { return out, nil }
+  filtered := out[:0]
+  for _, e := range out {
+    if e.Season == season { filtered = append(filtered, e) }
+  }
+  return filtered, nil
+}
+
+// ===== helpers =====
+
+type tvmazeShow struct {
+  ID        int    `json:"id"`
+  Name      string `json:"name"`
+  Premiered string `json:"premiered"`
+  Externals struct {
+    TVDB int    `json:"thetvdb"`
+    IMDb string `json:"imdb"`
+  } `json:"externals"`
+}
+
+func (d tvmazeShow) series() Series {
+  return Series{
+    ID: d.ID, Name: d.Name, Year: yearOf(d.Premiered),
+    IDs: types.RemoteIDs{TVmaze: d.ID, TVDB: d.Externals.TVDB, IMDb: d.Externals.IMDb},
+  }
+}
+
+type tvmazeEpisode struct {
+  ID      int    `json:"id"`
+  Name    string `json:"name"`
+  Season  int    `json:"season"`
+  Number  *int   `json:"number"`
+  AirDate string `json:"airdate"`
+  Runtime int    `json:"runtime"`
+}
+
+// tvmazeListFlags maps our order names onto the flag TVmaze sets on an alternate list.
+var tvmazeListFlags = map[string]string{
+  "dvd":           "dvd_release",
+  "alternate-dvd": "dvd_release",
+  "alternate":     "verbatim_order",
+  "regional":      "country_premiere",
+}
+
+func (c *TVmazeClient) alternateList(ctx context.Context, id int, order string) (int, error) {
+  flag, ok := tvmazeListFlags[order]
+  if !ok { return 0, nil }
+  var lists []map[string]any
+  if err := c.get(ctx, "/shows/"+strconv.Itoa(id)+"/alternatelists", &lists); err != nil { return 0, err }
+  for _, l := range lists {
+    if on, _ := l[flag].(bool); on { return intFromAny(l["id"]), nil }
+  }
+  return 0, nil
+}
+
+// mapTVmaze converts episodes, moving unnumbered specials into season 0.
+func mapTVmaze(eps []tvmazeEpisode) []Episode {
+  out := make([]Episode, 0, len(eps))
+  special := 0
+  for _, e := range eps {
+    s, n := e.Season, intOrZero(e.Number)
+    isSpecial := e.Number == nil
+    if isSpecial {
+      special++
+      s, n = 0, special
+    }
+    out = append(out, Episode{
+      ID: e.ID, Season: s, Number: n, Title: e.Name,
+      AirDate: dateOf(e.AirDate), Runtime: e.Runtime, IsSpecial: isSpecial, IDs: types.RemoteIDs{TVmaze: e.ID},
+    })
+  }
+  return out
+}
+
+func intOrZero(p *int) int {
+  if p == nil { return 0 }
+  return *p
+}
+
+func (c *TVmazeClient) get(ctx context.Context, p string, out any) error {
+  return getJSON(ctx, c.hc, c.retry, strings.TrimRight(c.BaseURL, "/")+p, nil, out)
+}
@@ -1,3 +1,40 @@
 package types
 
-// Common cross-package types can live here if needed later
\ No newline at end of file
+// Common cross-package types can live here if needed later
+
+// RemoteIDs cross-references one show or episode across metadata providers.
+// Zero values mean unknown.
+type RemoteIDs struct {
+  TVDB   int    `json:"tvdb,omitempty"`
+  TMDB   int    `json:"tmdb,omitempty"`
+  TVmaze int    `json:"tvmaze,omitempty"`
+  IMDb   string `json:"imdb,omitempty"`
+}
+
+// Merge fills unknown IDs from o and returns the result.
+func (r RemoteIDs) Merge(o RemoteIDs) RemoteIDs {
+  if r.TVDB == 0 { r.TVDB = o.TVDB }
+  if r.TMDB == 0 { r.TMDB = o.TMDB }
+  if r.TVmaze == 0 { r.TVmaze = o.TVmaze }
+  if r.IMDb == "" { r.IMDb = o.IMDb }
+  return r
+}
+
+// Get returns the ID for a provider name, or 0 when unknown. IMDb IDs are not numeric
+// and are read from the IMDb field directly.
+func (r RemoteIDs) Get(provider string) int {
+  switch provider {
+  case "tvdb": return r.TVDB
+  case "tmdb": return r.TMDB
+  case "tvmaze": return r.TVmaze
+  }
+  return 0
+}
+
+// Shares reports whether both sides know the same ID for any provider.
+func (r RemoteIDs) Shares(o RemoteIDs) bool {
+  return (r.TVDB != 0 && r.TVDB == o.TVDB) ||
+    (r.TMDB != 0 && r.TMDB == o.TMDB) ||
+    (r.TVmaze != 0 && r.TVmaze == o.TVmaze) ||
+    (r.IMDb != "" && r.IMDb == o.IMDb)
+}